@@ -0,0 +1,114 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-sdk/client"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	HEALTH_POLICY_FAIL = "fail"
+	HEALTH_POLICY_WARN = "warn"
+)
+
+type HealthReport struct {
+	Members  client.EtcdMembers
+	Problems []string
+}
+
+func (report *HealthReport) IsHealthy() bool {
+	return len(report.Problems) == 0
+}
+
+func getMemberName(members client.EtcdMembers, id uint64) string {
+	for _, member := range members.Members {
+		if member.Id == id {
+			return member.Name
+		}
+	}
+
+	return fmt.Sprintf("%x", id)
+}
+
+func getAlarmsWithRetries(cli *client.EtcdClient, retries uint64) (*clientv3.AlarmResponse, error) {
+	ctx, cancel := context.WithTimeout(cli.Context, cli.RequestTimeout)
+	defer cancel()
+
+	res, err := cli.Client.AlarmList(ctx)
+	if err != nil {
+		if retries == 0 || (!client.ErrorIsRetryable(err)) {
+			return nil, err
+		}
+
+		time.Sleep(cli.RetryInterval)
+		return getAlarmsWithRetries(cli, retries-1)
+	}
+
+	return res, nil
+}
+
+/*
+Checks the responsiveness of the members of the cluster, the presence of a leader, the active alarms
+and how far behind the leader's raft index the applied index of each member is.
+A maxRaftLag of 0 disables the last check.
+Errors are only returned if the checks could not be performed. Health problems are listed in the report.
+*/
+func CheckHealth(cli *client.EtcdClient, maxRaftLag uint64) (HealthReport, error) {
+	report := HealthReport{Problems: []string{}}
+
+	members, membersErr := cli.GetMembers(true)
+	if membersErr != nil {
+		return report, membersErr
+	}
+	report.Members = members
+
+	var leader *client.EtcdMember
+	for idx, member := range members.Members {
+		if !member.Status.IsResponsive {
+			report.Problems = append(report.Problems, fmt.Sprintf("Member '%s' is not responsive: %s", member.Name, member.Status.ResponseError.Error()))
+			continue
+		}
+
+		if member.Status.IsLeader {
+			leader = &members.Members[idx]
+		}
+	}
+
+	if leader == nil {
+		report.Problems = append(report.Problems, "Cluster has no reachable leader")
+	} else if maxRaftLag > 0 {
+		for _, member := range members.Members {
+			if (!member.Status.IsResponsive) || member.Status.RaftAppliedIndex >= leader.Status.RaftIndex {
+				continue
+			}
+
+			lag := leader.Status.RaftIndex - member.Status.RaftAppliedIndex
+			if lag > maxRaftLag {
+				report.Problems = append(report.Problems, fmt.Sprintf("Member '%s' has an applied index lagging %d entries behind the leader's raft index", member.Name, lag))
+			}
+		}
+	}
+
+	alarms, alarmsErr := getAlarmsWithRetries(cli, cli.Retries)
+	if alarmsErr != nil {
+		return report, alarmsErr
+	}
+
+	for _, alarm := range alarms.Alarms {
+		report.Problems = append(report.Problems, fmt.Sprintf("Alarm %s is raised on member '%s'", alarm.Alarm.String(), getMemberName(members, alarm.MemberID)))
+	}
+
+	return report, nil
+}
+
+func ValidateHealthPolicy(policy string) error {
+	if policy != HEALTH_POLICY_FAIL && policy != HEALTH_POLICY_WARN {
+		return errors.New(fmt.Sprintf("Unsupported unhealthy cluster policy '%s'. Valid policies are '%s' and '%s'", policy, HEALTH_POLICY_FAIL, HEALTH_POLICY_WARN))
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-sdk/client"
+)
+
+const (
+	SELECTION_LEADER                = "leader"
+	SELECTION_PREFER_FOLLOWER       = "prefer-follower"
+	SELECTION_HIGHEST_APPLIED_INDEX = "highest-applied-index"
+)
+
+func ValidateSelectionPolicy(policy string) error {
+	if policy != SELECTION_LEADER && policy != SELECTION_PREFER_FOLLOWER && policy != SELECTION_HIGHEST_APPLIED_INDEX {
+		return errors.New(fmt.Sprintf(
+			"Unsupported member selection policy '%s'. Valid policies are '%s', '%s' and '%s'",
+			policy,
+			SELECTION_LEADER,
+			SELECTION_PREFER_FOLLOWER,
+			SELECTION_HIGHEST_APPLIED_INDEX,
+		))
+	}
+
+	return nil
+}
+
+func getHighestAppliedIndex(members []client.EtcdMember) (client.EtcdMember, bool) {
+	var selected client.EtcdMember
+	found := false
+
+	for _, member := range members {
+		if (!found) || member.Status.RaftAppliedIndex > selected.Status.RaftAppliedIndex {
+			selected = member
+			found = true
+		}
+	}
+
+	return selected, found
+}
+
+/*
+Selects the member to take a snapshot from according to the policy, among the responsive members that are not learners.
+The members must have been retrieved with their status.
+*/
+func SelectMember(members client.EtcdMembers, policy string) (client.EtcdMember, error) {
+	candidates := []client.EtcdMember{}
+	followers := []client.EtcdMember{}
+	var leader *client.EtcdMember
+
+	for idx, member := range members.Members {
+		if member.IsLearner || member.Status == nil || (!member.Status.IsResponsive) || len(member.ClientUrls) == 0 {
+			continue
+		}
+
+		candidates = append(candidates, member)
+		if member.Status.IsLeader {
+			leader = &members.Members[idx]
+		} else {
+			followers = append(followers, member)
+		}
+	}
+
+	switch policy {
+	case SELECTION_LEADER:
+		if leader == nil {
+			return client.EtcdMember{}, errors.New("No responsive leader was found to take the snapshot from")
+		}
+		return *leader, nil
+	case SELECTION_PREFER_FOLLOWER:
+		if follower, ok := getHighestAppliedIndex(followers); ok {
+			return follower, nil
+		}
+		if leader == nil {
+			return client.EtcdMember{}, errors.New("No responsive member was found to take the snapshot from")
+		}
+		return *leader, nil
+	case SELECTION_HIGHEST_APPLIED_INDEX:
+		if member, ok := getHighestAppliedIndex(candidates); ok {
+			return member, nil
+		}
+		return client.EtcdMember{}, errors.New("No responsive member was found to take the snapshot from")
+	}
+
+	return client.EtcdMember{}, ValidateSelectionPolicy(policy)
+}
+
+/*
+Streams a snapshot from the given member into a file at the given path.
+The snapshot is written in a temporary file that is renamed once complete so that a partial snapshot is never left at the path.
+*/
+func SaveSnapshot(cli *client.EtcdClient, member client.EtcdMember, path string, timeout time.Duration) error {
+	memberCli, memberCliErr := cli.SetEndpoints(member.ClientUrls[:1])
+	if memberCliErr != nil {
+		return memberCliErr
+	}
+	defer memberCli.Close()
+
+	ctx, cancel := context.WithTimeout(cli.Context, timeout)
+	defer cancel()
+
+	reader, snapErr := memberCli.Client.Snapshot(ctx)
+	if snapErr != nil {
+		return snapErr
+	}
+	defer reader.Close()
+
+	partPath := path + ".part"
+	file, fErr := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if fErr != nil {
+		return fErr
+	}
+
+	_, cpyErr := io.Copy(file, reader)
+	if cpyErr == nil {
+		cpyErr = file.Sync()
+	}
+	closeErr := file.Close()
+	if cpyErr != nil || closeErr != nil {
+		os.Remove(partPath)
+		if cpyErr != nil {
+			return cpyErr
+		}
+		return closeErr
+	}
+
+	return os.Rename(partPath, path)
+}
@@ -0,0 +1,65 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Ferlab-Ste-Justine/etcd-sdk/client"
+)
+
+func getTestMembers() client.EtcdMembers {
+	return client.EtcdMembers{
+		Members: []client.EtcdMember{
+			client.EtcdMember{Name: "leader", ClientUrls: []string{"https://10.0.0.1:2379"}, Status: &client.EtcdMemberStatus{IsResponsive: true, IsLeader: true, RaftIndex: 110, RaftAppliedIndex: 100}},
+			client.EtcdMember{Name: "follower-1", ClientUrls: []string{"https://10.0.0.2:2379"}, Status: &client.EtcdMemberStatus{IsResponsive: true, RaftIndex: 110, RaftAppliedIndex: 105}},
+			client.EtcdMember{Name: "follower-2", ClientUrls: []string{"https://10.0.0.3:2379"}, Status: &client.EtcdMemberStatus{IsResponsive: true, RaftIndex: 110, RaftAppliedIndex: 103}},
+			client.EtcdMember{Name: "down", ClientUrls: []string{"https://10.0.0.4:2379"}, Status: &client.EtcdMemberStatus{IsResponsive: false, ResponseError: errors.New("timeout")}},
+			client.EtcdMember{Name: "learner", IsLearner: true, ClientUrls: []string{"https://10.0.0.5:2379"}, Status: &client.EtcdMemberStatus{IsResponsive: true, RaftIndex: 110, RaftAppliedIndex: 109}},
+		},
+	}
+}
+
+func TestSelectMember(t *testing.T) {
+	members := getTestMembers()
+
+	expectations := map[string]string{
+		SELECTION_LEADER:                "leader",
+		SELECTION_PREFER_FOLLOWER:       "follower-1",
+		SELECTION_HIGHEST_APPLIED_INDEX: "follower-1",
+	}
+
+	for policy, expected := range expectations {
+		member, memberErr := SelectMember(members, policy)
+		if memberErr != nil {
+			t.Errorf("Error selecting member with policy '%s': %s", policy, memberErr.Error())
+			continue
+		}
+
+		if member.Name != expected {
+			t.Errorf("Expected member '%s' to be selected with policy '%s' and '%s' was", expected, policy, member.Name)
+		}
+	}
+
+	_, memberErr := SelectMember(members, "random")
+	if memberErr == nil {
+		t.Errorf("Expected an error selecting a member with an unsupported policy")
+	}
+}
+
+func TestSelectMemberWithoutFollowers(t *testing.T) {
+	members := getTestMembers()
+	members.Members = members.Members[:1]
+
+	member, memberErr := SelectMember(members, SELECTION_PREFER_FOLLOWER)
+	if memberErr != nil || member.Name != "leader" {
+		t.Errorf("Expected leader to be selected when no follower is available. Got '%s', %v", member.Name, memberErr)
+	}
+
+	members.Members[0].Status.IsLeader = false
+	members.Members[0].Status.IsResponsive = false
+
+	_, memberErr = SelectMember(members, SELECTION_LEADER)
+	if memberErr == nil {
+		t.Errorf("Expected an error requiring the leader when it is not responsive")
+	}
+}
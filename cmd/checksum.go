@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+)
+
+func getFileChecksum(path string) (string, error) {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return "", openErr
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, cpyErr := io.Copy(hash, file)
+	if cpyErr != nil {
+		return "", cpyErr
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+/*
+Returns the SHA-256 checksums of the snapshot file and of the object it is uploaded as.
+As the encryption of the parts of an upload only depends on the cipher key and nonce base, the object can be reproduced ahead of the upload.
+*/
+func getSnapshotChecksums(path string, masterKey []byte, cipherKey []byte, nonceBase []byte) (string, string, error) {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return "", "", openErr
+	}
+	defer file.Close()
+
+	snapshotHash := sha256.New()
+	if len(cipherKey) == 0 {
+		_, cpyErr := io.Copy(snapshotHash, file)
+		if cpyErr != nil {
+			return "", "", cpyErr
+		}
+
+		checksum := hex.EncodeToString(snapshotHash.Sum(nil))
+		return checksum, checksum, nil
+	}
+
+	objectHash := sha256.New()
+	encrStream := encryption.NewEncryptStreamAt(masterKey, cipherKey, nonceBase, 0, io.TeeReader(file, snapshotHash), 1024*1024)
+	_, cpyErr := io.Copy(objectHash, encrStream)
+	if cpyErr != nil {
+		return "", "", cpyErr
+	}
+
+	return hex.EncodeToString(snapshotHash.Sum(nil)), hex.EncodeToString(objectHash.Sum(nil)), nil
+}
+
+/*
+Compares the checksum of a downloaded file with the checksum recorded with the backup, which is the checksum of the snapshot
+if the file was decrypted and the checksum of the object otherwise. Backups made before checksums were recorded are not checked.
+*/
+func checkDownloadChecksum(conf config.Config, metadata map[string]string, path string) error {
+	key := s3.METADATA_OBJECT_SHA256
+	if conf.EncryptionKeyPath != "" {
+		key = s3.METADATA_SNAPSHOT_SHA256
+	}
+
+	expected, ok := metadata[key]
+	if !ok {
+		getLogger(conf).Warnf("The backup has no recorded checksum, its integrity cannot be checked")
+		return nil
+	}
+
+	checksum, checksumErr := getFileChecksum(path)
+	if checksumErr != nil {
+		return errors.New(fmt.Sprintf("Error computing the checksum of the downloaded file: %s", checksumErr.Error()))
+	}
+
+	if checksum != expected {
+		return errors.New(fmt.Sprintf("Checksum of the downloaded file '%s' does not match the recorded checksum '%s'", checksum, expected))
+	}
+
+	return nil
+}
@@ -2,76 +2,409 @@ package cmd
 
 import (
 	"context"
-	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Ferlab-Ste-Justine/etcd-backup/cluster"
 	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
 	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/hooks"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/notify"
 	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/snapshot"
 
-	"github.com/Ferlab-Ste-Justine/etcd-sdk/client"
 	"github.com/spf13/cobra"
 )
 
-func generateBackupCmd(confPath *string) *cobra.Command {
+/*
+Returns the state of an interrupted upload if it can safely be resumed: it must be an upload of the target to the same s3 store,
+the snapshot file must be the one that was being uploaded, the upload must be recent enough and it must have been encrypted (or not)
+with the master key of the configuration.
+Uploads of the target that cannot be resumed are aborted. Uploads of other targets or s3 stores are left to the gc command.
+*/
+func getResumableUpload(conf config.Config, statePath string) (uploadState, bool) {
+	var state uploadState
+	found, loadErr := loadState(statePath, &state)
+	if (!found) || loadErr != nil {
+		return state, false
+	}
+
+	if !state.belongsTo(conf) {
+		getLogger(conf).WithFields(logger.Fields{"upload_id": state.UploadId}).Warnf("Not resuming the incomplete upload of target '%s' in bucket '%s', which the gc command can clean up", state.Target, state.Bucket)
+		return uploadState{}, false
+	}
+
+	resumable := true
+	snapshotInfo, statErr := os.Stat(conf.SnapshotPath)
+	if statErr != nil || snapshotInfo.Size() != state.SnapshotSize || (!snapshotInfo.ModTime().Equal(state.SnapshotModTime)) {
+		resumable = false
+	}
+
+	if time.Since(state.Timestamp) > conf.Backup.ResumeMaxAge {
+		resumable = false
+	}
+
+	if (len(state.CypherKey) > 0) != (conf.EncryptionKeyPath != "") {
+		resumable = false
+	}
+
+	//The master key may have been rotated since
+	if resumable && len(state.CypherKey) > 0 {
+		masterKey, masterKeyErr := getMasterKey(conf.EncryptionKeyPath)
+		if masterKeyErr == nil {
+			_, masterKeyErr = encryption.DecryptBytes(state.CypherKey, masterKey)
+		}
+		if masterKeyErr != nil {
+			resumable = false
+		}
+	}
+
+	if resumable {
+		return state, true
+	}
+
+	if state.UploadId != "" {
+		backup, backupErr := s3.ResumeMultipartBackup(conf.S3Client, state.getEntry(), state.UploadId)
+		if backupErr == nil {
+			backupErr = backup.Abort()
+		}
+		if backupErr != nil {
+			getLogger(conf).WithFields(logger.Fields{"upload_id": state.UploadId}).Warnf("Failed to abort the previous incomplete upload: %s", backupErr.Error())
+		}
+	}
+
+	removeErr := removeState(statePath)
+	if removeErr != nil {
+		getLogger(conf).WithFields(logger.Fields{"path": statePath}).Warnf("Failed to remove the state of the previous incomplete upload: %s", removeErr.Error())
+	}
+
+	return uploadState{}, false
+}
+
+/*
+Takes a snapshot of the etcd cluster in the snapshot file and returns the state of its upload
+*/
+func takeSnapshot(conf config.Config) (uploadState, error) {
+	cli, cliErr := connectEtcd(conf.EtcdClient)
+	if cliErr != nil {
+		return uploadState{}, errors.New(fmt.Sprintf("Error connecting to etcd: %s", cliErr.Error()))
+	}
+	defer cli.Close()
+
+	health, healthErr := cluster.CheckHealth(cli, conf.Backup.MaxRaftLag)
+	if healthErr != nil {
+		return uploadState{}, errors.New(fmt.Sprintf("Error checking the health of the etcd cluster: %s", healthErr.Error()))
+	}
+	if !health.IsHealthy() {
+		if conf.Backup.OnUnhealthy == cluster.HEALTH_POLICY_FAIL {
+			return uploadState{}, errors.New(fmt.Sprintf("Error checking the health of the etcd cluster: %s", strings.Join(health.Problems, ", ")))
+		}
+
+		for _, problem := range health.Problems {
+			getLogger(conf).Warnf("%s", problem)
+		}
+	}
+
+	member, memberErr := cluster.SelectMember(health.Members, conf.Backup.MemberSelection)
+	if memberErr != nil {
+		return uploadState{}, errors.New(fmt.Sprintf("Error selecting the member to snapshot: %s", memberErr.Error()))
+	}
+
+	start := time.Now()
+	snapshotErr := cluster.SaveSnapshot(cli, member, conf.SnapshotPath, conf.Backup.SnapshotTimeout)
+	if snapshotErr != nil {
+		return uploadState{}, errors.New(fmt.Sprintf("Error generating a snapshot file from etcd: %s", snapshotErr.Error()))
+	}
+
+	revision, revisionErr := snapshot.GetRevision(conf.SnapshotPath)
+	if revisionErr != nil {
+		return uploadState{}, errors.New(fmt.Sprintf("Error reading the revision of the snapshot file: %s", revisionErr.Error()))
+	}
+
+	snapshotInfo, statErr := os.Stat(conf.SnapshotPath)
+	if statErr != nil {
+		return uploadState{}, errors.New(fmt.Sprintf("Error getting the size of the generated snapshot file: %s", statErr.Error()))
+	}
+
+	getLogger(conf).WithFields(logger.Fields{
+		"member":           member.Name,
+		"revision":         revision,
+		"bytes":            snapshotInfo.Size(),
+		"duration_seconds": time.Since(start).Seconds(),
+	}).Infof("Took a snapshot of member '%s' at revision %d", member.Name, revision)
+
+	namingConv, namingErr := s3.GetNamingConvention(conf.S3Client)
+	if namingErr != nil {
+		return uploadState{}, errors.New(fmt.Sprintf("Error getting the naming convention of the backups: %s", namingErr.Error()))
+	}
+
+	entry, entryErr := namingConv.NewEntry(time.Now(), member.Name)
+	if entryErr != nil {
+		return uploadState{}, errors.New(fmt.Sprintf("Error naming the backup: %s", entryErr.Error()))
+	}
+
+	state := uploadState{
+		Target:          conf.TargetName,
+		Endpoint:        conf.S3Client.Endpoint,
+		Bucket:          conf.S3Client.Bucket,
+		ObjectsPrefix:   conf.S3Client.ObjectsPrefix,
+		Name:            entry.Name,
+		Timestamp:       entry.Timestamp,
+		SnapshotSize:    snapshotInfo.Size(),
+		SnapshotModTime: snapshotInfo.ModTime(),
+		Metadata: map[string]string{
+			s3.METADATA_ETCD_REVISION: strconv.FormatInt(revision, 10),
+			s3.METADATA_ETCD_MEMBER:   member.Name,
+		},
+	}
+
+	masterKeyBytes := []byte{}
+	cipherKey := []byte{}
+	if conf.EncryptionKeyPath != "" {
+		masterKey, masterKeyErr := getMasterKey(conf.EncryptionKeyPath)
+		if masterKeyErr != nil {
+			return uploadState{}, errors.New(fmt.Sprintf("Error reading master key: %s", masterKeyErr.Error()))
+		}
+
+		encrStream, encStreamErr := encryption.NewEncryptStream(masterKey, nil, 1024*1024)
+		if encStreamErr != nil {
+			return uploadState{}, errors.New(fmt.Sprintf("Error generating an encryption key: %s", encStreamErr.Error()))
+		}
+
+		encCiph, encCiphErr := encrStream.GetEncryptedCipherKey()
+		if encCiphErr != nil {
+			return uploadState{}, errors.New(fmt.Sprintf("Error generating an encryption key cypher: %s", encCiphErr.Error()))
+		}
+
+		state.CypherKey = encCiph
+		state.NonceBase = encrStream.Nonce.Base
+		masterKeyBytes = masterKey
+		cipherKey = encrStream.CipherKey
+	}
+
+	snapshotSum, objectSum, sumErr := getSnapshotChecksums(conf.SnapshotPath, masterKeyBytes, cipherKey, state.NonceBase)
+	if sumErr != nil {
+		return uploadState{}, errors.New(fmt.Sprintf("Error computing the checksums of the snapshot: %s", sumErr.Error()))
+	}
+	state.Metadata[s3.METADATA_SNAPSHOT_SHA256] = snapshotSum
+	state.Metadata[s3.METADATA_OBJECT_SHA256] = objectSum
+
+	return state, nil
+}
+
+/*
+Uploads the snapshot file in parts, encrypting each part independently so that an interrupted upload can be resumed.
+The parts of encrypted uploads hold a whole number of encryption chunks. No more parts are uploaded once the context is cancelled.
+*/
+func uploadSnapshot(ctx context.Context, conf config.Config, state uploadState, statePath string) error {
+	chunkSize := int64(1024 * 1024)
+	objectSize := state.SnapshotSize
+	alignment := int64(1)
+
+	masterKey := []byte{}
+	cipherKey := []byte{}
+	if len(state.CypherKey) > 0 {
+		var masterKeyErr error
+		masterKey, masterKeyErr = getMasterKey(conf.EncryptionKeyPath)
+		if masterKeyErr != nil {
+			return errors.New(fmt.Sprintf("Error reading master key: %s", masterKeyErr.Error()))
+		}
+
+		var cipherKeyErr error
+		cipherKey, cipherKeyErr = encryption.DecryptBytes(state.CypherKey, masterKey)
+		if cipherKeyErr != nil {
+			return errors.New(fmt.Sprintf("Error decrypting the encryption key of the backup: %s", cipherKeyErr.Error()))
+		}
+
+		objectSize = encryption.EncryptedSize(state.SnapshotSize, chunkSize)
+		alignment = chunkSize + encryption.ChunkOverhead
+	}
+
+	entry := state.getEntry()
+	log := getLogger(conf).WithFields(logger.Fields{"object": entry.GetObjectName("dump")})
+
+	var backup *s3.MultipartBackup
+	if state.UploadId != "" {
+		var resumeErr error
+		backup, resumeErr = s3.ResumeMultipartBackup(conf.S3Client, entry, state.UploadId)
+		if resumeErr != nil {
+			log.Warnf("Failed to resume the previous incomplete upload, starting over: %s", resumeErr.Error())
+			state.UploadId = ""
+		} else {
+			log.WithFields(logger.Fields{"upload_id": state.UploadId}).Infof("Resuming the incomplete upload of backup '%s'", state.Name)
+		}
+	}
+
+	if state.UploadId == "" {
+		partSize, partSizeErr := s3.GetPartSize(conf.S3Client.Upload, objectSize, alignment)
+		if partSizeErr != nil {
+			return errors.New(fmt.Sprintf("Error computing the upload part size: %s", partSizeErr.Error()))
+		}
+		state.PartSize = partSize
+
+		var startErr error
+		backup, startErr = s3.StartMultipartBackup(conf.S3Client, entry, state.CypherKey, state.Metadata)
+		if startErr != nil {
+			return errors.New(fmt.Sprintf("Error starting the upload of the snapshot in s3: %s", startErr.Error()))
+		}
+		state.UploadId = backup.UploadId
+
+		saveErr := saveState(statePath, state)
+		if saveErr != nil {
+			return errors.New(fmt.Sprintf("Error saving the state of the upload: %s", saveErr.Error()))
+		}
+	}
+
+	sourcePartSize := state.PartSize
+	if len(state.CypherKey) > 0 {
+		sourcePartSize = (state.PartSize / alignment) * chunkSize
+	}
+
+	partsCount := int(state.SnapshotSize / sourcePartSize)
+	if state.SnapshotSize%sourcePartSize != 0 || partsCount == 0 {
+		partsCount += 1
+	}
+
+	backupFileHandle, openErr := os.Open(conf.SnapshotPath)
+	if openErr != nil {
+		return errors.New(fmt.Sprintf("Error opening the generated snapshot file: %s", openErr.Error()))
+	}
+	defer backupFileHandle.Close()
+
+	start := time.Now()
+	uploadErr := backup.Upload(partsCount, func(partNumber int) (io.Reader, int64, error) {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+
+		offset := int64(partNumber-1) * sourcePartSize
+		length := min(sourcePartSize, state.SnapshotSize-offset)
+		section := io.NewSectionReader(backupFileHandle, offset, length)
+
+		if len(state.CypherKey) == 0 {
+			return section, length, nil
+		}
+
+		encrStream := encryption.NewEncryptStreamAt(masterKey, cipherKey, state.NonceBase, offset/chunkSize, section, chunkSize)
+		return encrStream, encryption.EncryptedSize(length, chunkSize), nil
+	})
+	if uploadErr != nil {
+		return errors.New(fmt.Sprintf("Error storing snapshot in s3, the upload will be resumed by the next backup: %s", uploadErr.Error()))
+	}
+
+	log.WithFields(logger.Fields{
+		"bytes":            objectSize,
+		"parts":            partsCount,
+		"duration_seconds": time.Since(start).Seconds(),
+	}).Infof("Stored backup '%s'", entry.GetTimestamp())
+	return nil
+}
+
+func runBackup(ctx context.Context, conf config.Config, event *notify.Event) error {
+	policyErr := cluster.ValidateSelectionPolicy(conf.Backup.MemberSelection)
+	if policyErr != nil {
+		return notify.WithStage("configuration", errors.New(fmt.Sprintf("Error validating member selection policy: %s", policyErr.Error())))
+	}
+
+	policyErr = cluster.ValidateHealthPolicy(conf.Backup.OnUnhealthy)
+	if policyErr != nil {
+		return notify.WithStage("configuration", errors.New(fmt.Sprintf("Error validating unhealthy cluster policy: %s", policyErr.Error())))
+	}
+
+	statePath := conf.SnapshotPath + ".upload"
+	state, resumable := getResumableUpload(conf, statePath)
+	if !resumable {
+		hooksErr := runHooks(conf, hooks.PRE_BACKUP, conf.Hooks.PreBackup, map[string]string{})
+		if hooksErr != nil {
+			return hooksErr
+		}
+
+		var snapshotErr error
+		state, snapshotErr = takeSnapshot(conf)
+		if snapshotErr != nil {
+			return notify.WithStage("snapshot", snapshotErr)
+		}
+	}
+
+	entry := state.getEntry()
+	event.Backup = entry.GetTimestamp()
+	event.Size = state.SnapshotSize
+	event.Revision, _ = strconv.ParseInt(state.Metadata[s3.METADATA_ETCD_REVISION], 10, 64)
+
+	//No snapshot is taken when the upload of a previous backup is resumed, so the backup holds the data of an earlier revision
+	if resumable {
+		event.Resumed = true
+		event.SnapshotAgeSeconds = time.Since(state.Timestamp).Seconds()
+		getLogger(conf).WithFields(logger.Fields{
+			"revision":             event.Revision,
+			"snapshot_age_seconds": event.SnapshotAgeSeconds,
+		}).Warnf("Resuming the upload of the snapshot of revision %d taken at %s instead of taking a new snapshot, the pre_backup hooks are not run", event.Revision, state.Timestamp.Format(time.RFC3339))
+	}
+
+	uploadErr := uploadSnapshot(ctx, conf, state, statePath)
+	if uploadErr != nil {
+		return notify.WithStage("upload", uploadErr)
+	}
+
+	removeErr := removeState(statePath)
+	if removeErr != nil {
+		return notify.WithStage("cleanup", errors.New(fmt.Sprintf("Error deleting the state of the upload: %s", removeErr.Error())))
+	}
+
+	delErr := os.Remove(conf.SnapshotPath)
+	if delErr != nil {
+		return notify.WithStage("cleanup", errors.New(fmt.Sprintf("Error deleting the transient snapshot file: %s", delErr.Error())))
+	}
+
+	if conf.ReplicateOnBackup && len(conf.Replicas) > 0 && ctx.Err() == nil {
+		replicateErr := runReplicate(ctx, conf, "")
+		if replicateErr != nil {
+			return notify.WithStage("replication", errors.New(fmt.Sprintf("Backup succeeded, but replication failed: %s", replicateErr.Error())))
+		}
+	}
+
+	hookVars := getEntryHookVars(entry)
+	hookVars["SIZE"] = strconv.FormatInt(state.SnapshotSize, 10)
+	return runHooks(conf, hooks.POST_BACKUP, conf.Hooks.PostBackup, hookVars)
+}
+
+func generateBackupCmd(confPath *string, targetName *string) *cobra.Command {
+	var uploadRateLimit string
+	var forceUnlock bool
+
 	var backupCmd = &cobra.Command{
 		Use:   "backup",
 		Short: "Create a snapshot in s3",
 		Run: func(cmd *cobra.Command, args []string) {
-			conf, confErr := config.GetConfig(*confPath)
+			conf, confErr := getConfig(*confPath)
 			AbortOnErr("Error getting configurations: %s", confErr)
 
-			cli, cliErr := client.Connect(context.Background(), client.EtcdClientOptions{
-				ClientCertPath:    conf.EtcdClient.Auth.ClientCert,
-				ClientKeyPath:     conf.EtcdClient.Auth.ClientKey,
-				CaCertPath:        conf.EtcdClient.Auth.CaCert,
-				Username:          conf.EtcdClient.Auth.Username,
-				Password:          conf.EtcdClient.Auth.Password,
-				EtcdEndpoints:     conf.EtcdClient.Endpoints,
-				ConnectionTimeout: conf.EtcdClient.ConnectionTimeout,
-				RequestTimeout:    conf.EtcdClient.RequestTimeout,
-				Retries:           conf.EtcdClient.Retries,
+			targets, targetsErr := conf.GetTargets(*targetName)
+			AbortOnErr("Error getting targets: %s", targetsErr)
+
+			runOnTargets(targets, func(target config.Config) error {
+				if cmd.Flags().Changed("upload-rate-limit") {
+					target = withUploadRateLimit(target, uploadRateLimit)
+				}
+
+				return runNotified(target, "backup", func(event *notify.Event) error {
+					return runLocked(target, "backup", forceUnlock, func(ctx context.Context) error {
+						return runBackup(ctx, target, event)
+					})
+				})
 			})
-			AbortOnErr("Error connecting to etcd: %s", cliErr)
-
-			duration, _ := time.ParseDuration("1h")
-			snapshotErr := cli.Snapshot(true, conf.SnapshotPath, duration)
-			AbortOnErr("Error generating a snapshot file from etcd: %s", snapshotErr)
-
-			backupFileHandle, openErr := os.Open(conf.SnapshotPath)
-			AbortOnErr("Error opening the generated snapshot file: %s", openErr)
-
-			if conf.EncryptionKeyPath != "" {
-				masterKeyHex, readErr := os.ReadFile(conf.EncryptionKeyPath)
-				AbortOnErr("Error opening master key file: %s", readErr)
-	
-				masterKey := make([]byte, hex.DecodedLen(len(masterKeyHex)))
-				_, convErr := hex.Decode(masterKey, masterKeyHex)
-				AbortOnErr("Error decoding master key hex format: %s", convErr)
-	
-				encrStream, encStreamErr := encryption.NewEncryptStream(masterKey, backupFileHandle, 1024*1024)
-				AbortOnErr("Error generating an encryption stream from master key and snapshot file: %s", encStreamErr)
-	
-				encCiph, encCiphErr := encrStream.GetEncryptedCipherKey()
-				AbortOnErr("Error generating an encryption key cypher: %s", encCiphErr)
-
-				backupErr := s3.Backup(encrStream, conf.S3Client, encCiph)
-				AbortOnErr("Error storing encrypted snapshot in s3: %s", backupErr)
-
-				delErr := os.Remove(conf.SnapshotPath)
-				AbortOnErr("Error deleting the transient snapshot file: %s", delErr)
-
-				return
-			}
-
-			backupErr := s3.Backup(backupFileHandle, conf.S3Client, []byte{})
-			AbortOnErr("Error storing snapshot in s3: %s", backupErr)
-
-			delErr := os.Remove(conf.SnapshotPath)
-			AbortOnErr("Error deleting the transient snapshot file: %s", delErr)
 		},
 	}
 
+	backupCmd.Flags().StringVar(&uploadRateLimit, "upload-rate-limit", "", "Maximum rate of the upload of the snapshot, and of its replication if enabled, in bytes per second (ex: 20MiB). Overrides the rate limit in the configuration file")
+
+	backupCmd.Flags().BoolVar(&forceUnlock, "force-unlock", false, "Remove the lock of the targets before taking it, even if another process holds it")
+
 	return backupCmd
 }
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/validation"
+
+	"github.com/spf13/cobra"
+)
+
+/*
+Checks that the etcd clusters of the targets and the s3 stores of the configuration can be reached.
+Returns the problems that were found.
+*/
+func checkConnectivity(conf config.Config, targetName string) []string {
+	problems := []string{}
+
+	targets, targetsErr := conf.GetTargets(targetName)
+	if targetsErr != nil {
+		return append(problems, targetsErr.Error())
+	}
+
+	for _, target := range targets {
+		cli, connErr := connectEtcd(target.EtcdClient)
+		if connErr == nil {
+			_, connErr = cli.GetMembers(false)
+			cli.Close()
+		}
+
+		if connErr != nil {
+			problems = append(problems, fmt.Sprintf("etcd cluster of target '%s': %s", target.TargetName, connErr.Error()))
+			continue
+		}
+
+		getLogger(target).Infof("Reached the etcd cluster of target '%s'", target.TargetName)
+	}
+
+	bucketErr := s3.CheckBucket(conf.S3Client)
+	if bucketErr != nil {
+		problems = append(problems, fmt.Sprintf("s3 store: %s", bucketErr.Error()))
+	} else {
+		cmdLogger.Infof("Reached the bucket '%s' of the s3 store", conf.S3Client.Bucket)
+	}
+
+	for _, replica := range conf.Replicas {
+		bucketErr = s3.CheckBucket(replica.S3Client)
+		if bucketErr != nil {
+			problems = append(problems, fmt.Sprintf("s3 store of replica '%s': %s", replica.Name, bucketErr.Error()))
+			continue
+		}
+
+		cmdLogger.Infof("Reached the bucket '%s' of replica '%s'", replica.S3Client.Bucket, replica.Name)
+	}
+
+	return problems
+}
+
+func runValidateConfig(conf config.Config, targetName string, connectivity bool) error {
+	report := validation.Validate(conf)
+	for _, warning := range report.Warnings {
+		cmdLogger.Warnf("%s", warning)
+	}
+
+	for _, validationErr := range report.Errors {
+		cmdLogger.Errorf("%s", validationErr)
+	}
+
+	if !report.IsValid() {
+		return errors.New(fmt.Sprintf("The configuration has %d error(s)", len(report.Errors)))
+	}
+
+	secretsErr := conf.ResolveSecrets()
+	if secretsErr != nil {
+		return errors.New(fmt.Sprintf("Error reading the credentials: %s", secretsErr.Error()))
+	}
+
+	if connectivity {
+		problems := checkConnectivity(conf, targetName)
+		for _, problem := range problems {
+			cmdLogger.Errorf("%s", problem)
+		}
+
+		if len(problems) > 0 {
+			return errors.New(fmt.Sprintf("%d connectivity check(s) failed", len(problems)))
+		}
+	}
+
+	fmt.Println("The configuration is valid")
+	return nil
+}
+
+func generateConfigCmd(confPath *string, targetName *string) *cobra.Command {
+	var configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Operations on the configuration",
+	}
+
+	var connectivity bool
+
+	var validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the configuration, reporting unknown keys, missing values and files that do not exist",
+		Run: func(cmd *cobra.Command, args []string) {
+			//The secret files are only read once the configuration is valid, so that missing files are reported like other problems
+			conf, confErr := config.GetUnresolvedConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+			cmdLogger = conf.GetLogger().WithFields(cmdLogger.Fields)
+
+			AbortOnErr("%s", runValidateConfig(conf, *targetName, connectivity))
+		},
+	}
+
+	validateCmd.Flags().BoolVarP(&connectivity, "check-connectivity", "k", false, "Also check that the etcd clusters of the targets and the s3 stores can be reached")
+
+	configCmd.AddCommand(validateCmd)
+
+	return configCmd
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/keyspace"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/snapshot"
+
+	"github.com/spf13/cobra"
+)
+
+func readBackupKeys(conf config.Config, backupTimestamp string, selector keyspace.KeySelector) (map[string]keyspace.KeyRecord, error) {
+	downloadErr := downloadBackup(conf, backupTimestamp, conf.SnapshotPath)
+	if downloadErr != nil {
+		return nil, downloadErr
+	}
+
+	keys, _, readErr := snapshot.ReadKeys(conf.SnapshotPath, selector.Matches)
+	if readErr != nil {
+		os.Remove(conf.SnapshotPath)
+		return nil, errors.New(fmt.Sprintf("Error reading keys from the snapshot: %s", readErr.Error()))
+	}
+
+	delErr := os.Remove(conf.SnapshotPath)
+	if delErr != nil {
+		return nil, errors.New(fmt.Sprintf("Error deleting the transient snapshot file: %s", delErr.Error()))
+	}
+
+	return keys, nil
+}
+
+func readLiveKeys(conf config.Config, selector keyspace.KeySelector) (map[string]keyspace.KeyRecord, error) {
+	cli, cliErr := connectEtcd(conf.EtcdClient)
+	if cliErr != nil {
+		return nil, errors.New(fmt.Sprintf("Error connecting to etcd: %s", cliErr.Error()))
+	}
+	defer cli.Close()
+
+	//Glob patterns can match anywhere in the key space, so the prefixes can only narrow down the read if there are no patterns
+	prefixes := []string{""}
+	if len(selector.Prefixes) > 0 && len(selector.Globs) == 0 {
+		prefixes = selector.Prefixes
+	}
+
+	records := keyspace.RecordMap{}
+	_, exportErr := keyspace.Export(cli, prefixes, records, conf.KeyExport.PageSize)
+	if exportErr != nil {
+		return nil, errors.New(fmt.Sprintf("Error reading keys from etcd: %s", exportErr.Error()))
+	}
+
+	for key := range records {
+		if !selector.Matches(key) {
+			delete(records, key)
+		}
+	}
+
+	return records, nil
+}
+
+func printDiff(diff keyspace.KeySpaceDiff, showKeys bool) {
+	for _, prefix := range diff.Prefixes {
+		fmt.Println(fmt.Sprintf("%s: %d added, %d removed, %d modified", prefix.Prefix, len(prefix.Added), len(prefix.Removed), len(prefix.Modified)))
+		if !showKeys {
+			continue
+		}
+
+		for _, key := range prefix.Added {
+			fmt.Println(fmt.Sprintf("  + %s", key))
+		}
+		for _, key := range prefix.Removed {
+			fmt.Println(fmt.Sprintf("  - %s", key))
+		}
+		for _, key := range prefix.Modified {
+			fmt.Println(fmt.Sprintf("  ~ %s", key))
+		}
+	}
+
+	fmt.Println(fmt.Sprintf(
+		"Total: %d added, %d removed, %d modified, %d unchanged",
+		diff.Summary.Added,
+		diff.Summary.Removed,
+		diff.Summary.Modified,
+		diff.Summary.Unchanged,
+	))
+}
+
+func generateDiffCmd(confPath *string, targetName *string) *cobra.Command {
+	var sourceTimestamp string
+	var destinationTimestamp string
+	var live bool
+	var selector keyspace.KeySelector
+	var groupDepth int
+	var output string
+	var showKeys bool
+
+	var diffCmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Compare the key space of two backups or of a backup and the live etcd cluster",
+		Run: func(cmd *cobra.Command, args []string) {
+			conf, confErr := getConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+
+			conf, targetErr := conf.GetTarget(*targetName)
+			AbortOnErr("Error getting target: %s", targetErr)
+
+			if live == (destinationTimestamp != "") {
+				AbortOnErr("Error validating arguments: %s", errors.New("Exactly one of the 'destination-timestamp' or 'live' arguments must be specified"))
+			}
+			if output != "text" && output != "json" {
+				AbortOnErr("Error validating arguments: %s", errors.New(fmt.Sprintf("Unsupported output '%s'", output)))
+			}
+			AbortOnErr("Error validating the key selection: %s", selector.Validate())
+
+			srcKeys, srcErr := readBackupKeys(conf, sourceTimestamp, selector)
+			AbortOnErr("Error reading the source backup: %s", srcErr)
+
+			var dstKeys map[string]keyspace.KeyRecord
+			var dstErr error
+			if live {
+				dstKeys, dstErr = readLiveKeys(conf, selector)
+				AbortOnErr("Error reading the live cluster: %s", dstErr)
+			} else {
+				dstKeys, dstErr = readBackupKeys(conf, destinationTimestamp, selector)
+				AbortOnErr("Error reading the destination backup: %s", dstErr)
+			}
+
+			diff := keyspace.Diff(srcKeys, dstKeys, groupDepth)
+
+			if output == "json" {
+				diffJson, jsonErr := json.MarshalIndent(diff, "", "  ")
+				AbortOnErr("Error serializing the diff: %s", jsonErr)
+				fmt.Println(string(diffJson))
+				return
+			}
+
+			printDiff(diff, showKeys)
+		},
+	}
+
+	diffCmd.Flags().StringVarP(&sourceTimestamp, "source-timestamp", "s", "", "Timestamp part of the backup to compare from. If empty, the latest backup will be used")
+	diffCmd.Flags().StringVarP(&destinationTimestamp, "destination-timestamp", "d", "", "Timestamp part of the backup to compare to")
+	diffCmd.Flags().BoolVarP(&live, "live", "l", false, "Compare to the live etcd cluster instead of another backup")
+	diffCmd.Flags().StringArrayVarP(&selector.Prefixes, "prefix", "p", []string{}, "Prefix of the keys to compare. Can be repeated")
+	diffCmd.Flags().StringArrayVarP(&selector.Globs, "glob", "g", []string{}, "Glob pattern of the keys to compare. Can be repeated")
+	diffCmd.Flags().IntVarP(&groupDepth, "group-depth", "r", 1, "Number of '/' separated key segments forming the prefixes the results are grouped by")
+	diffCmd.Flags().StringVarP(&output, "output", "o", "text", "Output format, either 'text' or 'json'")
+	diffCmd.Flags().BoolVarP(&showKeys, "show-keys", "k", false, "List the changed keys under each prefix in the text output")
+
+	return diffCmd
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/keyspace"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+
+	"github.com/spf13/cobra"
+)
+
+func runExport(conf config.Config, prefixes []string, format string) error {
+	if len(prefixes) == 0 {
+		prefixes = conf.KeyExport.Prefixes
+	}
+	if format == "" {
+		format = conf.KeyExport.Format
+	}
+
+	formatErr := keyspace.ValidateFormat(format)
+	if formatErr != nil {
+		return errors.New(fmt.Sprintf("Error validating the export format: %s", formatErr.Error()))
+	}
+
+	cli, cliErr := connectEtcd(conf.EtcdClient)
+	if cliErr != nil {
+		return errors.New(fmt.Sprintf("Error connecting to etcd: %s", cliErr.Error()))
+	}
+	defer cli.Close()
+
+	masterKey := []byte{}
+	if conf.EncryptionKeyPath != "" {
+		var masterKeyErr error
+		masterKey, masterKeyErr = getMasterKey(conf.EncryptionKeyPath)
+		if masterKeyErr != nil {
+			return errors.New(fmt.Sprintf("Error reading master key: %s", masterKeyErr.Error()))
+		}
+	}
+
+	//The keys are exported anew for each upload attempt, stopping the export of the previous attempt
+	var exportReader *io.PipeReader
+	var revCh chan int64
+	openExport := func() (io.Reader, []byte, error) {
+		if exportReader != nil {
+			exportReader.Close()
+		}
+
+		var exportWriter *io.PipeWriter
+		exportReader, exportWriter = io.Pipe()
+		revCh = make(chan int64, 1)
+		go func(exportWriter *io.PipeWriter, revCh chan int64) {
+			bufWriter := bufio.NewWriter(exportWriter)
+			enc, encErr := keyspace.NewEncoder(format, bufWriter)
+			if encErr != nil {
+				revCh <- 0
+				exportWriter.CloseWithError(encErr)
+				return
+			}
+
+			revision, exportErr := keyspace.Export(cli, prefixes, enc, conf.KeyExport.PageSize)
+			if exportErr == nil {
+				exportErr = bufWriter.Flush()
+			}
+			revCh <- revision
+			exportWriter.CloseWithError(exportErr)
+		}(exportWriter, revCh)
+
+		if len(masterKey) == 0 {
+			return exportReader, []byte{}, nil
+		}
+
+		encrStream, encStreamErr := encryption.NewEncryptStream(masterKey, exportReader, 1024*1024)
+		if encStreamErr != nil {
+			return nil, []byte{}, errors.New(fmt.Sprintf("Error generating an encryption stream from master key and key export: %s", encStreamErr.Error()))
+		}
+
+		encCiph, encCiphErr := encrStream.GetEncryptedCipherKey()
+		if encCiphErr != nil {
+			return nil, []byte{}, errors.New(fmt.Sprintf("Error generating an encryption key cypher: %s", encCiphErr.Error()))
+		}
+
+		return encrStream, encCiph, nil
+	}
+
+	start := time.Now()
+	backupErr := s3.Backup(openExport, -1, conf.GetKeyExportS3Client(), map[string]string{})
+	if exportReader != nil {
+		exportReader.Close()
+	}
+	if backupErr != nil {
+		return errors.New(fmt.Sprintf("Error storing key export in s3: %s", backupErr.Error()))
+	}
+
+	revision := <-revCh
+	getLogger(conf).WithFields(logger.Fields{
+		"revision":         revision,
+		"duration_seconds": time.Since(start).Seconds(),
+	}).Infof("Exported keys at revision %d", revision)
+	return nil
+}
+
+func generateExportCmd(confPath *string, targetName *string) *cobra.Command {
+	var prefixes []string
+	var format string
+
+	var exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export the keys under a set of prefixes to a logical export file in s3",
+		Run: func(cmd *cobra.Command, args []string) {
+			conf, confErr := getConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+
+			targets, targetsErr := conf.GetTargets(*targetName)
+			AbortOnErr("Error getting targets: %s", targetsErr)
+
+			runOnTargets(targets, func(target config.Config) error {
+				return runExport(target, prefixes, format)
+			})
+		},
+	}
+
+	exportCmd.Flags().StringArrayVarP(&prefixes, "prefix", "p", []string{}, "Prefix of the keys to export. Can be repeated. Defaults to the prefixes in the configuration file")
+	exportCmd.Flags().StringVarP(&format, "format", "f", "", "Format of the export file, either 'jsonl' or 'protobuf'. Defaults to the format in the configuration file")
+
+	return exportCmd
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/keyspace"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/snapshot"
+
+	"github.com/spf13/cobra"
+)
+
+func generateExtractCmd(confPath *string, targetName *string) *cobra.Command {
+	var backupTimestamp string
+	var selector keyspace.KeySelector
+	var outputPath string
+	var format string
+	var putKeys bool
+
+	var extractCmd = &cobra.Command{
+		Use:   "extract",
+		Short: "Extract individual keys from a snapshot in s3 and optionally put them back in the etcd cluster",
+		Run: func(cmd *cobra.Command, args []string) {
+			conf, confErr := getConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+
+			conf, targetErr := conf.GetTarget(*targetName)
+			AbortOnErr("Error getting target: %s", targetErr)
+
+			if format == "" {
+				format = conf.KeyExport.Format
+			}
+			AbortOnErr("Error validating the output format: %s", keyspace.ValidateFormat(format))
+			AbortOnErr("Error validating the key selection: %s", selector.Validate())
+
+			downloadErr := downloadBackup(conf, backupTimestamp, conf.SnapshotPath)
+			AbortOnErr("%s", downloadErr)
+
+			//The decrypted snapshot is deleted as soon as its keys are read, as aborting later would leave it behind
+			keys, revision, readErr := snapshot.ReadKeys(conf.SnapshotPath, selector.Matches)
+			delErr := os.Remove(conf.SnapshotPath)
+			AbortOnErr("Error reading keys from the snapshot: %s", readErr)
+			AbortOnErr("Error deleting the transient snapshot file: %s", delErr)
+
+			sortedKeys := make([]string, 0, len(keys))
+			for key := range keys {
+				sortedKeys = append(sortedKeys, key)
+			}
+			sort.Strings(sortedKeys)
+
+			var dest io.Writer = os.Stdout
+			if outputPath != "" {
+				file, fErr := os.OpenFile(outputPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+				AbortOnErr("Error creating the output file: %s", fErr)
+				defer file.Close()
+				dest = file
+			}
+
+			bufDest := bufio.NewWriter(dest)
+			enc, encErr := keyspace.NewEncoder(format, bufDest)
+			AbortOnErr("Error creating the output encoder: %s", encErr)
+			for _, key := range sortedKeys {
+				AbortOnErr("Error writing extracted keys: %s", enc.Encode(keys[key]))
+			}
+			AbortOnErr("Error writing extracted keys: %s", bufDest.Flush())
+
+			log := getLogger(conf)
+			log.WithFields(logger.Fields{"keys": len(sortedKeys), "revision": revision}).Infof("Extracted %d keys at revision %d", len(sortedKeys), revision)
+
+			if !putKeys {
+				return
+			}
+
+			cli, cliErr := connectEtcd(conf.EtcdClient)
+			AbortOnErr("Error connecting to etcd: %s", cliErr)
+			defer cli.Close()
+
+			restored := 0
+			for _, key := range sortedKeys {
+				written, putErr := keyspace.PutIfNotModifiedSince(cli, keys[key], revision)
+				AbortOnErr(fmt.Sprintf("Error putting key '%s' back in etcd: %%s", key), putErr)
+
+				if !written {
+					log.WithFields(logger.Fields{"key": key}).Warnf("Skipped key '%s' as it was modified after the snapshot's revision", key)
+					continue
+				}
+				restored += 1
+			}
+
+			log.WithFields(logger.Fields{"keys": len(sortedKeys), "restored": restored}).Infof("Put %d of %d extracted keys back in etcd", restored, len(sortedKeys))
+		},
+	}
+
+	extractCmd.Flags().StringVarP(&backupTimestamp, "backup-timestamp", "t", "", "Timestamp part of the backup to extract keys from. If empty, the latest backup will be used")
+	extractCmd.Flags().StringArrayVarP(&selector.Prefixes, "prefix", "p", []string{}, "Prefix of the keys to extract. Can be repeated")
+	extractCmd.Flags().StringArrayVarP(&selector.Globs, "glob", "g", []string{}, "Glob pattern of the keys to extract. Can be repeated")
+	extractCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Path of the file to write the extracted keys to. Defaults to the standard output")
+	extractCmd.Flags().StringVarP(&format, "format", "f", "", "Format of the extracted keys, either 'jsonl' or 'protobuf'. Defaults to the key export format in the configuration file")
+	extractCmd.Flags().BoolVarP(&putKeys, "put", "u", false, "Put the extracted keys back in the etcd cluster, skipping keys that were modified after the snapshot's revision")
+
+	return extractCmd
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+
+	"github.com/spf13/cobra"
+)
+
+func describeGarbage(garbage s3.Garbage) string {
+	description := fmt.Sprintf("%s: %s", garbage.Type, strings.Join(garbage.Objects, ", "))
+	if garbage.UploadId != "" {
+		description += fmt.Sprintf(" (upload '%s')", garbage.UploadId)
+	}
+	if !garbage.Since.IsZero() {
+		description += fmt.Sprintf(" since %s", garbage.Since.Format(time.RFC3339))
+	}
+	return description
+}
+
+/*
+Checks the dump of a backup whose manifest is missing against its recorded checksums, with its encryption key if it is encrypted
+*/
+func verifyIncomplete(conf config.Config, entry s3.BackupEntry) error {
+	metadata, metadataErr := s3.GetEntryMetadata(conf.S3Client, entry)
+	if metadataErr != nil {
+		return errors.New(fmt.Sprintf("Error getting the metadata of the backup: %s", metadataErr.Error()))
+	}
+
+	checkErr := s3.CheckEntryMetadata(entry, metadata)
+	if checkErr != nil {
+		return checkErr
+	}
+
+	_, verifyErr := verifyEntry(conf, entry)
+	return verifyErr
+}
+
+func runGc(ctx context.Context, conf config.Config, gracePeriod time.Duration, dryRun bool) error {
+	garbages, garbageErr := s3.FindGarbage(conf.S3Client)
+	if garbageErr != nil {
+		return errors.New(fmt.Sprintf("Error looking for incomplete or orphaned objects: %s", garbageErr.Error()))
+	}
+
+	unverified := 0
+	cutoff := time.Now().Add(-gracePeriod)
+	for _, garbage := range garbages {
+		description := describeGarbage(garbage)
+		log := getLogger(conf).WithFields(logger.Fields{
+			"type":    garbage.Type,
+			"objects": strings.Join(garbage.Objects, ","),
+		})
+
+		if garbage.Type == s3.GARBAGE_UNRECOGNIZED {
+			log.Warnf("Ignoring %s, which does not match the naming convention and must be inspected manually", description)
+			continue
+		}
+
+		if garbage.Since.After(cutoff) {
+			log.Infof("Keeping %s, which is within the grace period", description)
+			continue
+		}
+
+		//The dump of an incomplete backup was fully uploaded, so the backup is only missing its manifest
+		if garbage.Type == s3.GARBAGE_INCOMPLETE {
+			verifyErr := verifyIncomplete(conf, garbage.GetEntry())
+			if verifyErr != nil {
+				log.Errorf("Keeping %s, which could not be verified and must be inspected manually: %s", description, verifyErr.Error())
+				unverified += 1
+				continue
+			}
+
+			if dryRun {
+				log.Infof("Would write the manifest of %s, which matches its recorded checksums", description)
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			manifestErr := s3.WriteManifest(conf.S3Client, garbage.GetEntry())
+			if manifestErr != nil {
+				return errors.New(fmt.Sprintf("Error writing the manifest of %s: %s", description, manifestErr.Error()))
+			}
+			log.Infof("Wrote the manifest of %s, which matches its recorded checksums", description)
+			continue
+		}
+
+		if dryRun {
+			log.Infof("Would remove %s", description)
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		removeErr := s3.RemoveGarbage(conf.S3Client, garbage)
+		if removeErr != nil {
+			return errors.New(fmt.Sprintf("Error removing %s: %s", description, removeErr.Error()))
+		}
+		log.Infof("Removed %s", description)
+	}
+
+	if unverified > 0 {
+		return errors.New(fmt.Sprintf("%d incomplete backups could not be verified and were kept", unverified))
+	}
+
+	return nil
+}
+
+func generateGcCmd(confPath *string, targetName *string) *cobra.Command {
+	var gracePeriod string
+	var dryRun bool
+	var forceUnlock bool
+
+	var gcCmd = &cobra.Command{
+		Use:   "gc",
+		Short: "Remove the orphaned backup objects and abandoned uploads in s3 and complete the backups missing their manifest",
+		Run: func(cmd *cobra.Command, args []string) {
+			conf, confErr := getConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+
+			targets, targetsErr := conf.GetTargets(*targetName)
+			AbortOnErr("Error getting targets: %s", targetsErr)
+
+			//Uploads that can still be resumed by the backup command are kept by default
+			grace := conf.Backup.ResumeMaxAge
+			if cmd.Flags().Changed("grace-period") {
+				var graceErr error
+				grace, graceErr = config.ParseDuration(gracePeriod)
+				AbortOnErr("Error parsing grace-period argument: %s", graceErr)
+			}
+
+			runOnTargets(targets, func(target config.Config) error {
+				//A dry run does not remove anything, so it does not need to wait for the other commands
+				if dryRun {
+					return runGc(context.Background(), target, grace, dryRun)
+				}
+
+				return runLocked(target, "gc", forceUnlock, func(ctx context.Context) error {
+					return runGc(ctx, target, grace, dryRun)
+				})
+			})
+		},
+	}
+
+	gcCmd.Flags().StringVarP(&gracePeriod, "grace-period", "g", "", "Minimum age of the objects and uploads to remove (ex: 2d). Defaults to the maximum age of resumable uploads in the configuration file")
+	gcCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "Report the objects and uploads that would be removed without removing them")
+
+	gcCmd.Flags().BoolVar(&forceUnlock, "force-unlock", false, "Remove the lock of the targets before taking it, even if another process holds it")
+
+	return gcCmd
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/keyspace"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+
+	"github.com/spf13/cobra"
+)
+
+func generateImportCmd(confPath *string, targetName *string) *cobra.Command {
+	var backupTimestamp string
+	var filePath string
+	var prefixes []string
+	var remaps []string
+	var format string
+	var dryRun bool
+
+	var importCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Write the keys of a logical export back into the etcd cluster",
+		Run: func(cmd *cobra.Command, args []string) {
+			conf, confErr := getConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+
+			conf, targetErr := conf.GetTarget(*targetName)
+			AbortOnErr("Error getting target: %s", targetErr)
+
+			if format == "" {
+				format = conf.KeyExport.Format
+			}
+
+			prefixRemaps := []keyspace.PrefixRemap{}
+			for _, remap := range remaps {
+				prefixRemap, remapErr := keyspace.ParsePrefixRemap(remap)
+				AbortOnErr("Error parsing remap argument: %s", remapErr)
+				prefixRemaps = append(prefixRemaps, prefixRemap)
+			}
+
+			var source io.Reader
+			if filePath != "" {
+				file, fErr := os.Open(filePath)
+				AbortOnErr("Error opening the export file: %s", fErr)
+				defer file.Close()
+
+				source = file
+			} else {
+				reader, keyCypher, restoreErr := s3.Restore(conf.GetKeyExportS3Client(), backupTimestamp)
+				AbortOnErr("Error getting a key export download from s3: %s", restoreErr)
+				source = reader
+
+				if conf.EncryptionKeyPath != "" {
+					masterKey, masterKeyErr := getMasterKey(conf.EncryptionKeyPath)
+					AbortOnErr("Error reading master key: %s", masterKeyErr)
+
+					decryptStr, decryptStrErr := encryption.NewDecryptStream(masterKey, keyCypher, reader, 1024*1024)
+					AbortOnErr("Error generating a decryption stream from the s3 key export download: %s", decryptStrErr)
+					source = decryptStr
+				}
+			}
+
+			dec, decErr := keyspace.NewDecoder(format, source)
+			AbortOnErr("Error reading the key export: %s", decErr)
+
+			cli, cliErr := connectEtcd(conf.EtcdClient)
+			AbortOnErr("Error connecting to etcd: %s", cliErr)
+			defer cli.Close()
+
+			log := getLogger(conf)
+			count, importErr := keyspace.Import(cli, dec, keyspace.ImportOptions{
+				Prefixes: prefixes,
+				Remaps:   prefixRemaps,
+				DryRun:   dryRun,
+				OnImport: func(record keyspace.KeyRecord, destKey string) {
+					if dryRun {
+						log.WithFields(logger.Fields{"key": destKey, "exported_key": record.Key}).Infof("Would write key '%s' (exported as '%s')", destKey, record.Key)
+					}
+				},
+			})
+			AbortOnErr("Error importing keys: %s", importErr)
+
+			if dryRun {
+				log.WithFields(logger.Fields{"keys": count}).Infof("Dry run: %d keys would be imported", count)
+				return
+			}
+			log.WithFields(logger.Fields{"keys": count}).Infof("Imported %d keys", count)
+		},
+	}
+
+	importCmd.Flags().StringVarP(&backupTimestamp, "backup-timestamp", "t", "", "Timestamp part of the key export to import. If empty, the latest export will be imported")
+	importCmd.Flags().StringVarP(&filePath, "file", "i", "", "Path to a local unencrypted export file to import instead of downloading an export from s3")
+	importCmd.Flags().StringArrayVarP(&prefixes, "prefix", "p", []string{}, "Only import keys with the given prefix. Can be repeated. If omitted, all the keys of the export are imported")
+	importCmd.Flags().StringArrayVarP(&remaps, "remap", "r", []string{}, "Prefix remapping of the format '<source prefix>=<destination prefix>' applied to imported keys. Can be repeated")
+	importCmd.Flags().StringVarP(&format, "format", "f", "", "Format of the export file, either 'jsonl' or 'protobuf'. Defaults to the format in the configuration file")
+	importCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "Report the keys that would be written without writing them")
+
+	return importCmd
+}
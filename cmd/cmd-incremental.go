@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/keyspace"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/snapshot"
+
+	"github.com/spf13/cobra"
+)
+
+func getRevisionMetadata(metadata map[string]string, key string) (int64, bool) {
+	val, ok := metadata[key]
+	if !ok {
+		return 0, false
+	}
+
+	revision, parseErr := strconv.ParseInt(val, 10, 64)
+	if parseErr != nil {
+		return 0, false
+	}
+
+	return revision, true
+}
+
+/*
+Returns the revision following the latest change that was backed up, either in a change segment or in a full backup
+*/
+func getIncrementalStartRevision(conf config.Config) (int64, error) {
+	start := int64(0)
+
+	backups, backupsErr := s3.ListDumpEntries(conf.S3Client)
+	if backupsErr != nil {
+		return 0, backupsErr
+	}
+	if len(backups) > 0 {
+		metadata, metadataErr := s3.GetEntryMetadata(conf.S3Client, backups[len(backups)-1])
+		if metadataErr != nil {
+			return 0, metadataErr
+		}
+
+		if revision, ok := getRevisionMetadata(metadata, s3.METADATA_ETCD_REVISION); ok {
+			start = revision + 1
+		}
+	}
+
+	incS3Conf := conf.GetIncrementalS3Client()
+	segments, segmentsErr := s3.ListDumpEntries(incS3Conf)
+	if segmentsErr != nil {
+		return 0, segmentsErr
+	}
+	if len(segments) > 0 {
+		metadata, metadataErr := s3.GetEntryMetadata(incS3Conf, segments[len(segments)-1])
+		if metadataErr != nil {
+			return 0, metadataErr
+		}
+
+		if revision, ok := getRevisionMetadata(metadata, s3.METADATA_ETCD_LAST_REVISION); ok && revision+1 > start {
+			start = revision + 1
+		}
+	}
+
+	if start == 0 {
+		return 0, errors.New("No backup with a recorded revision was found. Take a backup first or specify the revision to start from")
+	}
+
+	return start, nil
+}
+
+func uploadChangeSegment(conf config.Config, masterKey []byte, changes []keyspace.ChangeRecord) error {
+	segment, segmentErr := keyspace.EncodeChangeSegment(changes)
+	if segmentErr != nil {
+		return errors.New(fmt.Sprintf("Error encoding change segment: %s", segmentErr.Error()))
+	}
+
+	metadata := map[string]string{
+		s3.METADATA_ETCD_FIRST_REVISION: strconv.FormatInt(changes[0].ModRevision, 10),
+		s3.METADATA_ETCD_LAST_REVISION:  strconv.FormatInt(changes[len(changes)-1].ModRevision, 10),
+		s3.METADATA_FIRST_CHANGE_TIME:   changes[0].Time.Format(time.RFC3339Nano),
+		s3.METADATA_LAST_CHANGE_TIME:    changes[len(changes)-1].Time.Format(time.RFC3339Nano),
+	}
+
+	size := int64(len(segment))
+	if len(masterKey) > 0 {
+		size = encryption.EncryptedSize(size, 1024*1024)
+	}
+
+	return s3.Backup(func() (io.Reader, []byte, error) {
+		if len(masterKey) == 0 {
+			return bytes.NewReader(segment), []byte{}, nil
+		}
+
+		encrStream, encStreamErr := encryption.NewEncryptStream(masterKey, bytes.NewReader(segment), 1024*1024)
+		if encStreamErr != nil {
+			return nil, []byte{}, errors.New(fmt.Sprintf("Error generating an encryption stream for change segment: %s", encStreamErr.Error()))
+		}
+
+		encCiph, encCiphErr := encrStream.GetEncryptedCipherKey()
+		if encCiphErr != nil {
+			return nil, []byte{}, errors.New(fmt.Sprintf("Error generating an encryption key cypher: %s", encCiphErr.Error()))
+		}
+
+		return encrStream, encCiph, nil
+	}, size, conf.GetIncrementalS3Client(), metadata)
+}
+
+/*
+Applies the change segments following the snapshot's revision on the snapshot file.
+Changes received after the target time and changes after the target revision are not applied if they are specified.
+*/
+func replayChanges(conf config.Config, targetRevision int64, targetTime time.Time) (int64, error) {
+	revision, revisionErr := snapshot.GetRevision(conf.SnapshotPath)
+	if revisionErr != nil {
+		return 0, errors.New(fmt.Sprintf("Error reading the revision of the snapshot file: %s", revisionErr.Error()))
+	}
+
+	incS3Conf := conf.GetIncrementalS3Client()
+	segments, segmentsErr := s3.ListDumpEntries(incS3Conf)
+	if segmentsErr != nil {
+		return revision, errors.New(fmt.Sprintf("Error listing change segments: %s", segmentsErr.Error()))
+	}
+
+	masterKey := []byte{}
+	if conf.EncryptionKeyPath != "" {
+		var masterKeyErr error
+		masterKey, masterKeyErr = getMasterKey(conf.EncryptionKeyPath)
+		if masterKeyErr != nil {
+			return revision, errors.New(fmt.Sprintf("Error reading master key: %s", masterKeyErr.Error()))
+		}
+	}
+
+	for _, segment := range segments {
+		if targetRevision > 0 && revision >= targetRevision {
+			break
+		}
+
+		metadata, metadataErr := s3.GetEntryMetadata(incS3Conf, segment)
+		if metadataErr != nil {
+			return revision, errors.New(fmt.Sprintf("Error getting the metadata of a change segment: %s", metadataErr.Error()))
+		}
+
+		if !targetTime.IsZero() {
+			firstTime, firstTimeErr := time.Parse(time.RFC3339Nano, metadata[s3.METADATA_FIRST_CHANGE_TIME])
+			if firstTimeErr != nil {
+				return revision, errors.New(fmt.Sprintf("Error reading the time of the first change of the change segment uploaded at %s: %s", segment.Timestamp.Format(time.RFC3339), firstTimeErr.Error()))
+			}
+			if firstTime.After(targetTime) {
+				break
+			}
+		}
+
+		if lastRevision, ok := getRevisionMetadata(metadata, s3.METADATA_ETCD_LAST_REVISION); ok && lastRevision <= revision {
+			continue
+		}
+		if firstRevision, ok := getRevisionMetadata(metadata, s3.METADATA_ETCD_FIRST_REVISION); ok && firstRevision > revision+1 {
+			return revision, errors.New(fmt.Sprintf("Changes between revisions %d and %d are missing from the change segments", revision+1, firstRevision-1))
+		}
+
+		reader, keyCypher, downloadErr := s3.DownloadEntry(incS3Conf, segment)
+		if downloadErr != nil {
+			return revision, errors.New(fmt.Sprintf("Error downloading a change segment: %s", downloadErr.Error()))
+		}
+
+		var source io.Reader = reader
+		if len(masterKey) > 0 {
+			decryptStr, decryptStrErr := encryption.NewDecryptStream(masterKey, keyCypher, reader, 1024*1024)
+			if decryptStrErr != nil {
+				return revision, errors.New(fmt.Sprintf("Error generating a decryption stream for a change segment: %s", decryptStrErr.Error()))
+			}
+			source = decryptStr
+		}
+
+		changes, decodeErr := keyspace.DecodeChangeSegment(source)
+		if decodeErr != nil {
+			return revision, errors.New(fmt.Sprintf("Error decoding a change segment: %s", decodeErr.Error()))
+		}
+
+		reachedTime := false
+		if !targetTime.IsZero() {
+			changes, reachedTime = keyspace.ChangesUntil(changes, targetTime)
+		}
+
+		var applyErr error
+		revision, applyErr = snapshot.ApplyChanges(conf.SnapshotPath, changes, targetRevision)
+		if applyErr != nil {
+			return revision, errors.New(fmt.Sprintf("Error applying a change segment on the snapshot: %s", applyErr.Error()))
+		}
+
+		if reachedTime {
+			break
+		}
+	}
+
+	return revision, nil
+}
+
+func generateIncrementalCmd(confPath *string, targetName *string) *cobra.Command {
+	var fromRevision int64
+
+	var incrementalCmd = &cobra.Command{
+		Use:   "incremental",
+		Short: "Continuously back up the changes of the etcd watch stream in change segments in s3",
+		Run: func(cmd *cobra.Command, args []string) {
+			conf, confErr := getConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+
+			conf, targetErr := conf.GetTarget(*targetName)
+			AbortOnErr("Error getting target: %s", targetErr)
+
+			masterKey := []byte{}
+			if conf.EncryptionKeyPath != "" {
+				var masterKeyErr error
+				masterKey, masterKeyErr = getMasterKey(conf.EncryptionKeyPath)
+				AbortOnErr("Error reading master key: %s", masterKeyErr)
+			}
+
+			if fromRevision == 0 {
+				var startErr error
+				fromRevision, startErr = getIncrementalStartRevision(conf)
+				AbortOnErr("Error determining the revision to watch from: %s", startErr)
+			}
+
+			cli, cliErr := connectEtcd(conf.EtcdClient)
+			AbortOnErr("Error connecting to etcd: %s", cliErr)
+			defer cli.Close()
+
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+			ticker := time.NewTicker(conf.Incremental.SegmentInterval)
+			defer ticker.Stop()
+
+			log := getLogger(conf)
+			log.WithFields(logger.Fields{"revision": fromRevision}).Infof("Watching changes from revision %d", fromRevision)
+			watchCh := keyspace.WatchChanges(cli, fromRevision)
+
+			namingConv, namingErr := s3.GetNamingConvention(conf.GetIncrementalS3Client())
+			AbortOnErr("Error getting the naming convention of change segments: %s", namingErr)
+
+			pending := []keyspace.ChangeRecord{}
+			lastFlush := time.Time{}
+			flush := func() {
+				if len(pending) == 0 {
+					return
+				}
+
+				//Object names of the seconds naming scheme have a resolution of one second, so segments must not be uploaded more often
+				if wait := time.Second - time.Since(lastFlush); namingConv.Scheme == s3.NAMING_SCHEME_SECONDS && wait > 0 {
+					time.Sleep(wait)
+				}
+
+				uploadErr := uploadChangeSegment(conf, masterKey, pending)
+				AbortOnErr("Error storing change segment in s3: %s", uploadErr)
+				log.WithFields(logger.Fields{"changes": len(pending)}).Debugf("Stored a change segment of %d changes", len(pending))
+
+				pending = []keyspace.ChangeRecord{}
+				lastFlush = time.Now()
+			}
+
+			for {
+				select {
+				case batch, ok := <-watchCh:
+					if !ok {
+						flush()
+						AbortOnErr("Error watching changes: %s", errors.New("Watch stream was closed"))
+					}
+					if batch.Error != nil {
+						flush()
+						AbortOnErr("Error watching changes: %s", batch.Error)
+					}
+
+					pending = append(pending, batch.Changes...)
+					if int64(len(pending)) >= conf.Incremental.MaxSegmentChanges {
+						flush()
+					}
+				case <-ticker.C:
+					flush()
+				case <-sigCh:
+					flush()
+					return
+				}
+			}
+		},
+	}
+
+	incrementalCmd.Flags().Int64VarP(&fromRevision, "from-revision", "r", 0, "Revision to start watching changes from. Defaults to the revision following the latest backed up change")
+
+	return incrementalCmd
+}
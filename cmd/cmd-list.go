@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	BACKUP_STATUS_COMPLETE   = "complete"
+	BACKUP_STATUS_LEGACY     = "legacy"
+	BACKUP_STATUS_INCOMPLETE = "incomplete"
+)
+
+type storeListing struct {
+	Backups []backupListing `json:"backups"`
+	Garbage []s3.Garbage    `json:"garbage"`
+}
+
+type backupListing struct {
+	Name      string    `json:"name"`
+	Timestamp time.Time `json:"timestamp"`
+	Status    string    `json:"status"`
+	Encrypted bool      `json:"encrypted"`
+	Size      int64     `json:"size"`
+	Revision  string    `json:"revision,omitempty"`
+	Member    string    `json:"member,omitempty"`
+}
+
+/*
+Describes a backup from its manifest or, for backups made before manifests were written, from the metadata of its dump
+*/
+func getBackupListing(conf config.Config, entry s3.BackupEntry) (backupListing, error) {
+	listing := backupListing{
+		Name:      entry.Name,
+		Timestamp: entry.Timestamp,
+		Status:    BACKUP_STATUS_INCOMPLETE,
+		Encrypted: entry.Encrypted,
+		Size:      -1,
+	}
+
+	if !entry.Complete {
+		return listing, nil
+	}
+
+	if entry.ManifestFound {
+		manifest, manifestErr := s3.GetManifest(conf.S3Client, entry)
+		if manifestErr != nil {
+			return listing, manifestErr
+		}
+
+		listing.Status = BACKUP_STATUS_COMPLETE
+		listing.Size = manifest.Dump.Size
+		listing.Revision = manifest.Metadata[s3.METADATA_ETCD_REVISION]
+		listing.Member = manifest.Metadata[s3.METADATA_ETCD_MEMBER]
+		return listing, nil
+	}
+
+	info, statErr := s3.StatEntry(conf.S3Client, entry)
+	if statErr != nil {
+		return listing, statErr
+	}
+
+	listing.Status = BACKUP_STATUS_LEGACY
+	listing.Size = info.Size
+	listing.Revision = info.UserMetadata[s3.METADATA_ETCD_REVISION]
+	listing.Member = info.UserMetadata[s3.METADATA_ETCD_MEMBER]
+	return listing, nil
+}
+
+func getBackupListings(conf config.Config, entries []s3.BackupEntry) ([]backupListing, error) {
+	listings := []backupListing{}
+	for _, entry := range entries {
+		listing, listingErr := getBackupListing(conf, entry)
+		if listingErr != nil {
+			return listings, errors.New(fmt.Sprintf("Error getting the description of backup '%s': %s", entry.GetTimestamp(), listingErr.Error()))
+		}
+		listings = append(listings, listing)
+	}
+
+	return listings, nil
+}
+
+/*
+Describes the backups of the store with the objects that do not form a complete backup
+*/
+func getStoreListing(conf config.Config) (storeListing, error) {
+	entries, entriesErr := s3.ListEntries(conf.S3Client)
+	if entriesErr != nil {
+		return storeListing{}, errors.New(fmt.Sprintf("Error listing the backups: %s", entriesErr.Error()))
+	}
+
+	listings, listingsErr := getBackupListings(conf, entries)
+	if listingsErr != nil {
+		return storeListing{}, listingsErr
+	}
+
+	garbages, garbageErr := s3.FindGarbage(conf.S3Client)
+	if garbageErr != nil {
+		return storeListing{}, errors.New(fmt.Sprintf("Error looking for incomplete or orphaned objects: %s", garbageErr.Error()))
+	}
+
+	return storeListing{Backups: listings, Garbage: garbages}, nil
+}
+
+func runList(conf config.Config, output string) error {
+	store, storeErr := getStoreListing(conf)
+	if storeErr != nil {
+		return storeErr
+	}
+	listings := store.Backups
+	garbages := store.Garbage
+
+	if output == "json" {
+		listingsJson, jsonErr := json.MarshalIndent(store, "", "  ")
+		if jsonErr != nil {
+			return errors.New(fmt.Sprintf("Error serializing the backups: %s", jsonErr.Error()))
+		}
+		fmt.Println(string(listingsJson))
+		return nil
+	}
+
+	for _, listing := range listings {
+		line := fmt.Sprintf("%s  %-10s  encrypted=%t", listing.Timestamp.Format(time.RFC3339Nano), listing.Status, listing.Encrypted)
+		if listing.Size >= 0 {
+			line += fmt.Sprintf("  size=%d", listing.Size)
+		}
+		if listing.Revision != "" {
+			line += fmt.Sprintf("  revision=%s", listing.Revision)
+		}
+		fmt.Println(line)
+	}
+
+	if len(garbages) > 0 {
+		fmt.Println(fmt.Sprintf("%d incomplete, orphaned or unrecognized objects or uploads:", len(garbages)))
+		for _, garbage := range garbages {
+			fmt.Println(fmt.Sprintf("  %s", describeGarbage(garbage)))
+		}
+	}
+
+	return nil
+}
+
+func generateListCmd(confPath *string, targetName *string) *cobra.Command {
+	var output string
+
+	var listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the backups in s3 with their completion status",
+		Run: func(cmd *cobra.Command, args []string) {
+			if output != "text" && output != "json" {
+				AbortOnErr("Error validating arguments: %s", errors.New(fmt.Sprintf("Unsupported output '%s'", output)))
+			}
+
+			conf, confErr := getConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+
+			targets, targetsErr := conf.GetTargets(*targetName)
+			AbortOnErr("Error getting targets: %s", targetsErr)
+
+			runOnTargets(targets, func(target config.Config) error {
+				return runList(target, output)
+			})
+		},
+	}
+
+	listCmd.Flags().StringVarP(&output, "output", "o", "text", "Output format, either 'text' or 'json'")
+
+	return listCmd
+}
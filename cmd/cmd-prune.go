@@ -1,35 +1,79 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/notify"
 	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
 
 	"github.com/spf13/cobra"
 )
 
-func generatePruneCmd(confPath *string) *cobra.Command {
+func runPrune(ctx context.Context, conf config.Config, maxAge string, minCount int64) error {
+	expiry, expiryErr := config.ParseDuration(maxAge)
+	if expiryErr != nil {
+		return errors.New(fmt.Sprintf("Error parsing max-age argument: %s", expiryErr.Error()))
+	}
+
+	start := time.Now()
+	pruneErr := s3.Prune(ctx, conf.S3Client, expiry, minCount)
+	if pruneErr != nil {
+		return errors.New(fmt.Sprintf("Error pruning backups: %s", pruneErr.Error()))
+	}
+
+	getLogger(conf).WithFields(logger.Fields{
+		"max_age":          maxAge,
+		"min_count":        minCount,
+		"duration_seconds": time.Since(start).Seconds(),
+	}).Infof("Pruned the backups older than %s", maxAge)
+
+	return nil
+}
+
+func generatePruneCmd(confPath *string, targetName *string) *cobra.Command {
 	var maxAge string
 	var minCount int64
+	var forceUnlock bool
 
 	var pruneCmd = &cobra.Command{
 		Use:   "prune",
 		Short: "Prune older backups in S3",
 		Run: func(cmd *cobra.Command, args []string) {
-			conf, confErr := config.GetConfig(*confPath)
+			conf, confErr := getConfig(*confPath)
 			AbortOnErr("Error getting configurations: %s", confErr)
 
-			expiry, expiryErr := time.ParseDuration(maxAge)
-			AbortOnErr("Error parsing max-age argument: %s", expiryErr)
+			targets, targetsErr := conf.GetTargets(*targetName)
+			AbortOnErr("Error getting targets: %s", targetsErr)
+
+			runOnTargets(targets, func(target config.Config) error {
+				targetMaxAge := target.Retention.MaxAge
+				if cmd.Flags().Changed("max-age") {
+					targetMaxAge = maxAge
+				}
 
-			pruneErr := s3.Prune(conf.S3Client, expiry, minCount)
-			AbortOnErr("Error pruning backups: %s", pruneErr)
+				targetMinCount := target.Retention.MinCount
+				if cmd.Flags().Changed("min-count") {
+					targetMinCount = minCount
+				}
+
+				return runNotified(target, "prune", func(event *notify.Event) error {
+					return runLocked(target, "prune", forceUnlock, func(ctx context.Context) error {
+						return runPrune(ctx, target, targetMaxAge, targetMinCount)
+					})
+				})
+			})
 		},
 	}
 
-	pruneCmd.Flags().StringVarP(&maxAge, "max-age", "a", "15d", "Max age after which backups should be deleted")
-	pruneCmd.Flags().Int64VarP(&minCount, "min-count", "i", 20, "Minimum number of backups to keep, regardless of the maximum age")
+	pruneCmd.Flags().StringVarP(&maxAge, "max-age", "a", "15d", "Max age after which backups should be deleted. Overrides the retention in the configuration file")
+	pruneCmd.Flags().Int64VarP(&minCount, "min-count", "i", 20, "Minimum number of backups to keep, regardless of the maximum age. Overrides the retention in the configuration file")
+
+	pruneCmd.Flags().BoolVar(&forceUnlock, "force-unlock", false, "Remove the lock of the targets before taking it, even if another process holds it")
 
 	return pruneCmd
 }
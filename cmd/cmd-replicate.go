@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+
+	"github.com/spf13/cobra"
+)
+
+func runReplicate(ctx context.Context, conf config.Config, destination string) error {
+	replicas, replicasErr := conf.GetReplicas(destination)
+	if replicasErr != nil {
+		return replicasErr
+	}
+
+	if len(replicas) == 0 {
+		return errors.New("No replicas are defined in the configuration")
+	}
+
+	for _, replica := range replicas {
+		expiry := time.Duration(0)
+		if replica.Retention.MaxAge != "" {
+			var expiryErr error
+			expiry, expiryErr = config.ParseDuration(replica.Retention.MaxAge)
+			if expiryErr != nil {
+				return errors.New(fmt.Sprintf("Error parsing the max age of replica '%s': %s", replica.Name, expiryErr.Error()))
+			}
+		}
+
+		start := time.Now()
+		result, replicateErr := s3.Replicate(ctx, conf.S3Client, replica.S3Client, expiry, replica.Retention.MinCount)
+		if replicateErr != nil {
+			return errors.New(fmt.Sprintf("Error replicating backups to replica '%s': %s", replica.Name, replicateErr.Error()))
+		}
+
+		getLogger(conf).WithFields(logger.Fields{
+			"replica":          replica.Name,
+			"copied":           len(result.Copied),
+			"skipped":          len(result.Skipped),
+			"duration_seconds": time.Since(start).Seconds(),
+		}).Infof("Replica '%s': %d objects copied, %d objects already up to date", replica.Name, len(result.Copied), len(result.Skipped))
+	}
+
+	return nil
+}
+
+func generateReplicateCmd(confPath *string, targetName *string) *cobra.Command {
+	var destination string
+	var uploadRateLimit string
+	var forceUnlock bool
+
+	var replicateCmd = &cobra.Command{
+		Use:   "replicate",
+		Short: "Copy the backups to the secondary s3 stores",
+		Run: func(cmd *cobra.Command, args []string) {
+			conf, confErr := getConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+
+			targets, targetsErr := conf.GetTargets(*targetName)
+			AbortOnErr("Error getting targets: %s", targetsErr)
+
+			runOnTargets(targets, func(target config.Config) error {
+				if cmd.Flags().Changed("upload-rate-limit") {
+					target = withUploadRateLimit(target, uploadRateLimit)
+				}
+
+				return runLocked(target, "replicate", forceUnlock, func(ctx context.Context) error {
+					return runReplicate(ctx, target, destination)
+				})
+			})
+		},
+	}
+
+	replicateCmd.Flags().StringVarP(&destination, "destination", "d", "", "Name of the replica to copy the backups to. If omitted, the backups are copied to all the replicas")
+
+	replicateCmd.Flags().StringVar(&uploadRateLimit, "upload-rate-limit", "", "Maximum rate of the uploads to the replicas, in bytes per second (ex: 20MiB). Overrides the rate limits in the configuration file")
+
+	replicateCmd.Flags().BoolVar(&forceUnlock, "force-unlock", false, "Remove the lock of the targets before taking it, even if another process holds it")
+
+	return replicateCmd
+}
@@ -1,19 +1,21 @@
 package cmd
 
 import (
-	"encoding/hex"
-	"io"
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"time"
 
-	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
-	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/hooks"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
 	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
 
 	"github.com/spf13/cobra"
 )
 
-func generateRestoreCmd(confPath *string) *cobra.Command {
+func generateRestoreCmd(confPath *string, targetName *string) *cobra.Command {
 	var backupTimestamp string
 	var dataDir string
 	var etcdutlPath string
@@ -22,77 +24,97 @@ func generateRestoreCmd(confPath *string) *cobra.Command {
 	var etcdutlInitialAdvertisePeerUrls string
 	var etcdutlName string
 	var UseEtcdutl bool
+	var replay bool
+	var targetRevision int64
+	var targetTime string
+	var downloadRateLimit string
+	var forceUnlock bool
 
 	var restoreCmd = &cobra.Command{
 		Use:   "restore",
 		Short: "Restore a snapshot in s3 to the local filesystem",
 		Run: func(cmd *cobra.Command, args []string) {
-			conf, confErr := config.GetConfig(*confPath)
+			conf, confErr := getConfig(*confPath)
 			AbortOnErr("Error getting configurations: %s", confErr)
 
-			func() {
-				if conf.EncryptionKeyPath != "" {
-					masterKeyHex, readErr := os.ReadFile(conf.EncryptionKeyPath)
-					AbortOnErr("Error opening master key file: %s", readErr)
-		
-					masterKey := make([]byte, hex.DecodedLen(len(masterKeyHex)))
-					_, convErr := hex.Decode(masterKey, masterKeyHex)
-					AbortOnErr("Error decoding master hex format: %s", convErr)
-				
-					reader, keyCypher, restoreErr := s3.Restore(conf.S3Client, backupTimestamp)
-					AbortOnErr("Error getting a snapshot download from s3: %s", restoreErr)
-	
-					decryptStr, decryptStrErr := encryption.NewDecryptStream(
-						masterKey,
-						keyCypher,
-						reader,
-						1024*1024,
-					)
-					AbortOnErr("Error generating a decryption stream from the s3 snapshot download: %s", decryptStrErr)
-	
-					file, fErr := os.OpenFile(conf.SnapshotPath, os.O_RDWR|os.O_CREATE, 0600)
-					AbortOnErr("Error creating a snapshot file: %s", fErr)
-	
-					defer file.Close()
-					_, cpyErr := io.Copy(file, decryptStr)
-					AbortOnErr("Error copying the descryption stream into the snapshot file: %s", cpyErr)
-	
-					return
-				}
-	
-				reader, _, restoreErr := s3.Restore(conf.S3Client, backupTimestamp)
-				AbortOnErr("Error getting a snapshot download from s3: %s", restoreErr)
-	
-				file, fErr := os.OpenFile(conf.SnapshotPath, os.O_RDWR|os.O_CREATE, 0600)
-				AbortOnErr("Error creating a snapshot file: %s", fErr)
-	
-				defer file.Close()
-				_, cpyErr := io.Copy(file, reader)
-				AbortOnErr("Error copying the snaphot download into the snapshot file: %s", cpyErr)
-			}()
-
-			if UseEtcdutl {
-				defer func() {
-					delErr := os.Remove(conf.SnapshotPath)
-					AbortOnErr("Error deleting the transient snapshot file: %s", delErr)
-				}()
-
-				restoreCmd := exec.Command(
-					etcdutlPath,
-					"snapshot",
-					"restore",
-					conf.SnapshotPath,
-					"--data-dir", dataDir,
-					"--name", etcdutlName,
-					"--initial-cluster", etcdutlInitinalCluster,
-					"--initial-cluster-token", etcdutlInitialClusterToken,
-					"--initial-advertise-peer-urls", etcdutlInitialAdvertisePeerUrls,
-				)
-				restoreCmd.Stdout = os.Stdout
-				restoreCmd.Stderr = os.Stderr
-				cmdErr := restoreCmd.Run()
-				AbortOnErr("Error running command to unpack snapshot with etcdutl: %s", cmdErr)
+			conf, targetErr := conf.GetTarget(*targetName)
+			AbortOnErr("Error getting target: %s", targetErr)
+
+			if cmd.Flags().Changed("download-rate-limit") {
+				conf.S3Client.RateLimit.Download = downloadRateLimit
 			}
+
+			var targetTimeVal time.Time
+			if targetTime != "" {
+				var parseErr error
+				targetTimeVal, parseErr = time.Parse(time.RFC3339, targetTime)
+				AbortOnErr("Error parsing target-time argument: %s", parseErr)
+			}
+
+			AbortOnErr("%s", runLocked(conf, "restore", forceUnlock, func(ctx context.Context) error {
+				entry, entryErr := s3.FindEntry(conf.S3Client, backupTimestamp)
+				if entryErr != nil {
+					return errors.New(fmt.Sprintf("Error finding the backup to restore: %s", entryErr.Error()))
+				}
+
+				hookVars := getEntryHookVars(entry)
+				hookVars["DATA_DIR"] = dataDir
+				hooksErr := runHooks(conf, hooks.PRE_RESTORE, conf.Hooks.PreRestore, hookVars)
+				if hooksErr != nil {
+					return hooksErr
+				}
+
+				downloadErr := downloadBackupEntry(conf, entry, conf.SnapshotPath)
+				if downloadErr != nil {
+					return downloadErr
+				}
+
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				if replay {
+					revision, replayErr := replayChanges(conf, targetRevision, targetTimeVal)
+					if replayErr != nil {
+						return errors.New(fmt.Sprintf("Error replaying change segments: %s", replayErr.Error()))
+					}
+					getLogger(conf).WithFields(logger.Fields{"revision": revision}).Infof("Replayed change segments up to revision %d", revision)
+				}
+
+				if UseEtcdutl {
+					defer func() {
+						delErr := os.Remove(conf.SnapshotPath)
+						if delErr != nil {
+							getLogger(conf).Errorf("Error deleting the transient snapshot file: %s", delErr.Error())
+						}
+					}()
+
+					etcdutlArgs := []string{
+						"snapshot",
+						"restore",
+						conf.SnapshotPath,
+						"--data-dir", dataDir,
+						"--name", etcdutlName,
+						"--initial-cluster", etcdutlInitinalCluster,
+						"--initial-cluster-token", etcdutlInitialClusterToken,
+						"--initial-advertise-peer-urls", etcdutlInitialAdvertisePeerUrls,
+					}
+					if replay {
+						//The integrity hash of the snapshot no longer matches once changes are replayed on it
+						etcdutlArgs = append(etcdutlArgs, "--skip-hash-check")
+					}
+
+					restoreCmd := exec.CommandContext(ctx, etcdutlPath, etcdutlArgs...)
+					restoreCmd.Stdout = os.Stdout
+					restoreCmd.Stderr = os.Stderr
+					cmdErr := restoreCmd.Run()
+					if cmdErr != nil {
+						return errors.New(fmt.Sprintf("Error running command to unpack snapshot with etcdutl: %s", cmdErr.Error()))
+					}
+				}
+
+				return runHooks(conf, hooks.POST_RESTORE, conf.Hooks.PostRestore, hookVars)
+			}))
 		},
 	}
 
@@ -105,5 +127,11 @@ func generateRestoreCmd(confPath *string) *cobra.Command {
 	restoreCmd.Flags().StringVarP(&etcdutlName, "name", "n", "default", "Value of the '--name' argument passed when unpacking the snapshot with etcdutl")
 	restoreCmd.Flags().BoolVarP(&UseEtcdutl, "use-etcdutl", "u", true, "Whether to use etcdutl to unpack the snapshot in the directory specified by the '--data-dir' argument. If true, the snapshot will be deleted after unpacking.")
 
+	restoreCmd.Flags().BoolVarP(&replay, "replay-changes", "r", false, "Replay the change segments of incremental backups on top of the snapshot")
+	restoreCmd.Flags().Int64VarP(&targetRevision, "target-revision", "v", 0, "When replaying change segments, revision to stop at. If omitted, all the changes are replayed")
+	restoreCmd.Flags().StringVar(&downloadRateLimit, "download-rate-limit", "", "Maximum rate of the download of the snapshot, in bytes per second (ex: 50MiB). Overrides the rate limit in the configuration file")
+	restoreCmd.Flags().BoolVar(&forceUnlock, "force-unlock", false, "Remove the lock of the target before taking it, even if another process holds it")
+	restoreCmd.Flags().StringVarP(&targetTime, "target-time", "m", "", "When replaying change segments, time in RFC3339 format after which changes are not replayed. If omitted, all the changes are replayed")
+
 	return restoreCmd
 }
@@ -1,24 +1,43 @@
 package cmd
 
 import (
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+
 	"github.com/spf13/cobra"
 )
 
 func generateRootCmd() *cobra.Command {
 	var confPath string
+	var targetName string
 
 	var rootCmd = &cobra.Command{
 		Use:   "etcd-backup",
 		Short: "Manages etcd backups and restore in an s3 store",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			cmdLogger = cmdLogger.WithFields(logger.Fields{"command": cmd.Name()})
+		},
 	}
 
-	rootCmd.PersistentFlags().StringVarP(&confPath, "config", "c", "config.yml", "Path to a yaml configuration file")
+	rootCmd.PersistentFlags().StringVarP(&confPath, "config", "c", "config.yml", "Path to a yaml configuration file. If empty, the configuration is only taken from the environment")
 	rootCmd.MarkPersistentFlagFilename("config")
+	rootCmd.PersistentFlags().StringVar(&targetName, "target", "", "Name of the backup target to operate on. If omitted, commands that support it operate on all the targets")
 
-	rootCmd.AddCommand(generateBackupCmd(&confPath))
-	rootCmd.AddCommand(generateRestoreCmd(&confPath))
-	rootCmd.AddCommand(generatePruneCmd(&confPath))
-	rootCmd.AddCommand(generateRotateKeyCmd(&confPath))
+	rootCmd.AddCommand(generateBackupCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateRestoreCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generatePruneCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateRotateKeyCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateExportCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateImportCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateExtractCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateDiffCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateIncrementalCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateReplicateCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateTransferCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateVerifyCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateListCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateGcCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateServeCmd(&confPath, &targetName))
+	rootCmd.AddCommand(generateConfigCmd(&confPath, &targetName))
 
 	return rootCmd
 }
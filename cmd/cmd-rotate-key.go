@@ -1,61 +1,83 @@
 package cmd
 
 import (
-	"encoding/hex"
-	"os"
+	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
 	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/notify"
 	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
 
 	"github.com/spf13/cobra"
 )
 
-func generateRotateKeyCmd(confPath *string) *cobra.Command {
+func runRotateKey(ctx context.Context, conf config.Config, prevKeyPath string) error {
+	masterKey, masterKeyErr := getMasterKey(conf.EncryptionKeyPath)
+	if masterKeyErr != nil {
+		return errors.New(fmt.Sprintf("Error reading new master key: %s", masterKeyErr.Error()))
+	}
+
+	prevMasterKey, prevMasterKeyErr := getMasterKey(prevKeyPath)
+	if prevMasterKeyErr != nil {
+		return errors.New(fmt.Sprintf("Error reading previous master key: %s", prevMasterKeyErr.Error()))
+	}
+
+	start := time.Now()
+	rotateErr := s3.RotateKey(ctx, conf.S3Client, func(keyCypher []byte) ([]byte, error) {
+		keyPlaintext, decErr := encryption.DecryptBytes(keyCypher, prevMasterKey)
+		if decErr != nil {
+			//Try with new master key in case it was already switched
+			_, decNewKeyErr := encryption.DecryptBytes(keyCypher, masterKey)
+			if decNewKeyErr != nil {
+				return []byte{}, decErr
+			}
+
+			//Key was already switched, probably in a previous rotation that didn't complete 
+			return keyCypher, nil
+		}
+
+		return encryption.EncryptBytes(keyPlaintext, masterKey)
+	})
+	if rotateErr != nil {
+		return errors.New(fmt.Sprintf("Error rotating key: %s", rotateErr.Error()))
+	}
+
+	getLogger(conf).WithFields(logger.Fields{"duration_seconds": time.Since(start).Seconds()}).Infof("Rotated the master key of the backups")
+
+	return nil
+}
+
+func generateRotateKeyCmd(confPath *string, targetName *string) *cobra.Command {
 	var prevKeyPath string
+	var forceUnlock bool
 
 	var rotateKeyCmd = &cobra.Command{
 		Use:   "rotate-key",
 		Short: "Rotate the master key used to encrypt the encryption keys in S3",
 		Run: func(cmd *cobra.Command, args []string) {
-			conf, confErr := config.GetConfig(*confPath)
+			conf, confErr := getConfig(*confPath)
 			AbortOnErr("Error getting configurations: %s", confErr)
 
-			masterKeyHex, readErr := os.ReadFile(conf.EncryptionKeyPath)
-			AbortOnErr("Error opening new master key file: %s", readErr)
-
-			masterKey := make([]byte, hex.DecodedLen(len(masterKeyHex)))
-			_, convErr := hex.Decode(masterKey, masterKeyHex)
-			AbortOnErr("Error decoding new master key hex format: %s", convErr)
-
-			prevMasterKeyHex, prevReadErr := os.ReadFile(prevKeyPath)
-			AbortOnErr("Error opening previous master key file: %s", prevReadErr)
-
-			prevMasterKey := make([]byte, hex.DecodedLen(len(prevMasterKeyHex)))
-			_, prevConvErr := hex.Decode(prevMasterKey, prevMasterKeyHex)
-			AbortOnErr("Error decoding previous master key hex format: %s", prevConvErr)
-
-			rotateErr := s3.RotateKey(conf.S3Client, func(keyCypher []byte) ([]byte, error) {
-				keyPlaintext, decErr := encryption.DecryptBytes(keyCypher, prevMasterKey)
-				if decErr != nil {
-					//Try with new master key in case it was already switched
-					_, decNewKeyErr := encryption.DecryptBytes(keyCypher, masterKey)
-					if decNewKeyErr != nil {
-						return []byte{}, decErr
-					}
-
-					//Key was already switched, probably in a previous rotation that didn't complete 
-					return keyCypher, nil
-				}
+			targets, targetsErr := conf.GetTargets(*targetName)
+			AbortOnErr("Error getting targets: %s", targetsErr)
 
-				return encryption.EncryptBytes(keyPlaintext, masterKey)
+			runOnTargets(targets, func(target config.Config) error {
+				return runNotified(target, "rotate-key", func(event *notify.Event) error {
+					return runLocked(target, "rotate-key", forceUnlock, func(ctx context.Context) error {
+						return runRotateKey(ctx, target, prevKeyPath)
+					})
+				})
 			})
-			AbortOnErr("Error rotating key: %s", rotateErr)
 		},
 	}
 
 	rotateKeyCmd.Flags().StringVarP(&prevKeyPath, "previous-key", "p", "", "Path to the previous master key currently encrypting the backup keys")
 	rotateKeyCmd.MarkFlagRequired("previous-key")
+	rotateKeyCmd.Flags().BoolVar(&forceUnlock, "force-unlock", false, "Remove the lock of the targets before taking it, even if another process holds it")
 
 	return rotateKeyCmd
 }
@@ -0,0 +1,363 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/jobs"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/notify"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+
+	"github.com/spf13/cobra"
+)
+
+type apiServer struct {
+	conf  config.Config
+	queue *jobs.Queue
+	token []byte
+}
+
+func writeJson(w http.ResponseWriter, status int, val interface{}) {
+	body, jsonErr := json.MarshalIndent(val, "", "  ")
+	if jsonErr != nil {
+		status = http.StatusInternalServerError
+		body = []byte(fmt.Sprintf("{\"error\": %q}", jsonErr.Error()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
+
+/*
+Checks the bearer token of the requests if a token is configured. Client certificates are checked by the tls handshake.
+*/
+func (srv *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(srv.token) > 0 {
+			header := r.Header.Get("Authorization")
+			token := []byte(strings.TrimPrefix(header, "Bearer "))
+			if !strings.HasPrefix(header, "Bearer ") || subtle.ConstantTimeCompare(token, srv.token) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("Missing or invalid bearer token"))
+				return
+			}
+		}
+
+		cmdLogger.WithFields(logger.Fields{"method": r.Method, "path": r.URL.Path}).Debugf("Handling request")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (srv *apiServer) getTarget(w http.ResponseWriter, r *http.Request) (config.Config, bool) {
+	target, targetErr := srv.conf.GetTarget(r.PathValue("target"))
+	if targetErr != nil {
+		writeError(w, http.StatusNotFound, targetErr)
+		return target, false
+	}
+
+	return target, true
+}
+
+func (srv *apiServer) submit(w http.ResponseWriter, command string, target config.Config, run jobs.JobFn) {
+	job, submitErr := srv.queue.Submit(command, target.TargetName, run)
+	if submitErr != nil {
+		writeError(w, http.StatusServiceUnavailable, submitErr)
+		return
+	}
+
+	getLogger(target).WithFields(logger.Fields{"job": job.Id}).Infof("Queued %s job %s", command, job.Id)
+	w.Header().Set("Location", fmt.Sprintf("/v1/jobs/%s", job.Id))
+	writeJson(w, http.StatusAccepted, job)
+}
+
+/*
+Returns a job running a command whose outcome is notified, with the event of its outcome as result
+*/
+func getNotifiedJob(target config.Config, command string, operation func(event *notify.Event) error) jobs.JobFn {
+	return func() (interface{}, error) {
+		var event *notify.Event
+		runErr := runNotified(target, command, func(ev *notify.Event) error {
+			event = ev
+			return operation(ev)
+		})
+		return event, runErr
+	}
+}
+
+func (srv *apiServer) listTargets(w http.ResponseWriter, r *http.Request) {
+	targets, targetsErr := srv.conf.GetTargets("")
+	if targetsErr != nil {
+		writeError(w, http.StatusInternalServerError, targetsErr)
+		return
+	}
+
+	names := []string{}
+	for _, target := range targets {
+		names = append(names, target.TargetName)
+	}
+
+	writeJson(w, http.StatusOK, names)
+}
+
+func (srv *apiServer) listBackups(w http.ResponseWriter, r *http.Request) {
+	target, ok := srv.getTarget(w, r)
+	if !ok {
+		return
+	}
+
+	store, storeErr := getStoreListing(target)
+	if storeErr != nil {
+		writeError(w, http.StatusInternalServerError, storeErr)
+		return
+	}
+
+	writeJson(w, http.StatusOK, store)
+}
+
+func (srv *apiServer) triggerBackup(w http.ResponseWriter, r *http.Request) {
+	target, ok := srv.getTarget(w, r)
+	if !ok {
+		return
+	}
+
+	srv.submit(w, "backup", target, getNotifiedJob(target, "backup", func(event *notify.Event) error {
+		return runLocked(target, "backup", false, func(ctx context.Context) error {
+			return runBackup(ctx, target, event)
+		})
+	}))
+}
+
+func (srv *apiServer) triggerVerify(w http.ResponseWriter, r *http.Request) {
+	target, ok := srv.getTarget(w, r)
+	if !ok {
+		return
+	}
+
+	backupTimestamp := r.URL.Query().Get("backup-timestamp")
+	all := false
+	if r.URL.Query().Has("all") {
+		var parseErr error
+		all, parseErr = strconv.ParseBool(r.URL.Query().Get("all"))
+		if parseErr != nil {
+			writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("Invalid value for the all parameter: %s", parseErr.Error())))
+			return
+		}
+	}
+
+	srv.submit(w, "verify", target, getNotifiedJob(target, "verify", func(event *notify.Event) error {
+		return runVerify(target, backupTimestamp, all, event)
+	}))
+}
+
+func (srv *apiServer) triggerPruneDryRun(w http.ResponseWriter, r *http.Request) {
+	target, ok := srv.getTarget(w, r)
+	if !ok {
+		return
+	}
+
+	maxAge := target.Retention.MaxAge
+	if r.URL.Query().Has("max-age") {
+		maxAge = r.URL.Query().Get("max-age")
+	}
+
+	expiry, expiryErr := config.ParseDuration(maxAge)
+	if expiryErr != nil {
+		writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("Invalid value for the max-age parameter: %s", expiryErr.Error())))
+		return
+	}
+
+	minCount := target.Retention.MinCount
+	if r.URL.Query().Has("min-count") {
+		var parseErr error
+		minCount, parseErr = strconv.ParseInt(r.URL.Query().Get("min-count"), 10, 64)
+		if parseErr != nil {
+			writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("Invalid value for the min-count parameter: %s", parseErr.Error())))
+			return
+		}
+	}
+
+	srv.submit(w, "prune-dry-run", target, func() (interface{}, error) {
+		entries, entriesErr := s3.GetPrunable(target.S3Client, expiry, minCount)
+		if entriesErr != nil {
+			return nil, errors.New(fmt.Sprintf("Error listing the backups to prune: %s", entriesErr.Error()))
+		}
+
+		return getBackupListings(target, entries)
+	})
+}
+
+func (srv *apiServer) listJobs(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, srv.queue.List())
+}
+
+func (srv *apiServer) getJob(w http.ResponseWriter, r *http.Request) {
+	job, found := srv.queue.Get(r.PathValue("id"))
+	if !found {
+		writeError(w, http.StatusNotFound, errors.New(fmt.Sprintf("Job '%s' not found", r.PathValue("id"))))
+		return
+	}
+
+	writeJson(w, http.StatusOK, job)
+}
+
+func (srv *apiServer) getHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/targets", srv.listTargets)
+	mux.HandleFunc("GET /v1/targets/{target}/backups", srv.listBackups)
+	mux.HandleFunc("POST /v1/targets/{target}/backups", srv.triggerBackup)
+	mux.HandleFunc("POST /v1/targets/{target}/verify", srv.triggerVerify)
+	mux.HandleFunc("POST /v1/targets/{target}/prune-dry-run", srv.triggerPruneDryRun)
+	mux.HandleFunc("GET /v1/jobs", srv.listJobs)
+	mux.HandleFunc("GET /v1/jobs/{id}", srv.getJob)
+	return srv.authenticate(mux)
+}
+
+/*
+Returns the tls configuration of the server, which requires client certificates signed by the client CA if one is configured
+*/
+func getServerTlsConfig(tlsConf config.ServerTlsConfig) (*tls.Config, error) {
+	if tlsConf.Certificate == "" {
+		if tlsConf.ClientCaCert != "" {
+			return nil, errors.New("A server certificate is required to authenticate clients with certificates")
+		}
+
+		return nil, nil
+	}
+
+	cert, certErr := tls.LoadX509KeyPair(tlsConf.Certificate, tlsConf.Key)
+	if certErr != nil {
+		return nil, errors.New(fmt.Sprintf("Error loading the server certificate: %s", certErr.Error()))
+	}
+
+	serverTls := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if tlsConf.ClientCaCert != "" {
+		caCert, caErr := os.ReadFile(tlsConf.ClientCaCert)
+		if caErr != nil {
+			return nil, errors.New(fmt.Sprintf("Error reading the client CA certificate: %s", caErr.Error()))
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("Error parsing the client CA certificate")
+		}
+
+		serverTls.ClientCAs = pool
+		serverTls.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return serverTls, nil
+}
+
+func runServe(conf config.Config) error {
+	serverTls, tlsErr := getServerTlsConfig(conf.Server.Tls)
+	if tlsErr != nil {
+		return tlsErr
+	}
+
+	token := []byte{}
+	if conf.Server.TokenPath != "" {
+		tokenContent, tokenErr := os.ReadFile(conf.Server.TokenPath)
+		if tokenErr != nil {
+			return errors.New(fmt.Sprintf("Error reading the token file: %s", tokenErr.Error()))
+		}
+
+		token = []byte(strings.TrimSpace(string(tokenContent)))
+		if len(token) == 0 {
+			return errors.New("The token file is empty")
+		}
+	}
+
+	if len(token) == 0 && conf.Server.Tls.ClientCaCert == "" {
+		return errors.New("The server requires a client CA certificate or a token to authenticate its clients")
+	}
+
+	if len(token) > 0 && serverTls == nil {
+		cmdLogger.Warnf("The server does not use tls, its token is sent in clear text")
+	}
+
+	srv := &apiServer{
+		conf:  conf,
+		queue: jobs.NewQueue(conf.Server.MaxPending, conf.Server.MaxHistory),
+		token: token,
+	}
+
+	server := &http.Server{
+		Addr:              conf.Server.Address,
+		Handler:           srv.getHandler(),
+		TLSConfig:         serverTls,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErrCh := make(chan error, 1)
+	go func() {
+		cmdLogger.WithFields(logger.Fields{"address": conf.Server.Address}).Infof("Listening on %s", conf.Server.Address)
+		if serverTls != nil {
+			serveErrCh <- server.ListenAndServeTLS("", "")
+		} else {
+			serveErrCh <- server.ListenAndServe()
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case serveErr := <-serveErrCh:
+		srv.queue.Close()
+		return errors.New(fmt.Sprintf("Error serving requests: %s", serveErr.Error()))
+	case <-sigCh:
+	}
+
+	//The job in progress is completed so that no backup is left half done, the queued jobs are cancelled
+	cmdLogger.Infof("Shutting down, cancelling the queued jobs and waiting for the running job to complete")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	shutdownErr := server.Shutdown(ctx)
+	srv.queue.Close()
+	return shutdownErr
+}
+
+func generateServeCmd(confPath *string, targetName *string) *cobra.Command {
+	var address string
+
+	var serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve an http api to list the backups and run backups, verifications and prune dry runs",
+		Run: func(cmd *cobra.Command, args []string) {
+			conf, confErr := getConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+
+			if cmd.Flags().Changed("address") {
+				conf.Server.Address = address
+			}
+
+			AbortOnErr("%s", runServe(conf))
+		},
+	}
+
+	serveCmd.Flags().StringVarP(&address, "address", "a", "", "Address to listen on (ex: :8443). Overrides the address in the configuration file")
+
+	return serveCmd
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	srv := &apiServer{token: []byte("secret")}
+	handler := srv.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		header string
+		status int
+	}{
+		{"Bearer secret", http.StatusOK},
+		{"secret", http.StatusUnauthorized},
+		{"Basic secret", http.StatusUnauthorized},
+		{"Bearer other", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/backups", nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("Expected the authorization header '%s' to get a %d status. Got %d", test.header, test.status, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+
+	"github.com/spf13/cobra"
+)
+
+type transferOptions struct {
+	Destination     string
+	BackupTimestamp string
+	SourceKeyPath   string
+	ReEncrypt       bool
+}
+
+/*
+Returns the size of a backup once it is converted for the destination by convertBackup
+*/
+func getConvertedSize(size int64, encrypted bool, dstMasterKey []byte, reEncrypt bool) int64 {
+	if len(dstMasterKey) == 0 || (encrypted && (!reEncrypt)) {
+		return size
+	}
+
+	plaintextSize := size
+	if encrypted {
+		plaintextSize = encryption.DecryptedSize(size, 1024*1024)
+	}
+
+	return encryption.EncryptedSize(plaintextSize, 1024*1024)
+}
+
+/*
+Returns the dump to store in the destination with its size and its encrypted cipher key.
+The cipher key is re-wrapped with the destination's master key unless a full re-encryption is requested,
+in which case the dump is decrypted and encrypted again with a fresh cipher key.
+*/
+func convertBackup(dump io.Reader, size int64, keyCypher []byte, srcMasterKey []byte, dstMasterKey []byte, reEncrypt bool) (io.Reader, int64, []byte, error) {
+	if len(dstMasterKey) == 0 {
+		if len(keyCypher) > 0 {
+			return nil, 0, []byte{}, errors.New("The backup is encrypted and the destination has no master key. Backups are never stored decrypted")
+		}
+
+		return dump, size, []byte{}, nil
+	}
+
+	if len(keyCypher) > 0 && (!reEncrypt) {
+		keyPlaintext, decErr := encryption.DecryptBytes(keyCypher, srcMasterKey)
+		if decErr != nil {
+			return nil, 0, []byte{}, errors.New(fmt.Sprintf("Error decrypting the encryption key with the source master key: %s", decErr.Error()))
+		}
+
+		newKeyCypher, encErr := encryption.EncryptBytes(keyPlaintext, dstMasterKey)
+		if encErr != nil {
+			return nil, 0, []byte{}, errors.New(fmt.Sprintf("Error encrypting the encryption key with the destination master key: %s", encErr.Error()))
+		}
+
+		return dump, size, newKeyCypher, nil
+	}
+
+	source := dump
+	if len(keyCypher) > 0 {
+		decryptStr, decryptStrErr := encryption.NewDecryptStream(srcMasterKey, keyCypher, dump, 1024*1024)
+		if decryptStrErr != nil {
+			return nil, 0, []byte{}, errors.New(fmt.Sprintf("Error generating a decryption stream from the source backup: %s", decryptStrErr.Error()))
+		}
+		source = decryptStr
+	}
+
+	encrStream, encStreamErr := encryption.NewEncryptStream(dstMasterKey, source, 1024*1024)
+	if encStreamErr != nil {
+		return nil, 0, []byte{}, errors.New(fmt.Sprintf("Error generating an encryption stream with the destination master key: %s", encStreamErr.Error()))
+	}
+
+	encCiph, encCiphErr := encrStream.GetEncryptedCipherKey()
+	if encCiphErr != nil {
+		return nil, 0, []byte{}, errors.New(fmt.Sprintf("Error generating an encryption key cypher: %s", encCiphErr.Error()))
+	}
+
+	return encrStream, getConvertedSize(size, len(keyCypher) > 0, dstMasterKey, reEncrypt), encCiph, nil
+}
+
+func runTransfer(ctx context.Context, conf config.Config, opts transferOptions) error {
+	replicas, replicasErr := conf.GetReplicas(opts.Destination)
+	if replicasErr != nil {
+		return replicasErr
+	}
+	replica := replicas[0]
+
+	srcMasterKey := []byte{}
+	if opts.SourceKeyPath != "" {
+		var srcMasterKeyErr error
+		srcMasterKey, srcMasterKeyErr = getMasterKey(opts.SourceKeyPath)
+		if srcMasterKeyErr != nil {
+			return errors.New(fmt.Sprintf("Error reading source master key: %s", srcMasterKeyErr.Error()))
+		}
+	}
+
+	dstMasterKey := []byte{}
+	if replica.EncryptionKeyPath != "" {
+		var dstMasterKeyErr error
+		dstMasterKey, dstMasterKeyErr = getMasterKey(replica.EncryptionKeyPath)
+		if dstMasterKeyErr != nil {
+			return errors.New(fmt.Sprintf("Error reading destination master key: %s", dstMasterKeyErr.Error()))
+		}
+	}
+
+	entries, entriesErr := s3.ListDumpEntries(conf.S3Client)
+	if entriesErr != nil {
+		return errors.New(fmt.Sprintf("Error listing the source backups: %s", entriesErr.Error()))
+	}
+
+	if opts.BackupTimestamp != "" {
+		timestamp, parseErr := time.Parse(time.RFC3339, opts.BackupTimestamp)
+		if parseErr != nil {
+			return errors.New(fmt.Sprintf("Error parsing backup timestamp: %s", parseErr.Error()))
+		}
+
+		selected := []s3.BackupEntry{}
+		for _, entry := range entries {
+			if entry.Timestamp.Equal(timestamp) {
+				selected = append(selected, entry)
+			}
+		}
+
+		if len(selected) == 0 {
+			return errors.New(fmt.Sprintf("No backup with timestamp '%s' to transfer", opts.BackupTimestamp))
+		}
+		entries = selected
+	}
+
+	dstEntries, dstEntriesErr := s3.ListDumpEntries(replica.S3Client)
+	if dstEntriesErr != nil {
+		return errors.New(fmt.Sprintf("Error listing the destination backups: %s", dstEntriesErr.Error()))
+	}
+
+	existing := map[string]bool{}
+	for _, entry := range dstEntries {
+		existing[entry.Name] = true
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		timestamp := entry.GetTimestamp()
+		log := getLogger(conf).WithFields(logger.Fields{"replica": replica.Name, "object": entry.GetObjectName("dump")})
+		if existing[entry.Name] {
+			log.Infof("Skipping backup '%s' which is already in the destination", timestamp)
+			continue
+		}
+
+		if entry.Encrypted && len(srcMasterKey) == 0 {
+			return errors.New(fmt.Sprintf("Backup '%s' is encrypted and no source master key was provided", timestamp))
+		}
+
+		start := time.Now()
+		info, statErr := s3.StatEntry(conf.S3Client, entry)
+		if statErr != nil {
+			return errors.New(fmt.Sprintf("Error getting the metadata of backup '%s': %s", timestamp, statErr.Error()))
+		}
+
+		//The checksum of the object no longer holds if its content is encrypted anew, but the checksum of the snapshot does
+		metadata := map[string]string{}
+		for key, val := range info.UserMetadata {
+			metadata[key] = val
+		}
+		if len(dstMasterKey) > 0 && (!entry.Encrypted || opts.ReEncrypt) {
+			delete(metadata, s3.METADATA_OBJECT_SHA256)
+		}
+
+		//The backup is downloaded and converted anew for each upload attempt
+		size := getConvertedSize(info.Size, entry.Encrypted, dstMasterKey, opts.ReEncrypt)
+		openBackup := func() (io.Reader, []byte, error) {
+			dump, keyCypher, downloadErr := s3.DownloadEntry(conf.S3Client, entry)
+			if downloadErr != nil {
+				return nil, []byte{}, errors.New(fmt.Sprintf("Error getting a download of backup '%s': %s", timestamp, downloadErr.Error()))
+			}
+
+			source, _, newKeyCypher, convErr := convertBackup(dump, info.Size, keyCypher, srcMasterKey, dstMasterKey, opts.ReEncrypt)
+			if convErr != nil {
+				return nil, []byte{}, errors.New(fmt.Sprintf("Error converting backup '%s': %s", timestamp, convErr.Error()))
+			}
+
+			return source, newKeyCypher, nil
+		}
+
+		storeErr := s3.StoreEntry(openBackup, size, replica.S3Client, entry, metadata)
+		if storeErr != nil {
+			return errors.New(fmt.Sprintf("Error storing backup '%s' in the destination: %s", timestamp, storeErr.Error()))
+		}
+
+		log.WithFields(logger.Fields{
+			"bytes":            size,
+			"duration_seconds": time.Since(start).Seconds(),
+		}).Infof("Transferred backup '%s'", timestamp)
+	}
+
+	return nil
+}
+
+func generateTransferCmd(confPath *string, targetName *string) *cobra.Command {
+	var opts transferOptions
+	var forceUnlock bool
+
+	var transferCmd = &cobra.Command{
+		Use:   "transfer",
+		Short: "Copy backups to another s3 store, encrypting them with the master key of the destination",
+		Run: func(cmd *cobra.Command, args []string) {
+			conf, confErr := getConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+
+			targets, targetsErr := conf.GetTargets(*targetName)
+			AbortOnErr("Error getting targets: %s", targetsErr)
+
+			runOnTargets(targets, func(target config.Config) error {
+				targetOpts := opts
+				if !cmd.Flags().Changed("source-key") {
+					targetOpts.SourceKeyPath = target.EncryptionKeyPath
+				}
+
+				return runLocked(target, "transfer", forceUnlock, func(ctx context.Context) error {
+					return runTransfer(ctx, target, targetOpts)
+				})
+			})
+		},
+	}
+
+	transferCmd.Flags().StringVarP(&opts.Destination, "destination", "d", "", "Name of the replica to transfer the backups to")
+	transferCmd.MarkFlagRequired("destination")
+	transferCmd.Flags().StringVarP(&opts.BackupTimestamp, "backup-timestamp", "t", "", "Timestamp of the backup to transfer. If omitted, all the backups are transferred")
+	transferCmd.Flags().StringVarP(&opts.SourceKeyPath, "source-key", "s", "", "Path to the master key encrypting the source backups. Defaults to the master key of the target")
+	transferCmd.Flags().BoolVarP(&opts.ReEncrypt, "re-encrypt", "r", false, "Decrypt the backups and encrypt them again with a fresh encryption key instead of only re-encrypting their encryption key")
+
+	transferCmd.Flags().BoolVar(&forceUnlock, "force-unlock", false, "Remove the lock of the targets before taking it, even if another process holds it")
+
+	return transferCmd
+}
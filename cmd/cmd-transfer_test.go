@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+)
+
+func TestConvertBackup(t *testing.T) {
+	srcMasterKey, srcMasterKeyErr := encryption.GenerateRandomKey()
+	dstMasterKey, dstMasterKeyErr := encryption.GenerateRandomKey()
+	if srcMasterKeyErr != nil || dstMasterKeyErr != nil {
+		t.Errorf("Error generating master keys: %v, %v", srcMasterKeyErr, dstMasterKeyErr)
+		return
+	}
+
+	//The backup spans several encryption chunks, the last one being partial
+	plaintext := bytes.Repeat([]byte("etcd"), 1024*1024*5/8)
+
+	encrStream, encrStreamErr := encryption.NewEncryptStream(srcMasterKey, bytes.NewReader(plaintext), 1024*1024)
+	if encrStreamErr != nil {
+		t.Errorf("Error generating encryption stream: %s", encrStreamErr.Error())
+		return
+	}
+
+	srcKeyCypher, srcKeyCypherErr := encrStream.GetEncryptedCipherKey()
+	if srcKeyCypherErr != nil {
+		t.Errorf("Error getting the encrypted cipher key: %s", srcKeyCypherErr.Error())
+		return
+	}
+
+	encrypted, readErr := io.ReadAll(encrStream)
+	if readErr != nil {
+		t.Errorf("Error reading encryption stream: %s", readErr.Error())
+		return
+	}
+
+	tests := []struct {
+		name      string
+		encrypted bool
+		dstKey    bool
+		reEncrypt bool
+		failure   bool
+	}{
+		{"plaintext to plaintext", false, false, false, false},
+		{"encrypted to plaintext", true, false, false, true},
+		{"plaintext encryption", false, true, false, false},
+		{"key re-wrap", true, true, false, false},
+		{"re-encryption", true, true, true, false},
+		{"plaintext re-encryption", false, true, true, false},
+	}
+
+	for _, test := range tests {
+		dump := plaintext
+		keyCypher := []byte{}
+		if test.encrypted {
+			dump = encrypted
+			keyCypher = srcKeyCypher
+		}
+
+		masterKey := []byte{}
+		if test.dstKey {
+			masterKey = dstMasterKey
+		}
+
+		expectedSize := getConvertedSize(int64(len(dump)), test.encrypted, masterKey, test.reEncrypt)
+		source, size, newKeyCypher, convErr := convertBackup(bytes.NewReader(dump), int64(len(dump)), keyCypher, srcMasterKey, masterKey, test.reEncrypt)
+		if test.failure {
+			if convErr == nil {
+				t.Errorf("%s: Expected the conversion to fail", test.name)
+			}
+			continue
+		}
+		if convErr != nil {
+			t.Errorf("%s: Error converting backup: %s", test.name, convErr.Error())
+			continue
+		}
+
+		converted, convReadErr := io.ReadAll(source)
+		if convReadErr != nil {
+			t.Errorf("%s: Error reading converted backup: %s", test.name, convReadErr.Error())
+			continue
+		}
+
+		if size != expectedSize || int64(len(converted)) != expectedSize {
+			t.Errorf("%s: Expected a converted size of %d bytes. Got %d bytes reported and %d bytes read", test.name, expectedSize, size, len(converted))
+		}
+
+		//Only the encryption key is converted when it is re-wrapped
+		if test.encrypted && (!test.reEncrypt) && !bytes.Equal(converted, encrypted) {
+			t.Errorf("%s: Expected the dump to be kept as it is", test.name)
+		}
+
+		if !test.dstKey {
+			if len(newKeyCypher) > 0 || !bytes.Equal(converted, plaintext) {
+				t.Errorf("%s: Expected the backup to be kept in plaintext", test.name)
+			}
+			continue
+		}
+
+		decryptStr, decryptStrErr := encryption.NewDecryptStream(dstMasterKey, newKeyCypher, bytes.NewReader(converted), 1024*1024)
+		if decryptStrErr != nil {
+			t.Errorf("%s: Error decrypting the converted backup with the destination master key: %s", test.name, decryptStrErr.Error())
+			continue
+		}
+
+		decrypted, decryptErr := io.ReadAll(decryptStr)
+		if decryptErr != nil || !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("%s: Expected the converted backup to decrypt to the original snapshot with the destination master key. Got %d bytes, %v", test.name, len(decrypted), decryptErr)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/notify"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+
+	"github.com/spf13/cobra"
+)
+
+/*
+Downloads a backup and compares the checksums of the object and, if the backup can be decrypted, of the snapshot with the recorded ones.
+Returns whether the backup had checksums to compare with.
+*/
+func verifyEntry(conf config.Config, entry s3.BackupEntry) (bool, error) {
+	info, statErr := s3.StatEntry(conf.S3Client, entry)
+	if statErr != nil {
+		return false, errors.New(fmt.Sprintf("Error getting the metadata of the backup: %s", statErr.Error()))
+	}
+
+	expectedObjectSum, hasObjectSum := info.UserMetadata[s3.METADATA_OBJECT_SHA256]
+	expectedSnapshotSum, hasSnapshotSum := info.UserMetadata[s3.METADATA_SNAPSHOT_SHA256]
+	if entry.Encrypted && conf.EncryptionKeyPath == "" {
+		hasSnapshotSum = false
+	}
+	if (!hasObjectSum) && (!hasSnapshotSum) {
+		return false, nil
+	}
+
+	reader, keyCypher, downloadErr := s3.DownloadEntry(conf.S3Client, entry)
+	if downloadErr != nil {
+		return true, errors.New(fmt.Sprintf("Error getting a download of the backup: %s", downloadErr.Error()))
+	}
+
+	objectHash := sha256.New()
+	snapshotHash := sha256.New()
+	source := io.TeeReader(reader, objectHash)
+	if entry.Encrypted && hasSnapshotSum {
+		masterKey, masterKeyErr := getMasterKey(conf.EncryptionKeyPath)
+		if masterKeyErr != nil {
+			return true, errors.New(fmt.Sprintf("Error reading master key: %s", masterKeyErr.Error()))
+		}
+
+		decryptStr, decryptStrErr := encryption.NewDecryptStream(masterKey, keyCypher, source, 1024*1024)
+		if decryptStrErr != nil {
+			return true, errors.New(fmt.Sprintf("Error generating a decryption stream from the backup download: %s", decryptStrErr.Error()))
+		}
+		source = decryptStr
+	}
+
+	_, cpyErr := io.Copy(snapshotHash, source)
+	if cpyErr != nil {
+		return true, errors.New(fmt.Sprintf("Error reading the backup: %s", cpyErr.Error()))
+	}
+
+	if hasObjectSum && hex.EncodeToString(objectHash.Sum(nil)) != expectedObjectSum {
+		return true, errors.New(fmt.Sprintf("Checksum of the object does not match the recorded checksum '%s'", expectedObjectSum))
+	}
+
+	if hasSnapshotSum && hex.EncodeToString(snapshotHash.Sum(nil)) != expectedSnapshotSum {
+		return true, errors.New(fmt.Sprintf("Checksum of the snapshot does not match the recorded checksum '%s'", expectedSnapshotSum))
+	}
+
+	return true, nil
+}
+
+func runVerify(conf config.Config, backupTimestamp string, all bool, event *notify.Event) error {
+	entries := []s3.BackupEntry{}
+	if all {
+		var entriesErr error
+		entries, entriesErr = s3.ListDumpEntries(conf.S3Client)
+		if entriesErr != nil {
+			return notify.WithStage("listing", errors.New(fmt.Sprintf("Error listing the backups: %s", entriesErr.Error())))
+		}
+	} else {
+		entry, entryErr := s3.FindEntry(conf.S3Client, backupTimestamp)
+		if entryErr != nil {
+			return notify.WithStage("listing", errors.New(fmt.Sprintf("Error finding the backup to verify: %s", entryErr.Error())))
+		}
+		entries = append(entries, entry)
+		event.Backup = entry.GetTimestamp()
+	}
+
+	mismatches := 0
+	for _, entry := range entries {
+		timestamp := entry.GetTimestamp()
+		start := time.Now()
+
+		checked, verifyErr := verifyEntry(conf, entry)
+		log := getLogger(conf).WithFields(logger.Fields{
+			"object":           entry.GetObjectName("dump"),
+			"duration_seconds": time.Since(start).Seconds(),
+		})
+		if verifyErr != nil {
+			log.WithFields(logger.Fields{"status": "mismatch"}).Errorf("Backup '%s': MISMATCH (%s)", timestamp, verifyErr.Error())
+			mismatches += 1
+			continue
+		}
+
+		if !checked {
+			log.WithFields(logger.Fields{"status": "unchecked"}).Warnf("Backup '%s': no recorded checksum", timestamp)
+			continue
+		}
+
+		log.WithFields(logger.Fields{"status": "ok"}).Infof("Backup '%s': OK", timestamp)
+	}
+
+	if mismatches > 0 {
+		return notify.WithStage("verification", errors.New(fmt.Sprintf("%d of %d backups failed verification", mismatches, len(entries))))
+	}
+
+	return nil
+}
+
+func generateVerifyCmd(confPath *string, targetName *string) *cobra.Command {
+	var backupTimestamp string
+	var all bool
+	var downloadRateLimit string
+
+	var verifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Download backups from s3 and check them against their recorded checksums",
+		Run: func(cmd *cobra.Command, args []string) {
+			conf, confErr := getConfig(*confPath)
+			AbortOnErr("Error getting configurations: %s", confErr)
+
+			targets, targetsErr := conf.GetTargets(*targetName)
+			AbortOnErr("Error getting targets: %s", targetsErr)
+
+			runOnTargets(targets, func(target config.Config) error {
+				if cmd.Flags().Changed("download-rate-limit") {
+					target.S3Client.RateLimit.Download = downloadRateLimit
+				}
+
+				return runNotified(target, "verify", func(event *notify.Event) error {
+					return runVerify(target, backupTimestamp, all, event)
+				})
+			})
+		},
+	}
+
+	verifyCmd.Flags().StringVarP(&backupTimestamp, "backup-timestamp", "t", "", "Timestamp of the backup to verify. If omitted, the latest backup is verified")
+	verifyCmd.Flags().BoolVarP(&all, "all", "a", false, "Verify all the backups")
+	verifyCmd.Flags().StringVar(&downloadRateLimit, "download-rate-limit", "", "Maximum rate of the download of the backups, in bytes per second (ex: 50MiB). Overrides the rate limit in the configuration file")
+
+	return verifyCmd
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/hooks"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/notify"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+)
+
+/*
+Returns the environment variables describing a backup to its hooks
+*/
+func getEntryHookVars(entry s3.BackupEntry) map[string]string {
+	vars := map[string]string{
+		"TIMESTAMP":       entry.GetTimestamp(),
+		"DUMP_OBJECT":     entry.GetObjectName("dump"),
+		"MANIFEST_OBJECT": entry.GetObjectName("manifest"),
+	}
+
+	if entry.Encrypted {
+		vars["KEY_OBJECT"] = entry.GetObjectName("key")
+	}
+
+	return vars
+}
+
+/*
+Runs the hooks of the given step of a command with the environment variables describing the step.
+The failures of the hooks that only warn are logged.
+*/
+func runHooks(conf config.Config, name string, hookConfs []config.HookConfig, vars map[string]string) error {
+	env := map[string]string{
+		"NAME":          name,
+		"TARGET":        conf.TargetName,
+		"SNAPSHOT_PATH": conf.SnapshotPath,
+	}
+	for key, val := range vars {
+		env[key] = val
+	}
+
+	log := getLogger(conf).WithFields(logger.Fields{"hook": name})
+	hooksErr := hooks.Run(hookConfs, hooks.GetEnv(env), func(hook config.HookConfig, err error) {
+		log.Warnf("%s", err.Error())
+	})
+	if hooksErr != nil {
+		return notify.WithStage(name, errors.New(fmt.Sprintf("Error running the %s hooks: %s", name, hooksErr.Error())))
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/lock"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/notify"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+)
+
+/*
+Returns the backend of the lock of the target with a function closing its connection
+*/
+func getLockBackend(conf config.Config) (lock.Backend, func(), error) {
+	switch conf.Lock.Backend {
+	case lock.LOCK_BACKEND_S3:
+		backend, backendErr := s3.NewLockBackend(conf.S3Client)
+		return backend, func() {}, backendErr
+	case lock.LOCK_BACKEND_ETCD:
+		cli, connErr := connectEtcd(conf.EtcdClient)
+		if connErr != nil {
+			return nil, nil, connErr
+		}
+		return lock.NewEtcdBackend(cli, conf.Lock.EtcdKey, conf.Lock.Ttl), cli.Close, nil
+	}
+
+	return nil, nil, lock.ValidateBackend(conf.Lock.Backend)
+}
+
+/*
+Runs the operation of a command while holding the lock of the target, if a lock backend is configured.
+If forceUnlock is set, the lock is first removed regardless of the process holding it.
+The context of the operation is cancelled if the lock is lost, the operation must then stop making changes.
+*/
+func runLocked(conf config.Config, command string, forceUnlock bool, operation func(ctx context.Context) error) error {
+	log := getLogger(conf).WithFields(logger.Fields{"lock_backend": conf.Lock.Backend})
+	if conf.Lock.Backend == lock.LOCK_BACKEND_NONE {
+		if forceUnlock {
+			log.Warnf("No lock backend is configured, there is no lock to remove")
+		}
+		return operation(context.Background())
+	}
+
+	backend, closeBackend, backendErr := getLockBackend(conf)
+	if backendErr != nil {
+		return notify.WithStage("lock", errors.New(fmt.Sprintf("Error connecting to the lock backend: %s", backendErr.Error())))
+	}
+	defer closeBackend()
+
+	if forceUnlock {
+		holder, found, unlockErr := backend.ForceUnlock()
+		if unlockErr != nil {
+			return notify.WithStage("lock", errors.New(fmt.Sprintf("Error removing the lock: %s", unlockErr.Error())))
+		}
+
+		if found {
+			log.Warnf("Removed the lock held by %s", holder.String())
+		}
+	}
+
+	locked := false
+	runErr := lock.Run(backend, conf.Lock, command, func(holder lock.Holder) {
+		log.Infof("Waiting for the lock held by %s", holder.String())
+	}, func(err error) {
+		log.Warnf("%s", err.Error())
+	}, func(ctx context.Context) error {
+		locked = true
+		log.Debugf("Acquired the lock")
+		return operation(ctx)
+	})
+	if runErr != nil && (!locked) {
+		return notify.WithStage("lock", errors.New(fmt.Sprintf("Error acquiring the lock: %s", runErr.Error())))
+	}
+
+	var lostErr *lock.LostError
+	if errors.As(runErr, &lostErr) {
+		return notify.WithStage("lock", runErr)
+	}
+
+	return runErr
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/notify"
+)
+
+/*
+Runs the operation of a command on a target and notifies the notifiers of the configuration of its outcome.
+The operation can describe the backup it operated on in the event. Failing to notify does not fail the operation.
+*/
+func runNotified(conf config.Config, command string, operation func(event *notify.Event) error) error {
+	event := notify.Event{
+		Command:   command,
+		Target:    conf.TargetName,
+		Status:    notify.STATUS_SUCCESS,
+		Timestamp: time.Now(),
+		Size:      -1,
+	}
+
+	opErr := operation(&event)
+	event.DurationSeconds = time.Since(event.Timestamp).Seconds()
+	if opErr != nil {
+		event.Status = notify.STATUS_FAILURE
+		event.Stage = notify.GetStage(opErr, command)
+		event.Error = opErr.Error()
+	}
+
+	for name, notifyErr := range notify.Notify(conf.Notifiers, event) {
+		getLogger(conf).WithFields(logger.Fields{"notifier": name}).Warnf("Failed to notify '%s' of the outcome of the command: %s", name, notifyErr.Error())
+	}
+
+	return opErr
+}
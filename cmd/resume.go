@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+)
+
+//State of an interrupted backup upload, kept beside the snapshot file so that the next backup can resume it
+type uploadState struct {
+	//Targets can share the snapshot file, so the state records where the backup was being uploaded
+	Target          string            `json:"target"`
+	Endpoint        string            `json:"endpoint"`
+	Bucket          string            `json:"bucket"`
+	ObjectsPrefix   string            `json:"objects_prefix"`
+	Name            string            `json:"name"`
+	Timestamp       time.Time         `json:"timestamp"`
+	UploadId        string            `json:"upload_id"`
+	SnapshotSize    int64             `json:"snapshot_size"`
+	SnapshotModTime time.Time         `json:"snapshot_mod_time"`
+	PartSize        int64             `json:"part_size"`
+	CypherKey       []byte            `json:"cypher_key"`
+	NonceBase       []byte            `json:"nonce_base"`
+	Metadata        map[string]string `json:"metadata"`
+}
+
+//State of an interrupted download, kept beside the partially written file so that the next download can resume it
+type downloadState struct {
+	Name      string    `json:"name"`
+	Timestamp time.Time `json:"timestamp"`
+	ETag      string    `json:"etag"`
+}
+
+/*
+Returns whether the upload is the one of a backup of the target of the configuration, in its s3 store
+*/
+func (state *uploadState) belongsTo(conf config.Config) bool {
+	return state.Target == conf.TargetName && state.Endpoint == conf.S3Client.Endpoint && state.Bucket == conf.S3Client.Bucket && state.ObjectsPrefix == conf.S3Client.ObjectsPrefix
+}
+
+func (state *uploadState) getEntry() s3.BackupEntry {
+	return s3.BackupEntry{Name: state.Name, Timestamp: state.Timestamp, Encrypted: len(state.CypherKey) > 0}
+}
+
+/*
+Reads a state file into the given state. Returns false if the file does not exist.
+*/
+func loadState(path string, state interface{}) (bool, error) {
+	content, readErr := os.ReadFile(path)
+	if readErr != nil {
+		if errors.Is(readErr, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, readErr
+	}
+
+	return true, json.Unmarshal(content, state)
+}
+
+func saveState(path string, state interface{}) error {
+	content, marshalErr := json.Marshal(state)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	//The state is written to a temporary file first so that an interruption never leaves a truncated state
+	wrErr := os.WriteFile(path+".tmp", content, 0600)
+	if wrErr != nil {
+		return wrErr
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func removeState(path string) error {
+	rmErr := os.Remove(path)
+	if rmErr != nil && (!errors.Is(rmErr, os.ErrNotExist)) {
+		return rmErr
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+)
+
+/*
+Runs the operation on each target in turn. A failure on one target does not prevent the operation from running on the others.
+The process exits with an error code once all targets are processed if the operation failed on any of them.
+*/
+func runOnTargets(targets []config.Config, operation func(conf config.Config) error) {
+	if len(targets) == 1 {
+		AbortOnErr("%s", operation(targets[0]))
+		return
+	}
+
+	failures := 0
+	for _, target := range targets {
+		opErr := operation(target)
+		if opErr != nil {
+			getLogger(target).Errorf("Target '%s' failed: %s", target.TargetName, opErr.Error())
+			failures += 1
+			continue
+		}
+
+		getLogger(target).Infof("Target '%s' succeeded", target.TargetName)
+	}
+
+	if failures > 0 {
+		cmdLogger.WithFields(logger.Fields{"failures": failures, "targets": len(targets)}).Errorf("Operation failed on %d of %d targets", failures, len(targets))
+		os.Exit(1)
+	}
+}
@@ -1,13 +1,216 @@
 package cmd
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+
+	"github.com/Ferlab-Ste-Justine/etcd-sdk/client"
 )
 
+//Logger of the running command, with the level and format of the configuration once it is loaded
+var cmdLogger = logger.Logger{LogLevel: logger.INFO, Format: logger.FORMAT_TEXT, Fields: logger.Fields{}}
+
 func AbortOnErr(tmpl string, err error) {
 	if err != nil {
-		fmt.Println(fmt.Sprintf(tmpl, err.Error()))
+		cmdLogger.Errorf(tmpl, err.Error())
 		os.Exit(1)
 	}
 }
+
+/*
+Loads the configuration and applies its logging parameters to the logger of the command
+*/
+func getConfig(confPath string) (config.Config, error) {
+	conf, confErr := config.GetConfig(confPath)
+	if confErr != nil {
+		return conf, confErr
+	}
+
+	cmdLogger = conf.GetLogger().WithFields(cmdLogger.Fields)
+	return conf, nil
+}
+
+/*
+Returns the logger of the command for operations on the given target
+*/
+func getLogger(conf config.Config) logger.Logger {
+	if conf.TargetName == "" {
+		return cmdLogger
+	}
+
+	return cmdLogger.WithFields(logger.Fields{"target": conf.TargetName})
+}
+
+func getMasterKey(path string) ([]byte, error) {
+	masterKeyHex, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	masterKey := make([]byte, hex.DecodedLen(len(masterKeyHex)))
+	_, convErr := hex.Decode(masterKey, masterKeyHex)
+	return masterKey, convErr
+}
+
+func connectEtcd(etcdConf config.EtcdClientConfig) (*client.EtcdClient, error) {
+	return client.Connect(context.Background(), client.EtcdClientOptions{
+		ClientCertPath:    etcdConf.Auth.ClientCert,
+		ClientKeyPath:     etcdConf.Auth.ClientKey,
+		CaCertPath:        etcdConf.Auth.CaCert,
+		Username:          etcdConf.Auth.Username,
+		Password:          etcdConf.Auth.Password,
+		EtcdEndpoints:     etcdConf.Endpoints,
+		ConnectionTimeout: etcdConf.ConnectionTimeout,
+		RequestTimeout:    etcdConf.RequestTimeout,
+		Retries:           etcdConf.Retries,
+	})
+}
+
+/*
+Returns the configuration with the given upload rate limit applied to the s3 store and to the replicas
+*/
+func withUploadRateLimit(conf config.Config, limit string) config.Config {
+	conf.S3Client.RateLimit.Upload = limit
+
+	replicas := make([]config.ReplicaConfig, len(conf.Replicas))
+	copy(replicas, conf.Replicas)
+	for idx := range replicas {
+		replicas[idx].S3Client.RateLimit.Upload = limit
+	}
+	conf.Replicas = replicas
+
+	return conf
+}
+
+/*
+Downloads the backup with the given timestamp (or the latest if empty) and writes its decrypted content at the given path.
+If a previous download of the same backup was interrupted, it is resumed from the last complete encryption chunk written in the file.
+The downloaded file is checked against the checksum recorded with the backup and removed if it does not match.
+*/
+func downloadBackup(conf config.Config, backupTimestamp string, path string) error {
+	entry, entryErr := s3.FindEntry(conf.S3Client, backupTimestamp)
+	if entryErr != nil {
+		return errors.New(fmt.Sprintf("Error getting a snapshot download from s3: %s", entryErr.Error()))
+	}
+
+	return downloadBackupEntry(conf, entry, path)
+}
+
+/*
+Returns the offset in the file at which to resume a download that wrote the given size, with the matching offset in the object.
+Encrypted downloads are resumed after the last complete chunk, as encryption chunks can only be decrypted whole.
+*/
+func getDownloadOffsets(writtenSize int64, encrypted bool, chunkSize int64) (int64, int64) {
+	if !encrypted {
+		return writtenSize, writtenSize
+	}
+
+	chunks := writtenSize / chunkSize
+	return chunks * chunkSize, chunks * (chunkSize + encryption.ChunkOverhead)
+}
+
+/*
+Downloads the given backup at the given path, like downloadBackup
+*/
+func downloadBackupEntry(conf config.Config, entry s3.BackupEntry, path string) error {
+	info, statErr := s3.StatEntry(conf.S3Client, entry)
+	if statErr != nil {
+		return errors.New(fmt.Sprintf("Error getting a snapshot download from s3: %s", statErr.Error()))
+	}
+
+	log := getLogger(conf).WithFields(logger.Fields{"object": entry.GetObjectName("dump"), "path": path})
+	statePath := path + ".download"
+	state := downloadState{Name: entry.Name, Timestamp: entry.Timestamp, ETag: info.ETag}
+
+	var prevState downloadState
+	found, loadErr := loadState(statePath, &prevState)
+	if loadErr != nil {
+		return errors.New(fmt.Sprintf("Error reading the state of the previous download: %s", loadErr.Error()))
+	}
+
+	offset := int64(0)
+	objectOffset := int64(0)
+	if found && prevState.Name == state.Name && prevState.ETag == state.ETag {
+		partialInfo, partialErr := os.Stat(path)
+		if partialErr == nil {
+			offset, objectOffset = getDownloadOffsets(partialInfo.Size(), conf.EncryptionKeyPath != "", 1024*1024)
+			log.WithFields(logger.Fields{"offset": offset}).Infof("Resuming the interrupted download of the snapshot at %d bytes", offset)
+		}
+	}
+
+	saveErr := saveState(statePath, state)
+	if saveErr != nil {
+		return errors.New(fmt.Sprintf("Error saving the state of the download: %s", saveErr.Error()))
+	}
+
+	file, fErr := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if fErr != nil {
+		return errors.New(fmt.Sprintf("Error creating a snapshot file: %s", fErr.Error()))
+	}
+	defer file.Close()
+
+	truncErr := file.Truncate(offset)
+	if truncErr != nil {
+		return errors.New(fmt.Sprintf("Error truncating the snapshot file: %s", truncErr.Error()))
+	}
+
+	_, seekErr := file.Seek(offset, io.SeekStart)
+	if seekErr != nil {
+		return errors.New(fmt.Sprintf("Error seeking in the snapshot file: %s", seekErr.Error()))
+	}
+
+	start := time.Now()
+	if objectOffset < info.Size {
+		reader, keyCypher, restoreErr := s3.DownloadEntryFrom(conf.S3Client, entry, objectOffset)
+		if restoreErr != nil {
+			return errors.New(fmt.Sprintf("Error getting a snapshot download from s3: %s", restoreErr.Error()))
+		}
+
+		source := reader
+		if conf.EncryptionKeyPath != "" {
+			masterKey, masterKeyErr := getMasterKey(conf.EncryptionKeyPath)
+			if masterKeyErr != nil {
+				return errors.New(fmt.Sprintf("Error reading master key: %s", masterKeyErr.Error()))
+			}
+
+			decryptStr, decryptStrErr := encryption.NewDecryptStream(masterKey, keyCypher, reader, 1024*1024)
+			if decryptStrErr != nil {
+				return errors.New(fmt.Sprintf("Error generating a decryption stream from the s3 snapshot download: %s", decryptStrErr.Error()))
+			}
+			source = decryptStr
+		}
+
+		written, cpyErr := io.Copy(file, source)
+		if cpyErr != nil {
+			return errors.New(fmt.Sprintf("Error copying the snapshot download into the snapshot file: %s", cpyErr.Error()))
+		}
+
+		log.WithFields(logger.Fields{
+			"bytes":            written,
+			"duration_seconds": time.Since(start).Seconds(),
+		}).Infof("Downloaded backup '%s'", entry.GetTimestamp())
+	}
+
+	removeErr := removeState(statePath)
+	if removeErr != nil {
+		return removeErr
+	}
+
+	checksumErr := checkDownloadChecksum(conf, info.UserMetadata, path)
+	if checksumErr != nil {
+		os.Remove(path)
+		return checksumErr
+	}
+
+	return nil
+}
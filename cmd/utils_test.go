@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/encryption"
+)
+
+func TestGetDownloadOffsets(t *testing.T) {
+	tests := []struct {
+		writtenSize  int64
+		encrypted    bool
+		offset       int64
+		objectOffset int64
+	}{
+		{0, false, 0, 0},
+		{7, false, 7, 7},
+		{0, true, 0, 0},
+		{4, true, 0, 0},
+		{5, true, 5, 5 + encryption.ChunkOverhead},
+		{14, true, 10, 10 + 2*encryption.ChunkOverhead},
+	}
+
+	for _, test := range tests {
+		offset, objectOffset := getDownloadOffsets(test.writtenSize, test.encrypted, 5)
+		if offset != test.offset || objectOffset != test.objectOffset {
+			t.Errorf("Expected offsets %d and %d for %d bytes written (encrypted: %t). Got %d and %d", test.offset, test.objectOffset, test.writtenSize, test.encrypted, offset, objectOffset)
+		}
+	}
+}
+
+func TestGetDownloadOffsetsDecrypt(t *testing.T) {
+	masterKey, masterKeyErr := encryption.GenerateRandomKey()
+	if masterKeyErr != nil {
+		t.Errorf("Error generating master key: %s", masterKeyErr.Error())
+		return
+	}
+
+	plaintext := []byte("This is some test input")
+	encrStream, encrStreamErr := encryption.NewEncryptStream(masterKey, bytes.NewReader(plaintext), 5)
+	if encrStreamErr != nil {
+		t.Errorf("Error generating encryption stream: %s", encrStreamErr.Error())
+		return
+	}
+
+	keyCypher, keyCypherErr := encrStream.GetEncryptedCipherKey()
+	if keyCypherErr != nil {
+		t.Errorf("Error getting the encrypted cipher key: %s", keyCypherErr.Error())
+		return
+	}
+
+	object, readErr := io.ReadAll(encrStream)
+	if readErr != nil {
+		t.Errorf("Error reading encryption stream: %s", readErr.Error())
+		return
+	}
+
+	//The remainder of the object from the object offset must decrypt to the remainder of the plaintext from the offset
+	for writtenSize := int64(0); writtenSize <= int64(len(plaintext)); writtenSize++ {
+		offset, objectOffset := getDownloadOffsets(writtenSize, true, 5)
+
+		decryptStr, decryptStrErr := encryption.NewDecryptStream(masterKey, keyCypher, bytes.NewReader(object[objectOffset:]), 5)
+		if decryptStrErr != nil {
+			t.Errorf("Error generating decryption stream: %s", decryptStrErr.Error())
+			return
+		}
+
+		remainder, decryptErr := io.ReadAll(decryptStr)
+		if decryptErr != nil || !bytes.Equal(remainder, plaintext[offset:]) {
+			t.Errorf("Expected the download resumed after %d bytes to decrypt to '%s'. Got '%s', %v", writtenSize, string(plaintext[offset:]), string(remainder), decryptErr)
+		}
+	}
+}
@@ -22,8 +22,9 @@ type EtcdClientAuthConfig struct {
 	ClientCert   string `yaml:"client_cert"`
 	ClientKey    string `yaml:"client_key"`
 	PasswordAuth string `yaml:"password_auth"`
-	Username     string `yaml:"-"`
-	Password     string `yaml:"-"`
+	Username     string
+	Password     string
+	PasswordFile string `yaml:"password_file"`
 }
 
 type EtcdClientConfig struct {
@@ -40,28 +41,169 @@ type S3KeyAuth struct {
 }
 
 type S3AuthConfig struct {
-	CaCert    string `yaml:"ca_cert"`
-	KeyAuth   string `yaml:"key_auth"`
-	AccessKey string `yaml:"-"`
-	SecretKey string `yaml:"-"`
+	CaCert        string `yaml:"ca_cert"`
+	KeyAuth       string `yaml:"key_auth"`
+	AccessKey     string `yaml:"access_key"`
+	SecretKey     string `yaml:"secret_key"`
+	AccessKeyFile string `yaml:"access_key_file"`
+	SecretKeyFile string `yaml:"secret_key_file"`
+}
+
+type S3UploadConfig struct {
+	PartSize    string `yaml:"part_size"`
+	Concurrency uint
+	MemoryLimit string `yaml:"memory_limit"`
+}
+
+type S3RetryConfig struct {
+	Attempts       uint64
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	Jitter         *float64
+}
+
+type S3RateLimitConfig struct {
+	Upload   string
+	Download string
+}
+
+type S3NamingConfig struct {
+	Scheme          string
+	DatePartitioned bool `yaml:"date_partitioned"`
+	Template        string
+	//Value of the cluster placeholder of templates, which is the name of the target
+	Cluster string `yaml:"-"`
 }
 
 type S3ClientConfig struct {
-	ObjectsPrefix     string        `yaml:"objects_prefix"`
+	ObjectsPrefix     string `yaml:"objects_prefix"`
 	Endpoint          string
 	Bucket            string
 	Region            string
 	Auth              S3AuthConfig
 	ConnectionTimeout time.Duration `yaml:"connection_timeout"`
 	RequestTimeout    time.Duration `yaml:"request_timeout"`
+	OperationTimeout  time.Duration `yaml:"operation_timeout"`
+	TransferTimeout   time.Duration `yaml:"transfer_timeout"`
+	Retry             S3RetryConfig
+	Upload            S3UploadConfig
+	RateLimit         S3RateLimitConfig `yaml:"rate_limit"`
+	Naming            S3NamingConfig
+}
+
+type KeyExportConfig struct {
+	Prefixes      []string
+	Format        string
+	ObjectsPrefix string `yaml:"objects_prefix"`
+	PageSize      int64  `yaml:"page_size"`
+}
+
+type IncrementalConfig struct {
+	ObjectsPrefix     string        `yaml:"objects_prefix"`
+	SegmentInterval   time.Duration `yaml:"segment_interval"`
+	MaxSegmentChanges int64         `yaml:"max_segment_changes"`
+}
+
+type BackupConfig struct {
+	MemberSelection string        `yaml:"member_selection"`
+	OnUnhealthy     string        `yaml:"on_unhealthy"`
+	MaxRaftLag      uint64        `yaml:"max_raft_lag"`
+	SnapshotTimeout time.Duration `yaml:"snapshot_timeout"`
+	ResumeMaxAge    time.Duration `yaml:"resume_max_age"`
+}
+
+type RetentionConfig struct {
+	MaxAge   string `yaml:"max_age"`
+	MinCount int64  `yaml:"min_count"`
+}
+
+type TargetConfig struct {
+	Name              string
+	EtcdClient        EtcdClientConfig  `yaml:"etcd_client"`
+	SnapshotPath      string            `yaml:"snapshot_path"`
+	EncryptionKeyPath string            `yaml:"encryption_key_path"`
+	ObjectsPrefix     string            `yaml:"objects_prefix"`
+	KeyExport         KeyExportConfig   `yaml:"key_export"`
+	Incremental       IncrementalConfig `yaml:"incremental"`
+	Retention         RetentionConfig
+}
+
+type ReplicaConfig struct {
+	Name              string
+	S3Client          S3ClientConfig `yaml:"s3_client"`
+	EncryptionKeyPath string         `yaml:"encryption_key_path"`
+	Retention         RetentionConfig
+}
+
+type HookConfig struct {
+	Command   []string
+	OnFailure string `yaml:"on_failure"`
+	Timeout   time.Duration
+}
+
+type HooksConfig struct {
+	PreBackup   []HookConfig `yaml:"pre_backup"`
+	PostBackup  []HookConfig `yaml:"post_backup"`
+	PreRestore  []HookConfig `yaml:"pre_restore"`
+	PostRestore []HookConfig `yaml:"post_restore"`
+}
+
+type NotifierConfig struct {
+	Name     string
+	Type     string
+	Commands []string
+	Statuses []string
+	Url      string
+	Headers  map[string]string
+	Body     string
+	Command  []string
+	Timeout  time.Duration
+}
+
+//The lease of the lock is renewed at a third of its duration, which must leave time for the renewal
+const MIN_LOCK_TTL = 3 * time.Second
+
+type LockConfig struct {
+	Backend       string
+	Ttl           time.Duration
+	Timeout       time.Duration
+	RetryInterval time.Duration `yaml:"retry_interval"`
+	EtcdKey       string        `yaml:"etcd_key"`
+}
+
+type ServerTlsConfig struct {
+	Certificate  string
+	Key          string
+	ClientCaCert string `yaml:"client_ca_cert"`
+}
+
+type ServerConfig struct {
+	Address    string
+	Tls        ServerTlsConfig
+	TokenPath  string `yaml:"token_path"`
+	MaxPending int    `yaml:"max_pending"`
+	MaxHistory int    `yaml:"max_history"`
 }
 
 type Config struct {
-	EtcdClient        EtcdClientConfig `yaml:"etcd_client"`
-	SnapshotPath      string           `yaml:"snapshot_path"`
-	EncryptionKeyPath string           `yaml:"encryption_key_path"`
-	S3Client          S3ClientConfig   `yaml:"s3_client"`
-	LogLevel          string           `yaml:"log_level"`
+	TargetName        string            `yaml:"-"`
+	EtcdClient        EtcdClientConfig  `yaml:"etcd_client"`
+	SnapshotPath      string            `yaml:"snapshot_path"`
+	EncryptionKeyPath string            `yaml:"encryption_key_path"`
+	S3Client          S3ClientConfig    `yaml:"s3_client"`
+	Backup            BackupConfig      `yaml:"backup"`
+	KeyExport         KeyExportConfig   `yaml:"key_export"`
+	Incremental       IncrementalConfig `yaml:"incremental"`
+	Retention         RetentionConfig
+	Targets           []TargetConfig
+	Replicas          []ReplicaConfig
+	Notifiers         []NotifierConfig
+	Hooks             HooksConfig
+	Lock              LockConfig
+	Server            ServerConfig
+	ReplicateOnBackup bool   `yaml:"replicate_on_backup"`
+	LogLevel          string `yaml:"log_level"`
+	LogFormat         string `yaml:"log_format"`
 }
 
 func (c *Config) GetLogLevel() int64 {
@@ -78,6 +220,35 @@ func (c *Config) GetLogLevel() int64 {
 	}
 }
 
+/*
+Returns a logger with the configured level and format
+*/
+func (c *Config) GetLogger() logger.Logger {
+	return logger.Logger{
+		LogLevel: c.GetLogLevel(),
+		Format:   c.LogFormat,
+		Fields:   logger.Fields{},
+	}
+}
+
+func (c *Config) GetKeyExportS3Client() S3ClientConfig {
+	s3Conf := c.S3Client
+	s3Conf.ObjectsPrefix = c.KeyExport.ObjectsPrefix
+	if s3Conf.ObjectsPrefix == "" {
+		s3Conf.ObjectsPrefix = c.S3Client.ObjectsPrefix + "-export"
+	}
+	return s3Conf
+}
+
+func (c *Config) GetIncrementalS3Client() S3ClientConfig {
+	s3Conf := c.S3Client
+	s3Conf.ObjectsPrefix = c.Incremental.ObjectsPrefix
+	if s3Conf.ObjectsPrefix == "" {
+		s3Conf.ObjectsPrefix = c.S3Client.ObjectsPrefix + "-changes"
+	}
+	return s3Conf
+}
+
 func GetKeyAuth(path string) (S3KeyAuth, error) {
 	var a S3KeyAuth
 
@@ -86,7 +257,7 @@ func GetKeyAuth(path string) (S3KeyAuth, error) {
 		return a, errors.New(fmt.Sprintf("Error reading the s3 key auth file at path '%s': %s", path, err.Error()))
 	}
 
-	err = yaml.Unmarshal(b, &a)
+	err = yaml.UnmarshalStrict(b, &a)
 	if err != nil {
 		return a, errors.New(fmt.Sprintf("Error parsing the s3 key auth file: %s", err.Error()))
 	}
@@ -102,7 +273,7 @@ func GetPasswordAuth(path string) (EtcdPasswordAuth, error) {
 		return a, errors.New(fmt.Sprintf("Error reading the etcd password auth file at path '%s': %s", path, err.Error()))
 	}
 
-	err = yaml.Unmarshal(b, &a)
+	err = yaml.UnmarshalStrict(b, &a)
 	if err != nil {
 		return a, errors.New(fmt.Sprintf("Error parsing the etcd password auth file: %s", err.Error()))
 	}
@@ -110,38 +281,269 @@ func GetPasswordAuth(path string) (EtcdPasswordAuth, error) {
 	return a, nil
 }
 
-func GetConfig(path string) (Config, error) {
-	var c Config
+/*
+Sets the etcd credentials that are not given directly from the password file, then from the password auth file
+*/
+func loadEtcdAuth(auth *EtcdClientAuthConfig) error {
+	if auth.Password == "" && auth.PasswordFile != "" {
+		password, passwordErr := GetSecretFile(auth.PasswordFile)
+		if passwordErr != nil {
+			return passwordErr
+		}
+		auth.Password = password
+	}
 
-	b, err := ioutil.ReadFile(path)
-	if err != nil {
-		return c, errors.New(fmt.Sprintf("Error reading the configuration file: %s", err.Error()))
+	if auth.PasswordAuth != "" {
+		pAuth, pAuthErr := GetPasswordAuth(auth.PasswordAuth)
+		if pAuthErr != nil {
+			return pAuthErr
+		}
+
+		if auth.Username == "" {
+			auth.Username = pAuth.Username
+		}
+
+		if auth.Password == "" {
+			auth.Password = pAuth.Password
+		}
+	}
+
+	return nil
+}
+
+/*
+Sets the s3 credentials that are not given directly from their secret files, then from the key auth file
+*/
+func loadS3Auth(auth *S3AuthConfig) error {
+	if auth.AccessKey == "" && auth.AccessKeyFile != "" {
+		accessKey, accessKeyErr := GetSecretFile(auth.AccessKeyFile)
+		if accessKeyErr != nil {
+			return accessKeyErr
+		}
+		auth.AccessKey = accessKey
+	}
+
+	if auth.SecretKey == "" && auth.SecretKeyFile != "" {
+		secretKey, secretKeyErr := GetSecretFile(auth.SecretKeyFile)
+		if secretKeyErr != nil {
+			return secretKeyErr
+		}
+		auth.SecretKey = secretKey
 	}
 
-	err = yaml.Unmarshal(b, &c)
+	if auth.KeyAuth != "" {
+		kAuth, kAuthErr := GetKeyAuth(auth.KeyAuth)
+		if kAuthErr != nil {
+			return kAuthErr
+		}
+
+		if auth.AccessKey == "" {
+			auth.AccessKey = kAuth.AccessKey
+		}
+
+		if auth.SecretKey == "" {
+			auth.SecretKey = kAuth.SecretKey
+		}
+	}
+
+	return nil
+}
+
+func setHookDefaults(hooks []HookConfig) {
+	for idx, hook := range hooks {
+		if hook.OnFailure == "" {
+			hooks[idx].OnFailure = "abort"
+		}
+
+		if hook.Timeout == 0 {
+			hooks[idx].Timeout = 10 * time.Minute
+		}
+	}
+}
+
+/*
+Sets the credentials of the etcd clients and s3 stores that are not given directly from their secret files
+*/
+func (c *Config) ResolveSecrets() error {
+	authErr := loadEtcdAuth(&c.EtcdClient.Auth)
+	if authErr != nil {
+		return authErr
+	}
+
+	for idx := range c.Targets {
+		authErr = loadEtcdAuth(&c.Targets[idx].EtcdClient.Auth)
+		if authErr != nil {
+			return authErr
+		}
+	}
+
+	authErr = loadS3Auth(&c.S3Client.Auth)
+	if authErr != nil {
+		return authErr
+	}
+
+	for idx := range c.Replicas {
+		authErr = loadS3Auth(&c.Replicas[idx].S3Client.Auth)
+		if authErr != nil {
+			return authErr
+		}
+	}
+
+	return nil
+}
+
+/*
+Loads the configuration file, with its references to environment variables interpolated, and applies the overrides of the environment.
+Without a path, the configuration is only taken from the environment.
+*/
+func GetConfig(path string) (Config, error) {
+	c, err := GetUnresolvedConfig(path)
 	if err != nil {
-		return c, errors.New(fmt.Sprintf("Error parsing the configuration file: %s", err.Error()))
+		return c, err
 	}
 
-	if c.EtcdClient.Auth.PasswordAuth != "" {
-		pAuth, pAuthErr := GetPasswordAuth(c.EtcdClient.Auth.PasswordAuth)
-		if pAuthErr != nil {
-			return c, pAuthErr
+	return c, c.ResolveSecrets()
+}
+
+/*
+Loads the configuration like GetConfig, without reading the secret files of the credentials, for the configuration to be validated first
+*/
+func GetUnresolvedConfig(path string) (Config, error) {
+	var c Config
+
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return c, errors.New(fmt.Sprintf("Error reading the configuration file: %s", err.Error()))
+		}
+
+		content, interpolateErr := InterpolateFile(b)
+		if interpolateErr != nil {
+			return c, interpolateErr
+		}
+
+		err = yaml.UnmarshalStrict(content, &c)
+		if err != nil {
+			return c, errors.New(fmt.Sprintf("Error parsing the configuration file: %s", err.Error()))
 		}
-		c.EtcdClient.Auth.Username = pAuth.Username
-		c.EtcdClient.Auth.Password = pAuth.Password
 	}
 
-	kAuth, kAuthErr := GetKeyAuth(c.S3Client.Auth.KeyAuth)
-	if kAuthErr != nil {
-		return c, kAuthErr
+	overrideErr := ApplyEnvOverrides(&c)
+	if overrideErr != nil {
+		return c, overrideErr
 	}
-	c.S3Client.Auth.AccessKey = kAuth.AccessKey
-	c.S3Client.Auth.SecretKey = kAuth.SecretKey
 
 	if c.S3Client.ObjectsPrefix == "" {
 		c.S3Client.ObjectsPrefix = "backup"
 	}
 
+	if c.Backup.MemberSelection == "" {
+		c.Backup.MemberSelection = "leader"
+	}
+
+	if c.Backup.OnUnhealthy == "" {
+		c.Backup.OnUnhealthy = "warn"
+	}
+
+	if c.Backup.SnapshotTimeout == 0 {
+		c.Backup.SnapshotTimeout = time.Hour
+	}
+
+	if c.Backup.ResumeMaxAge == 0 {
+		c.Backup.ResumeMaxAge = 24 * time.Hour
+	}
+
+	if len(c.KeyExport.Prefixes) == 0 {
+		c.KeyExport.Prefixes = []string{""}
+	}
+
+	if c.KeyExport.Format == "" {
+		c.KeyExport.Format = "jsonl"
+	}
+
+	if c.KeyExport.PageSize == 0 {
+		c.KeyExport.PageSize = 1000
+	}
+
+	if c.Incremental.SegmentInterval == 0 {
+		c.Incremental.SegmentInterval = time.Minute
+	}
+
+	if c.Incremental.MaxSegmentChanges == 0 {
+		c.Incremental.MaxSegmentChanges = 10000
+	}
+
+	if c.LogFormat == "" {
+		c.LogFormat = logger.FORMAT_TEXT
+	}
+
+	if c.Lock.Backend == "" {
+		c.Lock.Backend = "none"
+	}
+
+	if c.Lock.Ttl == 0 {
+		c.Lock.Ttl = 2 * time.Minute
+	}
+
+	if c.Lock.Ttl < MIN_LOCK_TTL {
+		return c, errors.New(fmt.Sprintf("The lock.ttl must be at least %s. Got %s", MIN_LOCK_TTL, c.Lock.Ttl))
+	}
+
+	//Targets would share the exports or change segments of a common prefix, so the prefixes are set per target instead
+	if len(c.Targets) > 0 && c.KeyExport.ObjectsPrefix != "" {
+		return c, errors.New("The key_export.objects_prefix cannot be set when targets are defined. Set it in the key_export of the targets instead")
+	}
+
+	if len(c.Targets) > 0 && c.Incremental.ObjectsPrefix != "" {
+		return c, errors.New("The incremental.objects_prefix cannot be set when targets are defined. Set it in the incremental of the targets instead")
+	}
+
+	if c.Lock.RetryInterval == 0 {
+		c.Lock.RetryInterval = 5 * time.Second
+	}
+
+	if c.Lock.EtcdKey == "" {
+		c.Lock.EtcdKey = "/etcd-backup/lock"
+	}
+
+	if c.Server.Address == "" {
+		c.Server.Address = ":8443"
+	}
+
+	if c.Server.MaxPending == 0 {
+		c.Server.MaxPending = 10
+	}
+
+	if c.Server.MaxHistory == 0 {
+		c.Server.MaxHistory = 100
+	}
+
+	setHookDefaults(c.Hooks.PreBackup)
+	setHookDefaults(c.Hooks.PostBackup)
+	setHookDefaults(c.Hooks.PreRestore)
+	setHookDefaults(c.Hooks.PostRestore)
+
+	for idx, notifier := range c.Notifiers {
+		if len(notifier.Commands) == 0 {
+			c.Notifiers[idx].Commands = []string{"backup", "prune", "verify", "rotate-key"}
+		}
+
+		if len(notifier.Statuses) == 0 {
+			c.Notifiers[idx].Statuses = []string{"success", "failure"}
+		}
+
+		if notifier.Timeout == 0 {
+			c.Notifiers[idx].Timeout = 10 * time.Second
+		}
+	}
+
+	if c.Retention.MaxAge == "" {
+		c.Retention.MaxAge = "15d"
+	}
+
+	if c.Retention.MinCount == 0 {
+		c.Retention.MinCount = 20
+	}
+
 	return c, nil
 }
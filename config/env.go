@@ -0,0 +1,271 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+//Prefix of the environment variables overriding the keys of the configuration
+const ENV_PREFIX = "ETCD_BACKUP_"
+
+//References to environment variables in the configuration file, with an optional default value. A leading $ escapes the reference
+var envReferenceRegex = regexp.MustCompile("\\$?\\$\\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\\}")
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+/*
+Replaces the ${VAR} and ${VAR:-default} references to environment variables in a value of a configuration file.
+A variable that is not set and has no default is an error. $${VAR} is kept as the literal ${VAR}.
+*/
+func InterpolateEnv(content string) (string, error) {
+	missing := []string{}
+	result := envReferenceRegex.ReplaceAllStringFunc(content, func(reference string) string {
+		if strings.HasPrefix(reference, "$$") {
+			return reference[1:]
+		}
+
+		match := envReferenceRegex.FindStringSubmatch(reference)
+		val, found := os.LookupEnv(match[1])
+		if found {
+			return val
+		}
+
+		if match[2] != "" {
+			return match[3]
+		}
+
+		missing = append(missing, match[1])
+		return reference
+	})
+
+	if len(missing) > 0 {
+		return result, errors.New(fmt.Sprintf("Environment variables referenced in the configuration file are not set: %s", strings.Join(missing, ", ")))
+	}
+
+	return result, nil
+}
+
+/*
+Returns the value of a scalar whose whole content was a reference to an environment variable, so that it keeps the type
+it would have had if it was written in the file. Values that are not numbers or booleans, or that would not be written back
+the same way (ex: 0123 or yes), remain strings.
+*/
+func getInterpolatedScalar(val string) interface{} {
+	var scalar interface{}
+	parseErr := yaml.Unmarshal([]byte(val), &scalar)
+	if parseErr != nil {
+		return val
+	}
+
+	switch scalar.(type) {
+	case int, int64, uint64, float64, bool:
+		written, marshalErr := yaml.Marshal(scalar)
+		if marshalErr == nil && strings.TrimSpace(string(written)) == val {
+			return scalar
+		}
+	}
+
+	return val
+}
+
+func interpolateValues(val interface{}) (interface{}, error) {
+	switch typedVal := val.(type) {
+	case string:
+		interpolated, interpolateErr := InterpolateEnv(typedVal)
+		if interpolateErr != nil || interpolated == typedVal {
+			return interpolated, interpolateErr
+		}
+
+		if envReferenceRegex.FindString(typedVal) == typedVal {
+			return getInterpolatedScalar(interpolated), nil
+		}
+
+		return interpolated, nil
+	case map[interface{}]interface{}:
+		for key, item := range typedVal {
+			interpolated, interpolateErr := interpolateValues(item)
+			if interpolateErr != nil {
+				return val, interpolateErr
+			}
+			typedVal[key] = interpolated
+		}
+	case []interface{}:
+		for idx, item := range typedVal {
+			interpolated, interpolateErr := interpolateValues(item)
+			if interpolateErr != nil {
+				return val, interpolateErr
+			}
+			typedVal[idx] = interpolated
+		}
+	}
+
+	return val, nil
+}
+
+/*
+Replaces the references to environment variables in the string values of a configuration file.
+The file is parsed first, so that the values of the variables are never interpreted as yaml and references in comments are ignored.
+*/
+func InterpolateFile(content []byte) ([]byte, error) {
+	//Files without references are kept as is, so that errors mention their lines
+	if !envReferenceRegex.Match(content) {
+		return content, nil
+	}
+
+	var values interface{}
+	parseErr := yaml.UnmarshalStrict(content, &values)
+	if parseErr != nil {
+		return content, errors.New(fmt.Sprintf("Error parsing the configuration file: %s", parseErr.Error()))
+	}
+
+	interpolated, interpolateErr := interpolateValues(values)
+	if interpolateErr != nil {
+		return content, interpolateErr
+	}
+
+	return yaml.Marshal(interpolated)
+}
+
+/*
+Returns the key of a field in the configuration file, following the naming of the yaml library. Empty for fields that are not in the file.
+*/
+func getFieldKey(field reflect.StructField) string {
+	tag := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if tag == "-" || field.PkgPath != "" {
+		return ""
+	}
+
+	if tag != "" {
+		return tag
+	}
+
+	return strings.ToLower(field.Name)
+}
+
+func setFromEnv(val reflect.Value, envName string, envVal string) error {
+	var parseErr error
+	switch {
+	case val.Type() == durationType:
+		var duration time.Duration
+		duration, parseErr = time.ParseDuration(envVal)
+		val.SetInt(int64(duration))
+	case val.Kind() == reflect.String:
+		val.SetString(envVal)
+	case val.Kind() == reflect.Bool:
+		var boolVal bool
+		boolVal, parseErr = strconv.ParseBool(envVal)
+		val.SetBool(boolVal)
+	case val.Kind() >= reflect.Int && val.Kind() <= reflect.Int64:
+		var intVal int64
+		intVal, parseErr = strconv.ParseInt(envVal, 10, 64)
+		val.SetInt(intVal)
+	case val.Kind() >= reflect.Uint && val.Kind() <= reflect.Uint64:
+		var uintVal uint64
+		uintVal, parseErr = strconv.ParseUint(envVal, 10, 64)
+		val.SetUint(uintVal)
+	case val.Kind() == reflect.Float64:
+		var floatVal float64
+		floatVal, parseErr = strconv.ParseFloat(envVal, 64)
+		val.SetFloat(floatVal)
+	case val.Kind() == reflect.Ptr:
+		elem := reflect.New(val.Type().Elem())
+		parseErr = setFromEnv(elem.Elem(), envName, envVal)
+		val.Set(elem)
+	case val.Kind() == reflect.Slice && val.Type().Elem().Kind() == reflect.String:
+		items := []string{}
+		for _, item := range strings.Split(envVal, ",") {
+			if strings.TrimSpace(item) != "" {
+				items = append(items, strings.TrimSpace(item))
+			}
+		}
+		val.Set(reflect.ValueOf(items))
+	case val.Kind() == reflect.Map && val.Type().Elem().Kind() == reflect.String:
+		items := map[string]string{}
+		for _, item := range strings.Split(envVal, ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+
+			key, itemVal, found := strings.Cut(item, "=")
+			if !found {
+				return errors.New(fmt.Sprintf("Error parsing the %s environment variable: entry '%s' is not of the format <key>=<value>", envName, item))
+			}
+			items[strings.TrimSpace(key)] = strings.TrimSpace(itemVal)
+		}
+		val.Set(reflect.ValueOf(items))
+	default:
+		return errors.New(fmt.Sprintf("The %s environment variable overrides a key that cannot be set from the environment", envName))
+	}
+
+	if parseErr != nil {
+		return errors.New(fmt.Sprintf("Error parsing the %s environment variable: %s", envName, parseErr.Error()))
+	}
+
+	return nil
+}
+
+func applyEnvOverrides(val reflect.Value, envName string) error {
+	if val.Kind() == reflect.Struct && val.Type() != durationType {
+		for idx := 0; idx < val.NumField(); idx++ {
+			key := getFieldKey(val.Type().Field(idx))
+			if key == "" {
+				continue
+			}
+
+			overrideErr := applyEnvOverrides(val.Field(idx), envName+"_"+strings.ToUpper(key))
+			if overrideErr != nil {
+				return overrideErr
+			}
+		}
+
+		return nil
+	}
+
+	//The entries of lists of objects are overriden by index, they must be defined in the configuration file
+	if val.Kind() == reflect.Slice && val.Type().Elem().Kind() == reflect.Struct {
+		for idx := 0; idx < val.Len(); idx++ {
+			overrideErr := applyEnvOverrides(val.Index(idx), fmt.Sprintf("%s_%d", envName, idx))
+			if overrideErr != nil {
+				return overrideErr
+			}
+		}
+
+		return nil
+	}
+
+	envVal, found := os.LookupEnv(envName)
+	if !found {
+		return nil
+	}
+
+	return setFromEnv(val, envName, envVal)
+}
+
+/*
+Overrides the keys of the configuration with the environment variables named after their path in the configuration file,
+prefixed with ETCD_BACKUP_ (ex: ETCD_BACKUP_S3_CLIENT_BUCKET for s3_client.bucket).
+Lists are comma separated and maps are comma separated <key>=<value> entries.
+*/
+func ApplyEnvOverrides(c *Config) error {
+	return applyEnvOverrides(reflect.ValueOf(c).Elem(), strings.TrimSuffix(ENV_PREFIX, "_"))
+}
+
+/*
+Returns the content of a file containing a single secret, without its surrounding whitespace
+*/
+func GetSecretFile(path string) (string, error) {
+	content, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return "", errors.New(fmt.Sprintf("Error reading the secret file at path '%s': %s", path, readErr.Error()))
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
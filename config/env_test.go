@@ -0,0 +1,162 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestInterpolateEnv(t *testing.T) {
+	t.Setenv("BACKUP_BUCKET", "backups")
+
+	content, interpolateErr := InterpolateEnv("bucket: ${BACKUP_BUCKET}\nregion: ${BACKUP_REGION:-us-east-1}\nbody: $${BACKUP_BUCKET}")
+	if interpolateErr != nil || content != "bucket: backups\nregion: us-east-1\nbody: ${BACKUP_BUCKET}" {
+		t.Errorf("Expected references to be replaced by their values, their defaults or kept when escaped. Got %q, %v", content, interpolateErr)
+	}
+
+	_, interpolateErr = InterpolateEnv("bucket: ${BACKUP_MISSING}")
+	if interpolateErr == nil {
+		t.Errorf("Expected a reference to a variable that is not set to be an error")
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	t.Setenv("ETCD_BACKUP_S3_CLIENT_BUCKET", "backups")
+	t.Setenv("ETCD_BACKUP_ETCD_CLIENT_ENDPOINTS", "a:2379, b:2379")
+	t.Setenv("ETCD_BACKUP_ETCD_CLIENT_REQUEST_TIMEOUT", "30s")
+	t.Setenv("ETCD_BACKUP_S3_CLIENT_RETRY_JITTER", "0.5")
+	t.Setenv("ETCD_BACKUP_REPLICATE_ON_BACKUP", "true")
+	t.Setenv("ETCD_BACKUP_RETENTION_MIN_COUNT", "5")
+	t.Setenv("ETCD_BACKUP_TARGETS_0_OBJECTS_PREFIX", "cluster-a")
+	t.Setenv("ETCD_BACKUP_NOTIFIERS_0_HEADERS", "Authorization=Bearer abc")
+
+	conf := Config{
+		S3Client:  S3ClientConfig{Bucket: "other"},
+		Targets:   []TargetConfig{TargetConfig{Name: "a"}},
+		Notifiers: []NotifierConfig{NotifierConfig{Name: "hook"}},
+	}
+
+	overrideErr := ApplyEnvOverrides(&conf)
+	if overrideErr != nil {
+		t.Errorf("Expected the overrides to apply. Got %v", overrideErr)
+		return
+	}
+
+	if conf.S3Client.Bucket != "backups" || len(conf.EtcdClient.Endpoints) != 2 || conf.EtcdClient.Endpoints[1] != "b:2379" || conf.EtcdClient.RequestTimeout != 30*time.Second {
+		t.Errorf("Unexpected overriden configuration: %+v", conf)
+	}
+
+	if conf.S3Client.Retry.Jitter == nil || *conf.S3Client.Retry.Jitter != 0.5 || (!conf.ReplicateOnBackup) || conf.Retention.MinCount != 5 {
+		t.Errorf("Unexpected overriden configuration: %+v", conf)
+	}
+
+	if conf.Targets[0].ObjectsPrefix != "cluster-a" || conf.Notifiers[0].Headers["Authorization"] != "Bearer abc" {
+		t.Errorf("Expected the entries of lists to be overriden by index. Got %+v", conf)
+	}
+
+	t.Setenv("ETCD_BACKUP_LOCK_TTL", "soon")
+	overrideErr = ApplyEnvOverrides(&conf)
+	if overrideErr == nil {
+		t.Errorf("Expected a value that does not parse to be an error")
+	}
+}
+
+func TestGetConfigCredentials(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0600)
+		return path
+	}
+
+	keyAuth := writeFile("key_auth.yml", "access_key: file-access\nsecret_key: file-secret\n")
+	secretKey := writeFile("secret_key", "secret-from-file\n")
+	confPath := writeFile("config.yml", "s3_client:\n  auth:\n    key_auth: "+keyAuth+"\n    secret_key_file: "+secretKey+"\n")
+
+	t.Setenv("ETCD_BACKUP_S3_CLIENT_AUTH_ACCESS_KEY", "env-access")
+	t.Setenv("ETCD_BACKUP_ETCD_CLIENT_AUTH_USERNAME", "root")
+	t.Setenv("ETCD_BACKUP_ETCD_CLIENT_AUTH_PASSWORD_FILE", writeFile("password", "etcd-password"))
+
+	conf, confErr := GetConfig(confPath)
+	if confErr != nil {
+		t.Errorf("Expected the configuration to load. Got %v", confErr)
+		return
+	}
+
+	if conf.S3Client.Auth.AccessKey != "env-access" || conf.S3Client.Auth.SecretKey != "secret-from-file" {
+		t.Errorf("Expected the s3 credentials of the environment and secret files to take precedence over the key auth file. Got %+v", conf.S3Client.Auth)
+	}
+
+	if conf.EtcdClient.Auth.Username != "root" || conf.EtcdClient.Auth.Password != "etcd-password" {
+		t.Errorf("Expected the etcd credentials to be read from the environment and the password file. Got %+v", conf.EtcdClient.Auth)
+	}
+
+	t.Setenv("ETCD_BACKUP_S3_CLIENT_BUCKET", "backups")
+	conf, confErr = GetConfig("")
+	if confErr != nil || conf.S3Client.Bucket != "backups" || conf.S3Client.ObjectsPrefix != "backup" {
+		t.Errorf("Expected the configuration to be taken from the environment with its defaults without a file. Got %+v, %v", conf.S3Client, confErr)
+	}
+	if conf.Backup.OnUnhealthy != "warn" {
+		t.Errorf("Expected backups of unhealthy clusters to proceed with a warning by default. Got %s", conf.Backup.OnUnhealthy)
+	}
+}
+
+func TestGetUnresolvedConfig(t *testing.T) {
+	t.Setenv("ETCD_BACKUP_S3_CLIENT_AUTH_KEY_AUTH", filepath.Join(t.TempDir(), "missing.yml"))
+
+	conf, confErr := GetUnresolvedConfig("")
+	if confErr != nil || conf.S3Client.Auth.AccessKey != "" {
+		t.Errorf("Expected the configuration to load without reading the secret files. Got %+v, %v", conf.S3Client.Auth, confErr)
+	}
+
+	secretsErr := conf.ResolveSecrets()
+	if secretsErr == nil {
+		t.Errorf("Expected a missing secret file to be an error once the secrets are resolved")
+	}
+}
+
+func TestGetConfigStrict(t *testing.T) {
+	confPath := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(confPath, []byte("s3_client:\n  bucke: backups\n"), 0600)
+
+	_, confErr := GetConfig(confPath)
+	if confErr == nil || !strings.Contains(confErr.Error(), "bucke") {
+		t.Errorf("Expected an unknown key to be reported. Got %v", confErr)
+	}
+}
+
+func TestGetConfigLockTtl(t *testing.T) {
+	t.Setenv("ETCD_BACKUP_LOCK_TTL", "1ns")
+
+	_, confErr := GetConfig("")
+	if confErr == nil {
+		t.Errorf("Expected a lock ttl too short to be renewed to be an error")
+	}
+}
+
+func TestInterpolateFile(t *testing.T) {
+	t.Setenv("BACKUP_SECRET", "a: b # c\nd: e")
+	t.Setenv("BACKUP_RETRIES", "3")
+	t.Setenv("BACKUP_PASSWORD", "0123")
+
+	content, interpolateErr := InterpolateFile([]byte("#Secret of ${BACKUP_UNSET}\nsecret: ${BACKUP_SECRET}\nretries: ${BACKUP_RETRIES}\nname: retry-${BACKUP_RETRIES}\npassword: ${BACKUP_PASSWORD}\n"))
+	if interpolateErr != nil {
+		t.Errorf("Expected the file to be interpolated, ignoring its comments. Got %v", interpolateErr)
+		return
+	}
+
+	var values struct {
+		Secret   string
+		Retries  int
+		Name     string
+		Password string
+	}
+	parseErr := yaml.UnmarshalStrict(content, &values)
+	if parseErr != nil || values.Secret != "a: b # c\nd: e" || values.Retries != 3 || values.Name != "retry-3" || values.Password != "0123" {
+		t.Errorf("Expected the values of the variables to be kept as they are, without being interpreted as yaml. Got %+v, %v", values, parseErr)
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+Parses a size in bytes that may be expressed with a binary (ex: 64MiB) or decimal (ex: 100MB) unit.
+An empty size is parsed as 0.
+*/
+func ParseSize(size string) (uint64, error) {
+	size = strings.TrimSpace(size)
+	if size == "" {
+		return 0, nil
+	}
+
+	//Longer suffixes are checked first so that "MiB" is not mistaken for "B"
+	units := []struct {
+		Suffix string
+		Unit   uint64
+	}{
+		{"KiB", 1024},
+		{"MiB", 1024 * 1024},
+		{"GiB", 1024 * 1024 * 1024},
+		{"TiB", 1024 * 1024 * 1024 * 1024},
+		{"KB", 1000},
+		{"MB", 1000 * 1000},
+		{"GB", 1000 * 1000 * 1000},
+		{"TB", 1000 * 1000 * 1000 * 1000},
+		{"B", 1},
+	}
+
+	unit := uint64(1)
+	for _, candidate := range units {
+		if strings.HasSuffix(size, candidate.Suffix) {
+			size = strings.TrimSpace(strings.TrimSuffix(size, candidate.Suffix))
+			unit = candidate.Unit
+			break
+		}
+	}
+
+	count, parseErr := strconv.ParseUint(size, 10, 64)
+	if parseErr != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid size '%s'", size))
+	}
+
+	return count * unit, nil
+}
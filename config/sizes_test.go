@@ -0,0 +1,32 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	expectations := map[string]uint64{
+		"":      0,
+		"512":   512,
+		"512B":  512,
+		"64MiB": 64 * 1024 * 1024,
+		"2 GiB": 2 * 1024 * 1024 * 1024,
+		"100MB": 100 * 1000 * 1000,
+		"10KiB": 10 * 1024,
+		"1TB":   1000 * 1000 * 1000 * 1000,
+	}
+
+	for input, expected := range expectations {
+		size, parseErr := ParseSize(input)
+		if parseErr != nil || size != expected {
+			t.Errorf("Expected '%s' to parse as %d. Got %d, %v", input, expected, size, parseErr)
+		}
+	}
+
+	for _, input := range []string{"xMiB", "-1", "1.5GiB"} {
+		_, parseErr := ParseSize(input)
+		if parseErr == nil {
+			t.Errorf("Expected an error parsing invalid size '%s'", input)
+		}
+	}
+}
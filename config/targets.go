@@ -0,0 +1,159 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DEFAULT_TARGET_NAME = "default"
+
+/*
+Returns the configuration of each backup target, as a copy of the configuration with the target's parameters applied.
+If no targets are defined, the configuration itself is the only target.
+If a target name is given, only the configuration of that target is returned.
+*/
+func (c *Config) GetTargets(name string) ([]Config, error) {
+	if len(c.Targets) == 0 {
+		if name != "" && name != DEFAULT_TARGET_NAME {
+			return []Config{}, errors.New(fmt.Sprintf("Target '%s' is not defined in the configuration", name))
+		}
+
+		target := *c
+		target.TargetName = DEFAULT_TARGET_NAME
+		target.S3Client.Naming.Cluster = DEFAULT_TARGET_NAME
+		return []Config{target}, nil
+	}
+
+	targets := []Config{}
+	for _, targetConf := range c.Targets {
+		if name != "" && targetConf.Name != name {
+			continue
+		}
+
+		target := *c
+		target.TargetName = targetConf.Name
+		target.S3Client.Naming.Cluster = targetConf.Name
+		target.Targets = []TargetConfig{}
+		target.EtcdClient = targetConf.EtcdClient
+
+		if targetConf.SnapshotPath != "" {
+			target.SnapshotPath = targetConf.SnapshotPath
+		}
+
+		if targetConf.EncryptionKeyPath != "" {
+			target.EncryptionKeyPath = targetConf.EncryptionKeyPath
+		}
+
+		//Derived object prefixes are recomputed from the target's prefix so that targets never share objects
+		target.S3Client.ObjectsPrefix = targetConf.ObjectsPrefix
+		if target.S3Client.ObjectsPrefix == "" {
+			target.S3Client.ObjectsPrefix = targetConf.Name
+		}
+		target.KeyExport.ObjectsPrefix = targetConf.KeyExport.ObjectsPrefix
+		target.Incremental.ObjectsPrefix = targetConf.Incremental.ObjectsPrefix
+
+		if len(targetConf.KeyExport.Prefixes) > 0 {
+			target.KeyExport.Prefixes = targetConf.KeyExport.Prefixes
+		}
+
+		if targetConf.KeyExport.Format != "" {
+			target.KeyExport.Format = targetConf.KeyExport.Format
+		}
+
+		if targetConf.KeyExport.PageSize != 0 {
+			target.KeyExport.PageSize = targetConf.KeyExport.PageSize
+		}
+
+		if targetConf.Incremental.SegmentInterval != 0 {
+			target.Incremental.SegmentInterval = targetConf.Incremental.SegmentInterval
+		}
+
+		if targetConf.Incremental.MaxSegmentChanges != 0 {
+			target.Incremental.MaxSegmentChanges = targetConf.Incremental.MaxSegmentChanges
+		}
+
+		if targetConf.Retention.MaxAge != "" {
+			target.Retention.MaxAge = targetConf.Retention.MaxAge
+		}
+
+		if targetConf.Retention.MinCount != 0 {
+			target.Retention.MinCount = targetConf.Retention.MinCount
+		}
+
+		targets = append(targets, target)
+	}
+
+	if len(targets) == 0 {
+		return targets, errors.New(fmt.Sprintf("Target '%s' is not defined in the configuration", name))
+	}
+
+	return targets, nil
+}
+
+/*
+Returns the configuration of a single target. A target name must be given if several targets are defined.
+*/
+func (c *Config) GetTarget(name string) (Config, error) {
+	if name == "" && len(c.Targets) > 1 {
+		return Config{}, errors.New("Several targets are defined in the configuration and the command requires that a single target be specified")
+	}
+
+	targets, targetsErr := c.GetTargets(name)
+	if targetsErr != nil {
+		return Config{}, targetsErr
+	}
+
+	return targets[0], nil
+}
+
+/*
+Parses a duration that may also be expressed in days (ex: 15d), weeks (ex: 10w) or years of 365 days (ex: 1y)
+*/
+func ParseDuration(duration string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"y": 365 * 24 * time.Hour,
+	}
+
+	for suffix, unit := range units {
+		if !strings.HasSuffix(duration, suffix) {
+			continue
+		}
+
+		count, parseErr := strconv.ParseInt(strings.TrimSuffix(duration, suffix), 10, 64)
+		if parseErr != nil {
+			return 0, errors.New(fmt.Sprintf("Invalid duration '%s'", duration))
+		}
+
+		return time.Duration(count) * unit, nil
+	}
+
+	return time.ParseDuration(duration)
+}
+
+/*
+Returns the secondary stores the backups are replicated to, or only the one with the given name if specified.
+Replicated objects keep their names, so the objects prefix and naming of the replicas are the ones of the configuration.
+*/
+func (c *Config) GetReplicas(name string) ([]ReplicaConfig, error) {
+	replicas := []ReplicaConfig{}
+	for _, replica := range c.Replicas {
+		if name != "" && replica.Name != name {
+			continue
+		}
+
+		replica.S3Client.ObjectsPrefix = c.S3Client.ObjectsPrefix
+		replica.S3Client.Naming = c.S3Client.Naming
+		replicas = append(replicas, replica)
+	}
+
+	if name != "" && len(replicas) == 0 {
+		return replicas, errors.New(fmt.Sprintf("Replica '%s' is not defined in the configuration", name))
+	}
+
+	return replicas, nil
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetTargets(t *testing.T) {
+	conf := Config{
+		SnapshotPath:      "/tmp/snapshot",
+		EncryptionKeyPath: "/keys/default",
+		S3Client:          S3ClientConfig{ObjectsPrefix: "backup", Bucket: "backups"},
+		KeyExport:         KeyExportConfig{Format: "jsonl", PageSize: 1000},
+		Incremental:       IncrementalConfig{SegmentInterval: time.Minute, MaxSegmentChanges: 10000},
+		Retention:         RetentionConfig{MaxAge: "15d", MinCount: 20},
+	}
+
+	targets, targetsErr := conf.GetTargets("")
+	if targetsErr != nil || len(targets) != 1 || targets[0].TargetName != DEFAULT_TARGET_NAME {
+		t.Errorf("Expected configuration without targets to be a single default target. Got %+v, %v", targets, targetsErr)
+	}
+
+	conf.Targets = []TargetConfig{
+		TargetConfig{Name: "a", EtcdClient: EtcdClientConfig{Endpoints: []string{"a:2379"}}},
+		TargetConfig{
+			Name:              "b",
+			EncryptionKeyPath: "/keys/b",
+			ObjectsPrefix:     "cluster-b",
+			KeyExport:         KeyExportConfig{ObjectsPrefix: "exports-b", Format: "protobuf"},
+			Incremental:       IncrementalConfig{SegmentInterval: time.Second},
+			Retention:         RetentionConfig{MinCount: 5},
+		},
+	}
+
+	targets, targetsErr = conf.GetTargets("")
+	if targetsErr != nil || len(targets) != 2 {
+		t.Errorf("Expected 2 targets. Got %+v, %v", targets, targetsErr)
+		return
+	}
+
+	a := targets[0]
+	if a.TargetName != "a" || a.EtcdClient.Endpoints[0] != "a:2379" || a.S3Client.ObjectsPrefix != "a" || a.S3Client.Naming.Cluster != "a" || a.EncryptionKeyPath != "/keys/default" || a.S3Client.Bucket != "backups" {
+		t.Errorf("Unexpected configuration for target 'a': %+v", a)
+	}
+
+	if prefix := a.GetKeyExportS3Client().ObjectsPrefix; prefix != "a-export" {
+		t.Errorf("Expected the export prefix of target 'a' to be derived from its prefix. Got '%s'", prefix)
+	}
+
+	b := targets[1]
+	if b.S3Client.ObjectsPrefix != "cluster-b" || b.EncryptionKeyPath != "/keys/b" || b.Retention.MinCount != 5 || b.Retention.MaxAge != "15d" {
+		t.Errorf("Unexpected configuration for target 'b': %+v", b)
+	}
+
+	if b.GetKeyExportS3Client().ObjectsPrefix != "exports-b" || b.KeyExport.Format != "protobuf" || b.KeyExport.PageSize != 1000 {
+		t.Errorf("Expected the exports of target 'b' to take its parameters over the shared ones. Got %+v", b.KeyExport)
+	}
+
+	if b.GetIncrementalS3Client().ObjectsPrefix != "cluster-b-changes" || b.Incremental.SegmentInterval != time.Second || b.Incremental.MaxSegmentChanges != 10000 {
+		t.Errorf("Expected the change segments of target 'b' to take its parameters over the shared ones. Got %+v", b.Incremental)
+	}
+
+	targets, targetsErr = conf.GetTargets("b")
+	if targetsErr != nil || len(targets) != 1 || targets[0].TargetName != "b" {
+		t.Errorf("Expected only target 'b' to be returned. Got %+v, %v", targets, targetsErr)
+	}
+
+	_, targetsErr = conf.GetTargets("c")
+	if targetsErr == nil {
+		t.Errorf("Expected an error getting an undefined target")
+	}
+
+	_, targetErr := conf.GetTarget("")
+	if targetErr == nil {
+		t.Errorf("Expected an error getting a single target without a name when several are defined")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	expectations := map[string]time.Duration{
+		"15d": 15 * 24 * time.Hour,
+		"10w": 70 * 24 * time.Hour,
+		"1y":  365 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+	}
+
+	for input, expected := range expectations {
+		duration, parseErr := ParseDuration(input)
+		if parseErr != nil || duration != expected {
+			t.Errorf("Expected '%s' to parse as %s. Got %s, %v", input, expected, duration, parseErr)
+		}
+	}
+
+	_, parseErr := ParseDuration("xd")
+	if parseErr == nil {
+		t.Errorf("Expected an error parsing an invalid duration")
+	}
+}
+
+func TestGetConfigSharedPrefixes(t *testing.T) {
+	confPath := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(confPath, []byte("key_export:\n  objects_prefix: exports\ntargets:\n  - name: a\n  - name: b\n"), 0600)
+
+	_, confErr := GetConfig(confPath)
+	if confErr == nil {
+		t.Errorf("Expected an export prefix shared by several targets to be an error")
+	}
+
+	os.WriteFile(confPath, []byte("targets:\n  - name: a\n    key_export:\n      objects_prefix: exports-a\n    incremental:\n      objects_prefix: changes-a\n"), 0600)
+	conf, confErr := GetConfig(confPath)
+	if confErr != nil || conf.Targets[0].KeyExport.ObjectsPrefix != "exports-a" || conf.Targets[0].Incremental.ObjectsPrefix != "changes-a" {
+		t.Errorf("Expected the prefixes of the targets to be read. Got %+v, %v", conf.Targets, confErr)
+	}
+}
@@ -70,13 +70,36 @@ func NewEncryptStream(masterKey []byte, source io.Reader, chunkSize int64) (*Enc
 	}, nil
 }
 
+/*
+Returns an encryption stream continuing, from the given chunk index, a stream with the given cipher key and nonce base.
+Sections of a source that start on a chunk boundary can be encrypted independently this way, with the same result as the whole stream.
+*/
+func NewEncryptStreamAt(masterKey []byte, cipherKey []byte, nonceBase []byte, chunkIndex int64, source io.Reader, chunkSize int64) *EncryptStream {
+	base := make([]byte, len(nonceBase))
+	copy(base, nonceBase)
+
+	return &EncryptStream{
+		MasterKey:    masterKey,
+		ChunkSize:    chunkSize,
+		Source:       source,
+		Nonce:        NonceInc{Base: base, Increment: chunkIndex},
+		CipherKey:    cipherKey,
+		SourceErr:    nil,
+		SourceBuffer: bytes.NewBuffer(make([]byte, 0)),
+	}
+}
+
 func (stream *EncryptStream) AddCiphertext() {
 	if stream.SourceErr != nil {
 		return
 	}
 
+	//Chunks are filled completely, even from sources returning partial reads, so that they can be located in the output
 	srcInput := make([]byte, stream.ChunkSize)
-	n, nErr := stream.Source.Read(srcInput)
+	n, nErr := io.ReadFull(stream.Source, srcInput)
+	if nErr == io.ErrUnexpectedEOF {
+		nErr = io.EOF
+	}
 	if nErr != nil {
 		stream.SourceErr = nErr
 	}
@@ -115,6 +138,11 @@ func (stream *EncryptStream) Read(p []byte) (n int, err error) {
 		return n, nErr
 	}
 
+	//The last chunk can be read along with the end of the source, it must be consumed before the end is reported
+	if stream.SourceBuffer.Len() > 0 {
+		return n, nil
+	}
+
 	return n, stream.SourceErr
 }
 
@@ -159,7 +187,10 @@ func (stream *DecryptStream) AddPlaintext() {
 	}
 
 	srcInput := make([]byte, int(stream.ChunkSize)+aead.NonceSize()+aead.Overhead())
-	n, nErr := stream.Source.Read(srcInput)
+	n, nErr := io.ReadFull(stream.Source, srcInput)
+	if nErr == io.ErrUnexpectedEOF {
+		nErr = io.EOF
+	}
 	if nErr != nil {
 		stream.SourceErr = nErr
 	}
@@ -198,5 +229,10 @@ func (stream *DecryptStream) Read(p []byte) (n int, err error) {
 		return n, nErr
 	}
 
+	//The last chunk can be read along with the end of the source, it must be consumed before the end is reported
+	if stream.SourceBuffer.Len() > 0 {
+		return n, nil
+	}
+
 	return n, stream.SourceErr
 }
@@ -6,6 +6,7 @@ import (
 	"math"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	chacha "golang.org/x/crypto/chacha20poly1305"
 )
@@ -238,3 +239,143 @@ func TestDecryptStream(t *testing.T) {
 		return
 	}
 }
+
+func TestEncryptStreamAt(t *testing.T) {
+	testInput := "This is some test input"
+
+	masterKey, masterKeyErr := GenerateRandomKey()
+	if masterKeyErr != nil {
+		t.Errorf("Error generating master key: %s", masterKeyErr.Error())
+		return
+	}
+
+	encryptStr, encryptStrErr := NewEncryptStream(masterKey, strings.NewReader(testInput), 5)
+	if encryptStrErr != nil {
+		t.Errorf("Error generating encryption stream: %s", encryptStrErr.Error())
+		return
+	}
+
+	var whole bytes.Buffer
+	_, cpyErr := io.Copy(&whole, encryptStr)
+	if cpyErr != nil {
+		t.Errorf("Error reading encryption stream: %s", cpyErr.Error())
+		return
+	}
+
+	var sections bytes.Buffer
+	for _, section := range []struct {
+		Start int64
+		End   int64
+	}{{0, 10}, {10, 20}, {20, 23}} {
+		sectionStr := NewEncryptStreamAt(masterKey, encryptStr.CipherKey, encryptStr.Nonce.Base, section.Start/5, strings.NewReader(testInput[section.Start:section.End]), 5)
+		_, cpyErr := io.Copy(&sections, sectionStr)
+		if cpyErr != nil {
+			t.Errorf("Error reading section encryption stream: %s", cpyErr.Error())
+			return
+		}
+	}
+
+	if !bytes.Equal(whole.Bytes(), sections.Bytes()) {
+		t.Errorf("Expected the encryption of the sections to be equal to the encryption of the whole input")
+	}
+}
+
+func TestStreamsWithPartialReads(t *testing.T) {
+	testInput := "This is some test input"
+
+	masterKey, masterKeyErr := GenerateRandomKey()
+	if masterKeyErr != nil {
+		t.Errorf("Error generating master key: %s", masterKeyErr.Error())
+		return
+	}
+
+	encryptStr, encryptStrErr := NewEncryptStream(masterKey, iotest.OneByteReader(strings.NewReader(testInput)), 5)
+	if encryptStrErr != nil {
+		t.Errorf("Error generating encryption stream: %s", encryptStrErr.Error())
+		return
+	}
+
+	var cypherText bytes.Buffer
+	n, cpyErr := io.Copy(&cypherText, encryptStr)
+	if cpyErr != nil {
+		t.Errorf("Error reading encryption stream: %s", cpyErr.Error())
+		return
+	}
+
+	if n != EncryptedSize(int64(len(testInput)), 5) {
+		t.Errorf("Expected partial reads of the source to still fill the chunks. Got %d bytes of cyphertext", n)
+		return
+	}
+
+	cypherKeyCypher, cypherKeyCypherErr := encryptStr.GetEncryptedCipherKey()
+	if cypherKeyCypherErr != nil {
+		t.Errorf("Error reading encrypted encryption key: %s", cypherKeyCypherErr.Error())
+		return
+	}
+
+	decryptStr, decryptStrErr := NewDecryptStream(masterKey, cypherKeyCypher, iotest.OneByteReader(&cypherText), 5)
+	if decryptStrErr != nil {
+		t.Errorf("Error generating decryption stream: %s", decryptStrErr.Error())
+		return
+	}
+
+	plaintext, readErr := io.ReadAll(decryptStr)
+	if readErr != nil {
+		t.Errorf("Error reading decryption stream: %s", readErr.Error())
+		return
+	}
+
+	if string(plaintext) != testInput {
+		t.Errorf("Decrypted output was not the original input: '%s'", plaintext)
+	}
+}
+
+func TestStreamsWithSmallReads(t *testing.T) {
+	testInput := "This is some test input"
+
+	masterKey, masterKeyErr := GenerateRandomKey()
+	if masterKeyErr != nil {
+		t.Errorf("Error generating master key: %s", masterKeyErr.Error())
+		return
+	}
+
+	encryptStr, encryptStrErr := NewEncryptStream(masterKey, strings.NewReader(testInput), 5)
+	if encryptStrErr != nil {
+		t.Errorf("Error generating encryption stream: %s", encryptStrErr.Error())
+		return
+	}
+
+	//The last chunk is partial and longer than the reads
+	cypherText, cpyErr := io.ReadAll(iotest.OneByteReader(encryptStr))
+	if cpyErr != nil {
+		t.Errorf("Error reading encryption stream: %s", cpyErr.Error())
+		return
+	}
+
+	if int64(len(cypherText)) != EncryptedSize(int64(len(testInput)), 5) {
+		t.Errorf("Expected reads smaller than the chunks to return the whole cyphertext. Got %d bytes of cyphertext", len(cypherText))
+		return
+	}
+
+	cypherKeyCypher, cypherKeyCypherErr := encryptStr.GetEncryptedCipherKey()
+	if cypherKeyCypherErr != nil {
+		t.Errorf("Error reading encrypted encryption key: %s", cypherKeyCypherErr.Error())
+		return
+	}
+
+	decryptStr, decryptStrErr := NewDecryptStream(masterKey, cypherKeyCypher, bytes.NewReader(cypherText), 5)
+	if decryptStrErr != nil {
+		t.Errorf("Error generating decryption stream: %s", decryptStrErr.Error())
+		return
+	}
+
+	plaintext, readErr := io.ReadAll(iotest.OneByteReader(decryptStr))
+	if readErr != nil {
+		t.Errorf("Error reading decryption stream: %s", readErr.Error())
+		return
+	}
+
+	if string(plaintext) != testInput {
+		t.Errorf("Decrypted output was not the original input: '%s'", plaintext)
+	}
+}
@@ -0,0 +1,35 @@
+package encryption
+
+import (
+	chacha "golang.org/x/crypto/chacha20poly1305"
+)
+
+//Bytes added to each chunk of an encrypted stream: the nonce and the authentication tag
+const ChunkOverhead = chacha.NonceSizeX + chacha.Overhead
+
+/*
+Returns the size of the output of an encryption stream for a source of the given size,
+assuming the source fills each chunk before the last one, which is the case for files.
+*/
+func EncryptedSize(plaintextSize int64, chunkSize int64) int64 {
+	chunks := plaintextSize / chunkSize
+	if plaintextSize%chunkSize != 0 {
+		chunks += 1
+	}
+
+	return plaintextSize + chunks*ChunkOverhead
+}
+
+/*
+Returns the size of the plaintext of an encrypted stream of the given size
+*/
+func DecryptedSize(encryptedSize int64, chunkSize int64) int64 {
+	encryptedChunkSize := chunkSize + ChunkOverhead
+
+	chunks := encryptedSize / encryptedChunkSize
+	if encryptedSize%encryptedChunkSize != 0 {
+		chunks += 1
+	}
+
+	return encryptedSize - chunks*ChunkOverhead
+}
@@ -0,0 +1,37 @@
+package encryption
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestEncryptedSize(t *testing.T) {
+	masterKey, masterKeyErr := GenerateRandomKey()
+	if masterKeyErr != nil {
+		t.Errorf("Error generating master key: %s", masterKeyErr.Error())
+		return
+	}
+
+	for _, plaintextSize := range []int64{0, 1, 4, 5, 6, 23, 25} {
+		encryptStr, encryptStrErr := NewEncryptStream(masterKey, bytes.NewReader(make([]byte, plaintextSize)), 5)
+		if encryptStrErr != nil {
+			t.Errorf("Error generating encryption stream: %s", encryptStrErr.Error())
+			return
+		}
+
+		n, cpyErr := io.Copy(io.Discard, encryptStr)
+		if cpyErr != nil {
+			t.Errorf("Error reading encryption stream: %s", cpyErr.Error())
+			return
+		}
+
+		if EncryptedSize(plaintextSize, 5) != n {
+			t.Errorf("Expected encrypted size of %d bytes for %d bytes of plaintext. Got %d", n, plaintextSize, EncryptedSize(plaintextSize, 5))
+		}
+
+		if DecryptedSize(n, 5) != plaintextSize {
+			t.Errorf("Expected decrypted size of %d bytes for %d bytes of cyphertext. Got %d", plaintextSize, n, DecryptedSize(n, 5))
+		}
+	}
+}
@@ -8,6 +8,9 @@ require (
 	github.com/Ferlab-Ste-Justine/etcd-sdk v0.12.0
 	github.com/minio/minio-go/v7 v7.0.90
 	github.com/spf13/cobra v1.9.1
+	go.etcd.io/bbolt v1.3.11
+	go.etcd.io/etcd/api/v3 v3.5.21
+	go.etcd.io/etcd/client/v3 v3.5.21
 	golang.org/x/crypto v0.37.0
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -28,9 +31,7 @@ require (
 	github.com/minio/md5-simd v1.1.2 // indirect
 	github.com/rs/xid v1.6.0 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
-	go.etcd.io/etcd/api/v3 v3.5.21 // indirect
 	go.etcd.io/etcd/client/pkg/v3 v3.5.21 // indirect
-	go.etcd.io/etcd/client/v3 v3.5.21 // indirect
 	go.etcd.io/raft/v3 v3.6.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
@@ -0,0 +1,88 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+)
+
+const (
+	HOOK_POLICY_ABORT = "abort"
+	HOOK_POLICY_WARN  = "warn"
+)
+
+const (
+	PRE_BACKUP   = "pre_backup"
+	POST_BACKUP  = "post_backup"
+	PRE_RESTORE  = "pre_restore"
+	POST_RESTORE = "post_restore"
+)
+
+func ValidateHookPolicy(policy string) error {
+	if policy != HOOK_POLICY_ABORT && policy != HOOK_POLICY_WARN {
+		return errors.New(fmt.Sprintf("Unsupported hook failure policy '%s'", policy))
+	}
+
+	return nil
+}
+
+/*
+Returns the environment variables of hooks from their names without the HOOK_ prefix.
+They do not share the ETCD_BACKUP_ prefix of the configuration overrides, so that they are not taken as such by the commands hooks run.
+*/
+func GetEnv(vars map[string]string) []string {
+	env := []string{}
+	for key, val := range vars {
+		env = append(env, fmt.Sprintf("HOOK_%s=%s", key, val))
+	}
+
+	return env
+}
+
+func runHook(hook config.HookConfig, env []string) error {
+	if len(hook.Command) == 0 {
+		return errors.New("No command to execute was specified")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hook.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	//The standard output of the process is kept for the reports of the commands
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+/*
+Runs the hooks in order with the given environment variables.
+The failure of a hook whose policy is to abort stops the hooks and is returned. The failures of the other hooks are passed to the warning function.
+*/
+func Run(hooks []config.HookConfig, env []string, onWarning func(hook config.HookConfig, err error)) error {
+	for _, hook := range hooks {
+		policyErr := ValidateHookPolicy(hook.OnFailure)
+		if policyErr != nil {
+			return policyErr
+		}
+
+		hookErr := runHook(hook, env)
+		if hookErr == nil {
+			continue
+		}
+
+		hookErr = errors.New(fmt.Sprintf("Hook '%s' failed: %s", strings.Join(hook.Command, " "), hookErr.Error()))
+		if hook.OnFailure == HOOK_POLICY_ABORT {
+			return hookErr
+		}
+
+		onWarning(hook, hookErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package hooks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+)
+
+func TestRun(t *testing.T) {
+	env := GetEnv(map[string]string{"NAME": PRE_BACKUP})
+	check := config.HookConfig{Command: []string{"sh", "-c", "test \"$HOOK_NAME\" = pre_backup"}, OnFailure: HOOK_POLICY_ABORT, Timeout: time.Minute}
+	failWarn := config.HookConfig{Command: []string{"sh", "-c", "exit 1"}, OnFailure: HOOK_POLICY_WARN, Timeout: time.Minute}
+	failAbort := config.HookConfig{Command: []string{"sh", "-c", "exit 2"}, OnFailure: HOOK_POLICY_ABORT, Timeout: time.Minute}
+
+	warnings := 0
+	onWarning := func(hook config.HookConfig, err error) {
+		warnings += 1
+	}
+
+	runErr := Run([]config.HookConfig{check, failWarn}, env, onWarning)
+	if runErr != nil || warnings != 1 {
+		t.Errorf("Expected the hooks to see their environment and the failure of the warning hook to be a warning. Got %v with %d warnings", runErr, warnings)
+	}
+
+	warnings = 0
+	runErr = Run([]config.HookConfig{failAbort, failWarn}, env, onWarning)
+	if runErr == nil || warnings != 0 {
+		t.Errorf("Expected the failure of the aborting hook to stop the hooks. Got %v with %d warnings", runErr, warnings)
+	}
+
+	slow := config.HookConfig{Command: []string{"sleep", "5"}, OnFailure: HOOK_POLICY_ABORT, Timeout: 100 * time.Millisecond}
+	runErr = Run([]config.HookConfig{slow}, env, onWarning)
+	if runErr == nil {
+		t.Errorf("Expected a hook exceeding its timeout to fail")
+	}
+}
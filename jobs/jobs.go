@@ -0,0 +1,194 @@
+package jobs
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	JOB_QUEUED    = "queued"
+	JOB_RUNNING   = "running"
+	JOB_SUCCEEDED = "succeeded"
+	JOB_FAILED    = "failed"
+	JOB_CANCELLED = "cancelled"
+)
+
+type JobFn func() (interface{}, error)
+
+type Job struct {
+	Id       string      `json:"id"`
+	Command  string      `json:"command"`
+	Target   string      `json:"target"`
+	Status   string      `json:"status"`
+	Created  time.Time   `json:"created"`
+	Started  *time.Time  `json:"started,omitempty"`
+	Finished *time.Time  `json:"finished,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Result   interface{} `json:"result,omitempty"`
+	run      JobFn
+}
+
+func (job *Job) isDone() bool {
+	return job.Status == JOB_SUCCEEDED || job.Status == JOB_FAILED || job.Status == JOB_CANCELLED
+}
+
+/*
+Queue running its jobs one at a time, in the order they were submitted.
+The jobs are kept in memory, up to the given number of finished jobs.
+*/
+type Queue struct {
+	mutex      sync.Mutex
+	jobs       []*Job
+	pending    chan *Job
+	done       chan struct{}
+	closed     bool
+	lastId     int64
+	maxHistory int
+}
+
+func NewQueue(maxPending int, maxHistory int) *Queue {
+	queue := &Queue{
+		jobs:       []*Job{},
+		pending:    make(chan *Job, maxPending),
+		done:       make(chan struct{}),
+		maxHistory: maxHistory,
+	}
+
+	go queue.work()
+	return queue
+}
+
+func (queue *Queue) work() {
+	defer close(queue.done)
+
+	for job := range queue.pending {
+		queue.mutex.Lock()
+		if job.Status == JOB_CANCELLED {
+			queue.mutex.Unlock()
+			continue
+		}
+		started := time.Now()
+		job.Started = &started
+		job.Status = JOB_RUNNING
+		queue.mutex.Unlock()
+
+		result, runErr := job.run()
+
+		queue.mutex.Lock()
+		finished := time.Now()
+		job.Finished = &finished
+		job.Result = result
+		job.Status = JOB_SUCCEEDED
+		if runErr != nil {
+			job.Status = JOB_FAILED
+			job.Error = runErr.Error()
+		}
+		queue.trim()
+		queue.mutex.Unlock()
+	}
+}
+
+//Removes the oldest finished jobs exceeding the history. Jobs that are queued or running are always kept.
+func (queue *Queue) trim() {
+	finished := 0
+	for _, job := range queue.jobs {
+		if job.isDone() {
+			finished += 1
+		}
+	}
+
+	kept := []*Job{}
+	for _, job := range queue.jobs {
+		if job.isDone() && finished > queue.maxHistory {
+			finished -= 1
+			continue
+		}
+		kept = append(kept, job)
+	}
+	queue.jobs = kept
+}
+
+/*
+Queues a job. Fails if too many jobs are already pending or if the queue is closed.
+*/
+func (queue *Queue) Submit(command string, target string, run JobFn) (Job, error) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if queue.closed {
+		return Job{}, errors.New("The queue no longer accepts jobs")
+	}
+
+	queue.lastId += 1
+	job := &Job{
+		Id:      strconv.FormatInt(queue.lastId, 10),
+		Command: command,
+		Target:  target,
+		Status:  JOB_QUEUED,
+		Created: time.Now(),
+		run:     run,
+	}
+
+	select {
+	case queue.pending <- job:
+	default:
+		return Job{}, errors.New("Too many jobs are pending")
+	}
+
+	queue.jobs = append(queue.jobs, job)
+	return *job, nil
+}
+
+func (queue *Queue) Get(id string) (Job, bool) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	for _, job := range queue.jobs {
+		if job.Id == id {
+			return *job, true
+		}
+	}
+
+	return Job{}, false
+}
+
+/*
+Returns the jobs from the oldest to the most recent
+*/
+func (queue *Queue) List() []Job {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	jobs := []Job{}
+	for _, job := range queue.jobs {
+		jobs = append(jobs, *job)
+	}
+
+	return jobs
+}
+
+/*
+Stops accepting jobs, cancels the jobs that are still queued and waits for the running job to complete
+*/
+func (queue *Queue) Close() {
+	queue.mutex.Lock()
+	if !queue.closed {
+		queue.closed = true
+		close(queue.pending)
+
+		finished := time.Now()
+		for _, job := range queue.jobs {
+			if job.Status == JOB_QUEUED {
+				job.Status = JOB_CANCELLED
+				job.Finished = &finished
+				job.Error = "The queue was closed before the job started"
+			}
+		}
+		queue.trim()
+	}
+	queue.mutex.Unlock()
+
+	<-queue.done
+}
@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	queue := NewQueue(10, 2)
+
+	var running int32
+	var overlaps int32
+	run := func(fail bool) JobFn {
+		return func() (interface{}, error) {
+			if atomic.AddInt32(&running, 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+
+			if fail {
+				return nil, errors.New("failed")
+			}
+			return "done", nil
+		}
+	}
+
+	first, submitErr := queue.Submit("backup", "a", run(false))
+	if submitErr != nil || first.Status != JOB_QUEUED {
+		t.Errorf("Expected the job to be queued. Got %+v, %v", first, submitErr)
+	}
+	queue.Submit("verify", "a", run(true))
+	last, _ := queue.Submit("backup", "b", run(false))
+	for job, _ := queue.Get(last.Id); !job.isDone(); job, _ = queue.Get(last.Id) {
+		time.Sleep(time.Millisecond)
+	}
+	queue.Close()
+
+	if overlaps != 0 {
+		t.Errorf("Expected the jobs to run one at a time")
+	}
+
+	if _, found := queue.Get(first.Id); found {
+		t.Errorf("Expected the oldest finished job to be removed from the history")
+	}
+
+	jobs := queue.List()
+	if len(jobs) != 2 || jobs[0].Status != JOB_FAILED || jobs[0].Error != "failed" || jobs[1].Id != last.Id || jobs[1].Status != JOB_SUCCEEDED || jobs[1].Result != "done" {
+		t.Errorf("Expected the 2 most recent jobs with their outcome. Got %+v", jobs)
+	}
+
+	_, submitErr = queue.Submit("backup", "a", run(false))
+	if submitErr == nil {
+		t.Errorf("Expected a closed queue to refuse jobs")
+	}
+}
+
+func TestQueueCloseCancelsQueuedJobs(t *testing.T) {
+	queue := NewQueue(10, 10)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	running, _ := queue.Submit("backup", "a", func() (interface{}, error) {
+		close(started)
+		<-release
+		return "done", nil
+	})
+	var ran int32
+	queued, _ := queue.Submit("backup", "b", func() (interface{}, error) {
+		atomic.AddInt32(&ran, 1)
+		return "done", nil
+	})
+
+	<-started
+	closed := make(chan struct{})
+	go func() {
+		queue.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Errorf("Expected closing the queue to wait for the running job")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+
+	if ran != 0 {
+		t.Errorf("Expected the queued job not to run once the queue is closed")
+	}
+
+	job, _ := queue.Get(running.Id)
+	if job.Status != JOB_SUCCEEDED {
+		t.Errorf("Expected the running job to complete. Got %+v", job)
+	}
+
+	job, _ = queue.Get(queued.Id)
+	if job.Status != JOB_CANCELLED || job.Finished == nil || job.Error == "" {
+		t.Errorf("Expected the queued job to be cancelled. Got %+v", job)
+	}
+}
@@ -0,0 +1,133 @@
+package keyspace
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-sdk/client"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+/*
+Change to a key as reported by the etcd watch stream.
+For deletions, the mod revision is the revision of the deletion.
+The time is when the change was received from the watch stream, as etcd does not record when changes are made.
+*/
+type ChangeRecord struct {
+	Deleted bool      `json:"deleted"`
+	Time    time.Time `json:"time"`
+	KeyRecord
+}
+
+type ChangeBatch struct {
+	Changes []ChangeRecord
+	Error   error
+}
+
+/*
+Watches the whole key space from the given revision and reports the changes in batches, in revision order.
+The channel is closed once the client's context is cancelled or after an error is reported.
+*/
+func WatchChanges(cli *client.EtcdClient, fromRevision int64) <-chan ChangeBatch {
+	outChan := make(chan ChangeBatch)
+
+	go func() {
+		defer close(outChan)
+
+		wc := cli.Client.Watch(cli.Context, "", clientv3.WithPrefix(), clientv3.WithRev(fromRevision))
+		for res := range wc {
+			err := res.Err()
+			if err != nil {
+				outChan <- ChangeBatch{Error: errors.New(fmt.Sprintf("Failed to watch changes: %s", err.Error()))}
+				return
+			}
+
+			batch := ChangeBatch{Changes: []ChangeRecord{}}
+			received := time.Now().UTC()
+			for _, ev := range res.Events {
+				batch.Changes = append(batch.Changes, ChangeRecord{
+					Deleted: ev.Type == mvccpb.DELETE,
+					Time:    received,
+					KeyRecord: KeyRecord{
+						Key:            string(ev.Kv.Key),
+						Value:          ev.Kv.Value,
+						Lease:          ev.Kv.Lease,
+						CreateRevision: ev.Kv.CreateRevision,
+						ModRevision:    ev.Kv.ModRevision,
+						Version:        ev.Kv.Version,
+					},
+				})
+			}
+
+			outChan <- batch
+		}
+	}()
+
+	return outChan
+}
+
+/*
+Returns the changes that were received until the given time, which follow each other in revision order, and whether later changes were left out.
+*/
+func ChangesUntil(changes []ChangeRecord, until time.Time) ([]ChangeRecord, bool) {
+	for idx, change := range changes {
+		if change.Time.After(until) {
+			return changes[:idx], true
+		}
+	}
+
+	return changes, false
+}
+
+/*
+Serializes changes as a gzip compressed stream of json lines
+*/
+func EncodeChangeSegment(changes []ChangeRecord) ([]byte, error) {
+	var buf bytes.Buffer
+
+	gzWriter := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gzWriter)
+	for _, change := range changes {
+		encErr := enc.Encode(change)
+		if encErr != nil {
+			return nil, encErr
+		}
+	}
+
+	closeErr := gzWriter.Close()
+	if closeErr != nil {
+		return nil, closeErr
+	}
+
+	return buf.Bytes(), nil
+}
+
+func DecodeChangeSegment(source io.Reader) ([]ChangeRecord, error) {
+	changes := []ChangeRecord{}
+
+	gzReader, gzErr := gzip.NewReader(source)
+	if gzErr != nil {
+		return changes, gzErr
+	}
+	defer gzReader.Close()
+
+	dec := json.NewDecoder(gzReader)
+	for {
+		var change ChangeRecord
+		decErr := dec.Decode(&change)
+		if decErr != nil {
+			if decErr == io.EOF {
+				return changes, nil
+			}
+			return changes, decErr
+		}
+
+		changes = append(changes, change)
+	}
+}
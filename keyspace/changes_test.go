@@ -0,0 +1,58 @@
+package keyspace
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestChangeSegment(t *testing.T) {
+	changes := []ChangeRecord{
+		ChangeRecord{Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), KeyRecord: KeyRecord{Key: "/a", Value: []byte("1"), CreateRevision: 5, ModRevision: 5, Version: 1}},
+		ChangeRecord{Deleted: true, KeyRecord: KeyRecord{Key: "/b", ModRevision: 6}},
+	}
+
+	segment, encErr := EncodeChangeSegment(changes)
+	if encErr != nil {
+		t.Errorf("Error encoding change segment: %s", encErr.Error())
+		return
+	}
+
+	decoded, decErr := DecodeChangeSegment(bytes.NewReader(segment))
+	if decErr != nil {
+		t.Errorf("Error decoding change segment: %s", decErr.Error())
+		return
+	}
+
+	if len(decoded) != 2 {
+		t.Errorf("Expected 2 changes to be decoded and got %d", len(decoded))
+		return
+	}
+
+	if decoded[0].Deleted || decoded[0].Key != "/a" || string(decoded[0].Value) != "1" || decoded[0].ModRevision != 5 || (!decoded[0].Time.Equal(changes[0].Time)) {
+		t.Errorf("Unexpected first decoded change: %+v", decoded[0])
+	}
+
+	if (!decoded[1].Deleted) || decoded[1].Key != "/b" || decoded[1].ModRevision != 6 {
+		t.Errorf("Unexpected second decoded change: %+v", decoded[1])
+	}
+}
+
+func TestChangesUntil(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	changes := []ChangeRecord{
+		ChangeRecord{Time: start.Add(-time.Second), KeyRecord: KeyRecord{Key: "/a", ModRevision: 5}},
+		ChangeRecord{Time: start, KeyRecord: KeyRecord{Key: "/b", ModRevision: 6}},
+		ChangeRecord{Time: start.Add(time.Second), KeyRecord: KeyRecord{Key: "/c", ModRevision: 7}},
+	}
+
+	until, cut := ChangesUntil(changes, start)
+	if (!cut) || len(until) != 2 || until[1].Key != "/b" {
+		t.Errorf("Expected the changes received after the time to be left out. Got %+v, %t", until, cut)
+	}
+
+	until, cut = ChangesUntil(changes, start.Add(time.Minute))
+	if cut || len(until) != 3 {
+		t.Errorf("Expected all the changes to be kept. Got %+v, %t", until, cut)
+	}
+}
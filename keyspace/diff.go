@@ -0,0 +1,126 @@
+package keyspace
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+/*
+Map of key records indexed by key.
+It implements the Encoder interface so that exports can be collected in memory.
+*/
+type RecordMap map[string]KeyRecord
+
+func (records RecordMap) Encode(record KeyRecord) error {
+	records[record.Key] = record
+	return nil
+}
+
+type PrefixDiff struct {
+	Prefix   string   `json:"prefix"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+type DiffSummary struct {
+	Added     int64 `json:"added"`
+	Removed   int64 `json:"removed"`
+	Modified  int64 `json:"modified"`
+	Unchanged int64 `json:"unchanged"`
+}
+
+type KeySpaceDiff struct {
+	Prefixes []PrefixDiff `json:"prefixes"`
+	Summary  DiffSummary  `json:"summary"`
+}
+
+func (diff *KeySpaceDiff) IsEmpty() bool {
+	return diff.Summary.Added == 0 && diff.Summary.Removed == 0 && diff.Summary.Modified == 0
+}
+
+/*
+Returns the prefix made of the first depth segments of a '/' separated key, including the trailing separator.
+Keys with fewer segments are grouped under the prefix of their parent.
+*/
+func GroupPrefix(key string, depth int) string {
+	if depth <= 0 {
+		return ""
+	}
+
+	start := 0
+	if strings.HasPrefix(key, "/") {
+		start = 1
+	}
+
+	pos := start - 1
+	for idx := 0; idx < depth; idx++ {
+		next := strings.Index(key[pos+1:], "/")
+		if next == -1 {
+			return key[:strings.LastIndex(key, "/")+1]
+		}
+		pos = pos + 1 + next
+	}
+
+	return key[:pos+1]
+}
+
+/*
+Computes the keys that were added, removed or modified going from the source to the destination key space.
+Keys are considered modified if their value changed. Results are grouped by key prefix of the given depth.
+*/
+func Diff(src map[string]KeyRecord, dst map[string]KeyRecord, groupDepth int) KeySpaceDiff {
+	groups := map[string]*PrefixDiff{}
+	summary := DiffSummary{}
+
+	getGroup := func(key string) *PrefixDiff {
+		prefix := GroupPrefix(key, groupDepth)
+		group, ok := groups[prefix]
+		if !ok {
+			group = &PrefixDiff{Prefix: prefix, Added: []string{}, Removed: []string{}, Modified: []string{}}
+			groups[prefix] = group
+		}
+		return group
+	}
+
+	for key, srcRecord := range src {
+		dstRecord, ok := dst[key]
+		if !ok {
+			group := getGroup(key)
+			group.Removed = append(group.Removed, key)
+			summary.Removed += 1
+			continue
+		}
+
+		if !bytes.Equal(srcRecord.Value, dstRecord.Value) {
+			group := getGroup(key)
+			group.Modified = append(group.Modified, key)
+			summary.Modified += 1
+			continue
+		}
+
+		summary.Unchanged += 1
+	}
+
+	for key := range dst {
+		if _, ok := src[key]; !ok {
+			group := getGroup(key)
+			group.Added = append(group.Added, key)
+			summary.Added += 1
+		}
+	}
+
+	diff := KeySpaceDiff{Prefixes: []PrefixDiff{}, Summary: summary}
+	for _, group := range groups {
+		sort.Strings(group.Added)
+		sort.Strings(group.Removed)
+		sort.Strings(group.Modified)
+		diff.Prefixes = append(diff.Prefixes, *group)
+	}
+	sort.Slice(diff.Prefixes, func(i, j int) bool {
+		return diff.Prefixes[i].Prefix < diff.Prefixes[j].Prefix
+	})
+
+	return diff
+}
@@ -0,0 +1,72 @@
+package keyspace
+
+import (
+	"testing"
+)
+
+func TestGroupPrefix(t *testing.T) {
+	cases := []struct {
+		key      string
+		depth    int
+		expected string
+	}{
+		{"/registry/pods/default/a", 1, "/registry/"},
+		{"/registry/pods/default/a", 2, "/registry/pods/"},
+		{"/registry/pods/default/a", 5, "/registry/pods/default/"},
+		{"/registry", 1, "/"},
+		{"config/db", 1, "config/"},
+		{"config", 1, ""},
+		{"/registry/pods", 0, ""},
+	}
+
+	for _, c := range cases {
+		prefix := GroupPrefix(c.key, c.depth)
+		if prefix != c.expected {
+			t.Errorf("Expected prefix of '%s' at depth %d to be '%s' and it was '%s'", c.key, c.depth, c.expected, prefix)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	src := map[string]KeyRecord{
+		"/a/unchanged": KeyRecord{Key: "/a/unchanged", Value: []byte("1"), ModRevision: 2},
+		"/a/modified":  KeyRecord{Key: "/a/modified", Value: []byte("1")},
+		"/a/removed":   KeyRecord{Key: "/a/removed", Value: []byte("1")},
+		"/b/removed":   KeyRecord{Key: "/b/removed", Value: []byte("1")},
+	}
+	dst := map[string]KeyRecord{
+		"/a/unchanged": KeyRecord{Key: "/a/unchanged", Value: []byte("1"), ModRevision: 9},
+		"/a/modified":  KeyRecord{Key: "/a/modified", Value: []byte("2")},
+		"/c/added":     KeyRecord{Key: "/c/added", Value: []byte("1")},
+	}
+
+	diff := Diff(src, dst, 1)
+
+	if diff.Summary.Added != 1 || diff.Summary.Removed != 2 || diff.Summary.Modified != 1 || diff.Summary.Unchanged != 1 {
+		t.Errorf("Unexpected diff summary: %+v", diff.Summary)
+	}
+
+	if len(diff.Prefixes) != 3 {
+		t.Errorf("Expected 3 prefixes in the diff and got %d", len(diff.Prefixes))
+		return
+	}
+
+	a := diff.Prefixes[0]
+	if a.Prefix != "/a/" || len(a.Modified) != 1 || a.Modified[0] != "/a/modified" || len(a.Removed) != 1 || a.Removed[0] != "/a/removed" || len(a.Added) != 0 {
+		t.Errorf("Unexpected diff for prefix '/a/': %+v", a)
+	}
+
+	c := diff.Prefixes[2]
+	if c.Prefix != "/c/" || len(c.Added) != 1 || c.Added[0] != "/c/added" {
+		t.Errorf("Unexpected diff for prefix '/c/': %+v", c)
+	}
+
+	if diff.IsEmpty() {
+		t.Errorf("Expected diff not to be empty")
+	}
+
+	noDiff := Diff(src, src, 1)
+	if !noDiff.IsEmpty() {
+		t.Errorf("Expected diff of a key space with itself to be empty")
+	}
+}
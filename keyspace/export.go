@@ -0,0 +1,84 @@
+package keyspace
+
+import (
+	"context"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-sdk/client"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func GetPrefixRange(prefix string) (string, string) {
+	if prefix == "" {
+		return "\x00", "\x00"
+	}
+
+	return prefix, clientv3.GetPrefixRangeEnd(prefix)
+}
+
+func getPageWithRetries(cli *client.EtcdClient, key string, rangeEnd string, revision int64, pageSize int64, retries uint64) (*clientv3.GetResponse, error) {
+	ctx, cancel := context.WithTimeout(cli.Context, cli.RequestTimeout)
+	defer cancel()
+
+	opts := []clientv3.OpOption{clientv3.WithRange(rangeEnd), clientv3.WithLimit(pageSize)}
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision))
+	}
+
+	res, err := cli.Client.Get(ctx, key, opts...)
+	if err != nil {
+		if retries == 0 || (!client.ErrorIsRetryable(err)) {
+			return nil, err
+		}
+
+		time.Sleep(cli.RetryInterval)
+		return getPageWithRetries(cli, key, rangeEnd, revision, pageSize, retries-1)
+	}
+
+	return res, nil
+}
+
+/*
+Walks the keys under each of the given prefixes, a page at a time, and passes them to the encoder.
+All the pages are read at the same store revision so that the export is consistent. That revision is returned.
+*/
+func Export(cli *client.EtcdClient, prefixes []string, enc Encoder, pageSize int64) (int64, error) {
+	revision := int64(0)
+
+	for _, prefix := range prefixes {
+		key, rangeEnd := GetPrefixRange(prefix)
+
+		for {
+			res, resErr := getPageWithRetries(cli, key, rangeEnd, revision, pageSize, cli.Retries)
+			if resErr != nil {
+				return revision, resErr
+			}
+
+			if revision == 0 {
+				revision = res.Header.Revision
+			}
+
+			for _, kv := range res.Kvs {
+				encErr := enc.Encode(KeyRecord{
+					Key:            string(kv.Key),
+					Value:          kv.Value,
+					Lease:          kv.Lease,
+					CreateRevision: kv.CreateRevision,
+					ModRevision:    kv.ModRevision,
+					Version:        kv.Version,
+				})
+				if encErr != nil {
+					return revision, encErr
+				}
+			}
+
+			if (!res.More) || len(res.Kvs) == 0 {
+				break
+			}
+
+			key = string(res.Kvs[len(res.Kvs)-1].Key) + "\x00"
+		}
+	}
+
+	return revision, nil
+}
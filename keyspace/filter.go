@@ -0,0 +1,45 @@
+package keyspace
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+/*
+Selection of keys by prefixes or glob patterns (as supported by path.Match).
+A key is selected if it matches any prefix or any pattern. All keys are selected if both are empty.
+*/
+type KeySelector struct {
+	Prefixes []string
+	Globs    []string
+}
+
+func (sel *KeySelector) Validate() error {
+	for _, glob := range sel.Globs {
+		_, err := path.Match(glob, "")
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid glob pattern '%s': %s", glob, err.Error()))
+		}
+	}
+
+	return nil
+}
+
+func (sel *KeySelector) Matches(key string) bool {
+	if len(sel.Prefixes) == 0 && len(sel.Globs) == 0 {
+		return true
+	}
+
+	if len(sel.Prefixes) > 0 && MatchesPrefixes(key, sel.Prefixes) {
+		return true
+	}
+
+	for _, glob := range sel.Globs {
+		if matched, _ := path.Match(glob, key); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,151 @@
+package keyspace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+const (
+	FORMAT_JSONL    = "jsonl"
+	FORMAT_PROTOBUF = "protobuf"
+)
+
+//Maximum size of a single protobuf record, well above etcd's default request size limit
+const maxProtobufRecordSize = 64 * 1024 * 1024
+
+type KeyRecord struct {
+	Key            string `json:"key"`
+	Value          []byte `json:"value"`
+	Lease          int64  `json:"lease"`
+	CreateRevision int64  `json:"create_revision"`
+	ModRevision    int64  `json:"mod_revision"`
+	Version        int64  `json:"version"`
+}
+
+type Encoder interface {
+	Encode(record KeyRecord) error
+}
+
+type Decoder interface {
+	//Returns io.EOF once all the records have been read
+	Decode() (KeyRecord, error)
+}
+
+func ValidateFormat(format string) error {
+	if format != FORMAT_JSONL && format != FORMAT_PROTOBUF {
+		return errors.New(fmt.Sprintf("Unsupported key export format '%s'. Valid formats are '%s' and '%s'", format, FORMAT_JSONL, FORMAT_PROTOBUF))
+	}
+
+	return nil
+}
+
+type jsonlEncoder struct {
+	encoder *json.Encoder
+}
+
+func (enc *jsonlEncoder) Encode(record KeyRecord) error {
+	return enc.encoder.Encode(record)
+}
+
+type jsonlDecoder struct {
+	decoder *json.Decoder
+}
+
+func (dec *jsonlDecoder) Decode() (KeyRecord, error) {
+	var record KeyRecord
+	err := dec.decoder.Decode(&record)
+	return record, err
+}
+
+type protobufEncoder struct {
+	dest io.Writer
+}
+
+func (enc *protobufEncoder) Encode(record KeyRecord) error {
+	kv := mvccpb.KeyValue{
+		Key:            []byte(record.Key),
+		Value:          record.Value,
+		Lease:          record.Lease,
+		CreateRevision: record.CreateRevision,
+		ModRevision:    record.ModRevision,
+		Version:        record.Version,
+	}
+
+	payload, marshalErr := kv.Marshal()
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	sizePrefix := make([]byte, binary.MaxVarintLen64)
+	sizePrefixLen := binary.PutUvarint(sizePrefix, uint64(len(payload)))
+
+	_, wrErr := enc.dest.Write(append(sizePrefix[:sizePrefixLen], payload...))
+	return wrErr
+}
+
+type protobufDecoder struct {
+	source *bufio.Reader
+}
+
+func (dec *protobufDecoder) Decode() (KeyRecord, error) {
+	size, sizeErr := binary.ReadUvarint(dec.source)
+	if sizeErr != nil {
+		return KeyRecord{}, sizeErr
+	}
+
+	if size > maxProtobufRecordSize {
+		return KeyRecord{}, errors.New(fmt.Sprintf("Protobuf record size of %d bytes exceeds the maximum of %d bytes", size, maxProtobufRecordSize))
+	}
+
+	payload := make([]byte, size)
+	_, readErr := io.ReadFull(dec.source, payload)
+	if readErr != nil {
+		if readErr == io.EOF {
+			return KeyRecord{}, io.ErrUnexpectedEOF
+		}
+		return KeyRecord{}, readErr
+	}
+
+	var kv mvccpb.KeyValue
+	unmarshalErr := kv.Unmarshal(payload)
+	if unmarshalErr != nil {
+		return KeyRecord{}, unmarshalErr
+	}
+
+	return KeyRecord{
+		Key:            string(kv.Key),
+		Value:          kv.Value,
+		Lease:          kv.Lease,
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
+	}, nil
+}
+
+func NewEncoder(format string, dest io.Writer) (Encoder, error) {
+	switch format {
+	case FORMAT_JSONL:
+		return &jsonlEncoder{encoder: json.NewEncoder(dest)}, nil
+	case FORMAT_PROTOBUF:
+		return &protobufEncoder{dest: dest}, nil
+	}
+
+	return nil, ValidateFormat(format)
+}
+
+func NewDecoder(format string, source io.Reader) (Decoder, error) {
+	switch format {
+	case FORMAT_JSONL:
+		return &jsonlDecoder{decoder: json.NewDecoder(source)}, nil
+	case FORMAT_PROTOBUF:
+		return &protobufDecoder{source: bufio.NewReader(source)}, nil
+	}
+
+	return nil, ValidateFormat(format)
+}
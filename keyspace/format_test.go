@@ -0,0 +1,94 @@
+package keyspace
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	records := []KeyRecord{
+		KeyRecord{Key: "/registry/pods/default/a", Value: []byte("pod a"), CreateRevision: 2, ModRevision: 5, Version: 3},
+		KeyRecord{Key: "/registry/pods/default/b", Value: []byte{0x00, 0xff, 0x7b}, Lease: 42, CreateRevision: 7, ModRevision: 7, Version: 1},
+		KeyRecord{Key: "/config/empty", Value: []byte{}, CreateRevision: 8, ModRevision: 8, Version: 1},
+	}
+
+	for _, format := range []string{FORMAT_JSONL, FORMAT_PROTOBUF} {
+		var buf bytes.Buffer
+
+		enc, encErr := NewEncoder(format, &buf)
+		if encErr != nil {
+			t.Errorf("Error creating %s encoder: %s", format, encErr.Error())
+			return
+		}
+
+		for _, record := range records {
+			wrErr := enc.Encode(record)
+			if wrErr != nil {
+				t.Errorf("Error encoding %s record: %s", format, wrErr.Error())
+				return
+			}
+		}
+
+		dec, decErr := NewDecoder(format, &buf)
+		if decErr != nil {
+			t.Errorf("Error creating %s decoder: %s", format, decErr.Error())
+			return
+		}
+
+		for _, expected := range records {
+			record, rdErr := dec.Decode()
+			if rdErr != nil {
+				t.Errorf("Error decoding %s record: %s", format, rdErr.Error())
+				return
+			}
+
+			if record.Key != expected.Key || (!bytes.Equal(record.Value, expected.Value)) || record.Lease != expected.Lease || record.CreateRevision != expected.CreateRevision || record.ModRevision != expected.ModRevision || record.Version != expected.Version {
+				t.Errorf("Decoded %s record %+v did not match the encoded record %+v", format, record, expected)
+				return
+			}
+		}
+
+		_, endErr := dec.Decode()
+		if endErr != io.EOF {
+			t.Errorf("Expected end of %s stream to return io.EOF and it returned: %v", format, endErr)
+			return
+		}
+	}
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	_, encErr := NewEncoder("xml", &bytes.Buffer{})
+	if encErr == nil {
+		t.Errorf("Expected an error when creating an encoder for an unsupported format")
+	}
+}
+
+func TestRemapKey(t *testing.T) {
+	remaps := []PrefixRemap{
+		PrefixRemap{From: "/app/", To: "/restored/"},
+		PrefixRemap{From: "/app/config/", To: "/config/"},
+	}
+
+	if key := RemapKey("/app/config/db", remaps); key != "/config/db" {
+		t.Errorf("Expected longest prefix to be remapped. Got '%s'", key)
+	}
+
+	if key := RemapKey("/app/state", remaps); key != "/restored/state" {
+		t.Errorf("Expected '/app/' prefix to be remapped. Got '%s'", key)
+	}
+
+	if key := RemapKey("/other/state", remaps); key != "/other/state" {
+		t.Errorf("Expected key without matching prefix to be unchanged. Got '%s'", key)
+	}
+
+	remap, remapErr := ParsePrefixRemap("/a/=/b/")
+	if remapErr != nil || remap.From != "/a/" || remap.To != "/b/" {
+		t.Errorf("Expected '/a/=/b/' to parse as a remapping. Got %+v, %v", remap, remapErr)
+	}
+
+	_, remapErr = ParsePrefixRemap("/a/")
+	if remapErr == nil {
+		t.Errorf("Expected remapping without '=' to fail parsing")
+	}
+}
@@ -0,0 +1,105 @@
+package keyspace
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Ferlab-Ste-Justine/etcd-sdk/client"
+)
+
+type PrefixRemap struct {
+	From string
+	To   string
+}
+
+func ParsePrefixRemap(remap string) (PrefixRemap, error) {
+	parts := strings.SplitN(remap, "=", 2)
+	if len(parts) != 2 {
+		return PrefixRemap{}, errors.New(fmt.Sprintf("Prefix remapping '%s' is not of the format '<source prefix>=<destination prefix>'", remap))
+	}
+
+	return PrefixRemap{From: parts[0], To: parts[1]}, nil
+}
+
+func MatchesPrefixes(key string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Returns the key with the longest matching source prefix replaced by its destination prefix.
+Keys not matching any remapping are returned unchanged.
+*/
+func RemapKey(key string, remaps []PrefixRemap) string {
+	matched := -1
+	for idx, remap := range remaps {
+		if strings.HasPrefix(key, remap.From) && (matched == -1 || len(remap.From) > len(remaps[matched].From)) {
+			matched = idx
+		}
+	}
+
+	if matched == -1 {
+		return key
+	}
+
+	return remaps[matched].To + strings.TrimPrefix(key, remaps[matched].From)
+}
+
+type ImportOptions struct {
+	//Only keys matching one of the prefixes are imported. All keys are imported if empty.
+	Prefixes []string
+	//Prefix remappings applied to the imported keys
+	Remaps   []PrefixRemap
+	//If true, the keys will be reported but not written
+	DryRun   bool
+	//Callback called for each imported key with the record as it was read and the destination key
+	OnImport func(record KeyRecord, destKey string)
+}
+
+/*
+Writes the records read from the decoder back into the etcd cluster.
+Leases are not carried over as the leases of the exported cluster are unlikely to exist in the destination.
+Returns the number of imported keys.
+*/
+func Import(cli *client.EtcdClient, dec Decoder, opts ImportOptions) (int64, error) {
+	count := int64(0)
+
+	for {
+		record, decErr := dec.Decode()
+		if decErr != nil {
+			if decErr == io.EOF {
+				return count, nil
+			}
+			return count, decErr
+		}
+
+		if !MatchesPrefixes(record.Key, opts.Prefixes) {
+			continue
+		}
+
+		destKey := RemapKey(record.Key, opts.Remaps)
+		if !opts.DryRun {
+			_, putErr := cli.PutKey(destKey, string(record.Value))
+			if putErr != nil {
+				return count, errors.New(fmt.Sprintf("Error writing key '%s': %s", destKey, putErr.Error()))
+			}
+		}
+
+		if opts.OnImport != nil {
+			opts.OnImport(record, destKey)
+		}
+
+		count += 1
+	}
+}
@@ -0,0 +1,39 @@
+package keyspace
+
+import (
+	"context"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-sdk/client"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func putIfNotModifiedSinceWithRetries(cli *client.EtcdClient, record KeyRecord, revision int64, retries uint64) (bool, error) {
+	ctx, cancel := context.WithTimeout(cli.Context, cli.RequestTimeout)
+	defer cancel()
+
+	res, err := cli.Client.Txn(ctx).If(
+		clientv3.Compare(clientv3.ModRevision(record.Key), "<=", revision),
+	).Then(
+		clientv3.OpPut(record.Key, string(record.Value)),
+	).Commit()
+	if err != nil {
+		if retries == 0 || (!client.ErrorIsRetryable(err)) {
+			return false, err
+		}
+
+		time.Sleep(cli.RetryInterval)
+		return putIfNotModifiedSinceWithRetries(cli, record, revision, retries-1)
+	}
+
+	return res.Succeeded, nil
+}
+
+/*
+Writes the record's value in its key unless the key was modified after the given revision.
+Keys that were deleted since are written back.
+Returns whether the key was written.
+*/
+func PutIfNotModifiedSince(cli *client.EtcdClient, record KeyRecord, revision int64) (bool, error) {
+	return putIfNotModifiedSinceWithRetries(cli, record, revision, cli.Retries)
+}
@@ -0,0 +1,143 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-sdk/client"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+/*
+Lock stored in a key of the etcd cluster, attached to a lease which removes the key when it expires
+*/
+type EtcdBackend struct {
+	cli   *client.EtcdClient
+	key   string
+	ttl   time.Duration
+	lease clientv3.LeaseID
+}
+
+func NewEtcdBackend(cli *client.EtcdClient, key string, ttl time.Duration) *EtcdBackend {
+	return &EtcdBackend{cli: cli, key: key, ttl: ttl}
+}
+
+func (backend *EtcdBackend) revoke(lease clientv3.LeaseID) error {
+	ctx, cancel := context.WithTimeout(backend.cli.Context, backend.cli.RequestTimeout)
+	defer cancel()
+
+	_, revokeErr := backend.cli.Client.Revoke(ctx, lease)
+	return revokeErr
+}
+
+func (backend *EtcdBackend) TryAcquire(holder Holder) (Holder, bool, error) {
+	value, marshalErr := json.Marshal(holder)
+	if marshalErr != nil {
+		return holder, false, marshalErr
+	}
+
+	ctx, cancel := context.WithTimeout(backend.cli.Context, backend.cli.RequestTimeout)
+	defer cancel()
+
+	//The resolution of leases is the second
+	grant, grantErr := backend.cli.Client.Grant(ctx, int64(math.Ceil(backend.ttl.Seconds())))
+	if grantErr != nil {
+		return holder, false, grantErr
+	}
+
+	txResp, txErr := backend.cli.Client.Txn(ctx).If(
+		clientv3.Compare(clientv3.Version(backend.key), "=", 0),
+	).Then(
+		clientv3.OpPut(backend.key, string(value), clientv3.WithLease(grant.ID)),
+	).Else(
+		clientv3.OpGet(backend.key),
+	).Commit()
+	if txErr != nil {
+		backend.revoke(grant.ID)
+		return holder, false, txErr
+	}
+
+	if txResp.Succeeded {
+		backend.lease = grant.ID
+		return holder, true, nil
+	}
+
+	revokeErr := backend.revoke(grant.ID)
+	if revokeErr != nil {
+		return holder, false, revokeErr
+	}
+
+	current := Holder{}
+	kvs := txResp.Responses[0].GetResponseRange().Kvs
+	if len(kvs) > 0 {
+		json.Unmarshal(kvs[0].Value, &current)
+	}
+
+	return current, false, nil
+}
+
+func (backend *EtcdBackend) Renew(holder Holder) error {
+	value, marshalErr := json.Marshal(holder)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	ctx, cancel := context.WithTimeout(backend.cli.Context, backend.cli.RequestTimeout)
+	defer cancel()
+
+	_, keepAliveErr := backend.cli.Client.KeepAliveOnce(ctx, backend.lease)
+	if keepAliveErr != nil {
+		return keepAliveErr
+	}
+
+	//The key may have been removed by a forced unlock
+	txResp, txErr := backend.cli.Client.Txn(ctx).If(
+		clientv3.Compare(clientv3.LeaseValue(backend.key), "=", backend.lease),
+	).Then(
+		clientv3.OpPut(backend.key, string(value), clientv3.WithLease(backend.lease)),
+	).Commit()
+	if txErr != nil {
+		return txErr
+	}
+
+	if !txResp.Succeeded {
+		return errors.New("The lock is no longer held")
+	}
+
+	return nil
+}
+
+func (backend *EtcdBackend) Release() error {
+	if backend.lease == clientv3.NoLease {
+		return nil
+	}
+
+	revokeErr := backend.revoke(backend.lease)
+	if revokeErr != nil {
+		return revokeErr
+	}
+
+	backend.lease = clientv3.NoLease
+	return nil
+}
+
+func (backend *EtcdBackend) ForceUnlock() (Holder, bool, error) {
+	ctx, cancel := context.WithTimeout(backend.cli.Context, backend.cli.RequestTimeout)
+	defer cancel()
+
+	delResp, delErr := backend.cli.Client.Delete(ctx, backend.key, clientv3.WithPrevKV())
+	if delErr != nil {
+		return Holder{}, false, delErr
+	}
+
+	if len(delResp.PrevKvs) == 0 {
+		return Holder{}, false, nil
+	}
+
+	current := Holder{}
+	json.Unmarshal(delResp.PrevKvs[0].Value, &current)
+	return current, true, nil
+}
@@ -0,0 +1,198 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+)
+
+const (
+	LOCK_BACKEND_NONE = "none"
+	LOCK_BACKEND_S3   = "s3"
+	LOCK_BACKEND_ETCD = "etcd"
+)
+
+func ValidateBackend(backend string) error {
+	if backend != LOCK_BACKEND_NONE && backend != LOCK_BACKEND_S3 && backend != LOCK_BACKEND_ETCD {
+		return errors.New(fmt.Sprintf("Unsupported lock backend '%s'", backend))
+	}
+
+	return nil
+}
+
+/*
+Description of the process holding a lock, stored in the lock
+*/
+type Holder struct {
+	Id       string    `json:"id"`
+	Command  string    `json:"command"`
+	Host     string    `json:"host"`
+	Pid      int       `json:"pid"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+}
+
+func NewHolder(command string, ttl time.Duration) Holder {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	host, hostErr := os.Hostname()
+	if hostErr != nil {
+		host = "unknown"
+	}
+
+	now := time.Now().UTC()
+	return Holder{
+		Id:       hex.EncodeToString(id),
+		Command:  command,
+		Host:     host,
+		Pid:      os.Getpid(),
+		Acquired: now,
+		Expires:  now.Add(ttl),
+	}
+}
+
+func (holder *Holder) IsExpired(now time.Time) bool {
+	return now.After(holder.Expires)
+}
+
+func (holder *Holder) String() string {
+	return fmt.Sprintf("%s (pid %d on %s) since %s until %s", holder.Command, holder.Pid, holder.Host, holder.Acquired.Format(time.RFC3339), holder.Expires.Format(time.RFC3339))
+}
+
+/*
+Storage of a lock whose lease expires unless it is renewed
+*/
+type Backend interface {
+	//Takes the lock for the holder if it is free or its lease expired. Otherwise, returns the current holder
+	TryAcquire(holder Holder) (Holder, bool, error)
+	//Extends the lease of the lock up to the expiry of the holder. Fails if the lock was lost
+	Renew(holder Holder) error
+	Release() error
+	//Removes the lock regardless of its holder, returning the holder if the lock was held
+	ForceUnlock() (Holder, bool, error)
+}
+
+/*
+Error returned when the lock is still held by another process once the acquisition times out
+*/
+type HeldError struct {
+	Holder Holder
+}
+
+func (err *HeldError) Error() string {
+	return fmt.Sprintf("The lock is held by %s", err.Holder.String())
+}
+
+/*
+Acquires the lock for the command, retrying at the configured interval until the configured timeout.
+A timeout of 0 fails right away if the lock is held. The wait function is called when the lock is first found to be held.
+*/
+func Acquire(backend Backend, lockConf config.LockConfig, command string, onWait func(holder Holder)) (Holder, error) {
+	holder := NewHolder(command, lockConf.Ttl)
+	deadline := time.Now().Add(lockConf.Timeout)
+	waiting := false
+
+	for {
+		current, acquired, acquireErr := backend.TryAcquire(holder)
+		if acquireErr != nil {
+			return holder, acquireErr
+		}
+
+		if acquired {
+			return holder, nil
+		}
+
+		if !time.Now().Add(lockConf.RetryInterval).Before(deadline) {
+			return holder, &HeldError{Holder: current}
+		}
+
+		if !waiting {
+			waiting = true
+			onWait(current)
+		}
+
+		time.Sleep(lockConf.RetryInterval)
+		holder = NewHolder(command, lockConf.Ttl)
+	}
+}
+
+/*
+Error returned when the lease of the lock could not be renewed while the operation was running
+*/
+type LostError struct {
+	Err error
+}
+
+func (err *LostError) Error() string {
+	return fmt.Sprintf("The lock was lost while the operation was running, which was interrupted: %s", err.Err.Error())
+}
+
+func (err *LostError) Unwrap() error {
+	return err.Err
+}
+
+/*
+Acquires the lock, runs the operation while renewing the lease of the lock at a third of its duration and releases the lock.
+If the lease cannot be renewed, the context of the operation is cancelled, as another process may take the lock, and a LostError is returned.
+Failures to release the lock are passed to the warning function, they do not fail the operation.
+*/
+func Run(backend Backend, lockConf config.LockConfig, command string, onWait func(holder Holder), onWarning func(err error), operation func(ctx context.Context) error) error {
+	if lockConf.Ttl/3 <= 0 {
+		return errors.New(fmt.Sprintf("The lease of the lock is too short to be renewed: %s", lockConf.Ttl))
+	}
+
+	holder, acquireErr := Acquire(backend, lockConf, command, onWait)
+	if acquireErr != nil {
+		return acquireErr
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var lostErr error
+	done := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+
+		ticker := time.NewTicker(lockConf.Ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				holder.Expires = time.Now().UTC().Add(lockConf.Ttl)
+				renewErr := backend.Renew(holder)
+				if renewErr != nil {
+					lostErr = &LostError{Err: errors.New(fmt.Sprintf("Error renewing the lease of the lock: %s", renewErr.Error()))}
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	opErr := operation(ctx)
+	close(done)
+	<-renewed
+
+	//A lock that could not be released expires with its lease, so the outcome of the operation is kept
+	releaseErr := backend.Release()
+	if releaseErr != nil {
+		onWarning(errors.New(fmt.Sprintf("Error releasing the lock: %s", releaseErr.Error())))
+	}
+
+	if lostErr != nil {
+		return lostErr
+	}
+
+	return opErr
+}
@@ -0,0 +1,172 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+)
+
+type memoryBackend struct {
+	mutex    sync.Mutex
+	holder   *Holder
+	renewals int
+}
+
+func (backend *memoryBackend) current() *Holder {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	return backend.holder
+}
+
+func (backend *memoryBackend) TryAcquire(holder Holder) (Holder, bool, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	if backend.holder != nil && !backend.holder.IsExpired(time.Now()) {
+		return *backend.holder, false, nil
+	}
+
+	backend.holder = &holder
+	return holder, true, nil
+}
+
+func (backend *memoryBackend) Renew(holder Holder) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	if backend.holder == nil || backend.holder.Id != holder.Id {
+		return errors.New("lost")
+	}
+
+	backend.holder = &holder
+	backend.renewals += 1
+	return nil
+}
+
+func (backend *memoryBackend) Release() error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	backend.holder = nil
+	return nil
+}
+
+func (backend *memoryBackend) ForceUnlock() (Holder, bool, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	if backend.holder == nil {
+		return Holder{}, false, nil
+	}
+
+	holder := *backend.holder
+	backend.holder = nil
+	return holder, true, nil
+}
+
+func TestHolder(t *testing.T) {
+	holder := NewHolder("backup", time.Minute)
+	other := NewHolder("backup", time.Minute)
+
+	if holder.Id == other.Id {
+		t.Errorf("Expected holders to have distinct ids")
+	}
+
+	if holder.IsExpired(time.Now()) || !holder.IsExpired(time.Now().Add(2*time.Minute)) {
+		t.Errorf("Expected the holder to expire after its ttl")
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	backend := &memoryBackend{}
+	lockConf := config.LockConfig{Ttl: time.Minute, RetryInterval: 10 * time.Millisecond}
+
+	_, acquireErr := Acquire(backend, lockConf, "backup", func(holder Holder) {})
+	if acquireErr != nil {
+		t.Errorf("Expected a free lock to be acquired. Got %v", acquireErr)
+	}
+
+	waits := 0
+	_, acquireErr = Acquire(backend, lockConf, "prune", func(holder Holder) { waits += 1 })
+	var heldErr *HeldError
+	if !errors.As(acquireErr, &heldErr) || heldErr.Holder.Command != "backup" || waits != 0 {
+		t.Errorf("Expected a held lock to fail right away without a timeout. Got %v with %d waits", acquireErr, waits)
+	}
+
+	lockConf.Timeout = time.Second
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		backend.Release()
+	}()
+	holder, acquireErr := Acquire(backend, lockConf, "prune", func(holder Holder) { waits += 1 })
+	if acquireErr != nil || holder.Command != "prune" || waits != 1 {
+		t.Errorf("Expected the lock to be acquired once released. Got %v with %d waits", acquireErr, waits)
+	}
+
+	backend.holder.Expires = time.Now().Add(-time.Second)
+	_, acquireErr = Acquire(backend, config.LockConfig{Ttl: time.Minute}, "rotate-key", func(holder Holder) {})
+	if acquireErr != nil {
+		t.Errorf("Expected an expired lock to be taken over. Got %v", acquireErr)
+	}
+}
+
+func TestRun(t *testing.T) {
+	backend := &memoryBackend{}
+	lockConf := config.LockConfig{Ttl: 30 * time.Millisecond, RetryInterval: 10 * time.Millisecond}
+
+	warnings := 0
+	runErr := Run(backend, lockConf, "backup", func(holder Holder) {}, func(err error) { warnings += 1 }, func(ctx context.Context) error {
+		if holder := backend.current(); holder == nil || holder.Command != "backup" {
+			t.Errorf("Expected the lock to be held during the operation")
+		}
+		time.Sleep(100 * time.Millisecond)
+		return errors.New("failed")
+	})
+
+	if runErr == nil || runErr.Error() != "failed" {
+		t.Errorf("Expected the error of the operation to be returned. Got %v", runErr)
+	}
+
+	if backend.renewals == 0 || warnings != 0 {
+		t.Errorf("Expected the lease to be renewed during the operation. Got %d renewals and %d warnings", backend.renewals, warnings)
+	}
+
+	if backend.current() != nil {
+		t.Errorf("Expected the lock to be released after the operation")
+	}
+}
+
+func TestRunLost(t *testing.T) {
+	backend := &memoryBackend{}
+	lockConf := config.LockConfig{Ttl: 30 * time.Millisecond, RetryInterval: 10 * time.Millisecond}
+
+	runErr := Run(backend, lockConf, "prune", func(holder Holder) {}, func(err error) {}, func(ctx context.Context) error {
+		backend.ForceUnlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			t.Errorf("Expected the operation to be cancelled once the lock is lost")
+			return nil
+		}
+	})
+
+	var lostErr *LostError
+	if !errors.As(runErr, &lostErr) {
+		t.Errorf("Expected the loss of the lock to be returned. Got %v", runErr)
+	}
+
+	runErr = Run(backend, config.LockConfig{Ttl: 2 * time.Nanosecond}, "prune", func(holder Holder) {}, func(err error) {}, func(ctx context.Context) error {
+		t.Errorf("Expected the operation not to run with a lease too short to be renewed")
+		return nil
+	})
+	if runErr == nil {
+		t.Errorf("Expected a lease too short to be renewed to be an error")
+	}
+}
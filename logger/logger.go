@@ -1,6 +1,16 @@
 package logger
 
-import "log"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 const (
 	DEBUG int64 = 0
@@ -9,28 +19,150 @@ const (
 	ERROR       = 3
 )
 
+const (
+	//Message followed by its fields, prefixed by the time like the messages of the standard log package
+	FORMAT_TEXT   = "text"
+	FORMAT_JSON   = "json"
+	FORMAT_LOGFMT = "logfmt"
+)
+
+func ValidateFormat(format string) error {
+	if format != FORMAT_TEXT && format != FORMAT_JSON && format != FORMAT_LOGFMT {
+		return errors.New(fmt.Sprintf("Unsupported log format '%s'. Valid formats are '%s', '%s' and '%s'", format, FORMAT_TEXT, FORMAT_JSON, FORMAT_LOGFMT))
+	}
+
+	return nil
+}
+
+//Structured context of a message, such as the command, the target, object names, byte counts or durations
+type Fields map[string]interface{}
+
 type Logger struct {
 	LogLevel int64
+	Format   string
+	Fields   Fields
+	//Writer the messages are written to. Defaults to the standard error
+	Output io.Writer
 }
 
-func (logger Logger) Debugf(format string, args ...interface{}) {
-	if logger.LogLevel <= DEBUG {
-		log.Printf(format+"\n", args...)
+/*
+Returns a copy of the logger that adds the given fields to its messages, overriding the fields of the same name
+*/
+func (logger Logger) WithFields(fields Fields) Logger {
+	merged := Fields{}
+	for key, val := range logger.Fields {
+		merged[key] = val
+	}
+	for key, val := range fields {
+		merged[key] = val
 	}
+
+	logger.Fields = merged
+	return logger
 }
 
-func (logger Logger) Infof(format string, args ...interface{}) {
-	if logger.LogLevel <= INFO {
-		log.Printf(format+"\n", args...)
+func getLevelName(level int64) string {
+	switch level {
+	case DEBUG:
+		return "debug"
+	case WARN:
+		return "warning"
+	case ERROR:
+		return "error"
+	default:
+		return "info"
 	}
 }
 
-func (logger Logger) Warnf(format string, args ...interface{}) {
-	if logger.LogLevel <= WARN {
-		log.Printf(format+"\n", args...)
+func getSortedKeys(fields Fields) []string {
+	keys := []string{}
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatLogfmtValue(val interface{}) string {
+	str := fmt.Sprintf("%v", val)
+	if str == "" || strings.ContainsAny(str, " =\"\t\n") {
+		return strconv.Quote(str)
+	}
+
+	return str
+}
+
+func formatLogfmtFields(fields Fields) string {
+	pairs := []string{}
+	for _, key := range getSortedKeys(fields) {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, formatLogfmtValue(fields[key])))
 	}
+
+	return strings.Join(pairs, " ")
+}
+
+/*
+Formats a message in the given format, on a single line without the trailing line break
+*/
+func FormatEntry(format string, timestamp time.Time, level int64, msg string, fields Fields) string {
+	switch format {
+	case FORMAT_JSON:
+		entry := map[string]interface{}{}
+		for key, val := range fields {
+			if err, ok := val.(error); ok {
+				val = err.Error()
+			}
+			entry[key] = val
+		}
+		entry["time"] = timestamp.UTC().Format(time.RFC3339Nano)
+		entry["level"] = getLevelName(level)
+		entry["msg"] = msg
+
+		output, jsonErr := json.Marshal(entry)
+		if jsonErr != nil {
+			return FormatEntry(FORMAT_LOGFMT, timestamp, level, msg, fields)
+		}
+		return string(output)
+	case FORMAT_LOGFMT:
+		output := fmt.Sprintf("time=%s level=%s msg=%s", timestamp.UTC().Format(time.RFC3339Nano), getLevelName(level), formatLogfmtValue(msg))
+		if len(fields) > 0 {
+			output += " " + formatLogfmtFields(fields)
+		}
+		return output
+	default:
+		output := fmt.Sprintf("%s %s", timestamp.Format("2006/01/02 15:04:05"), msg)
+		if len(fields) > 0 {
+			output += " " + formatLogfmtFields(fields)
+		}
+		return output
+	}
+}
+
+func (logger Logger) log(level int64, format string, args ...interface{}) {
+	if logger.LogLevel > level {
+		return
+	}
+
+	output := logger.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	fmt.Fprintln(output, FormatEntry(logger.Format, time.Now(), level, fmt.Sprintf(format, args...), logger.Fields))
+}
+
+func (logger Logger) Debugf(format string, args ...interface{}) {
+	logger.log(DEBUG, format, args...)
+}
+
+func (logger Logger) Infof(format string, args ...interface{}) {
+	logger.log(INFO, format, args...)
+}
+
+func (logger Logger) Warnf(format string, args ...interface{}) {
+	logger.log(WARN, format, args...)
 }
 
 func (logger Logger) Errorf(format string, args ...interface{}) {
-	log.Printf(format+"\n", args...)
+	logger.log(ERROR, format, args...)
 }
@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatEntry(t *testing.T) {
+	timestamp := time.Date(2024, 12, 6, 21, 22, 25, 0, time.UTC)
+	fields := Fields{"command": "backup", "object": "backup-2024-12-06T21:22:25Z.dump", "bytes": 1024, "target": "main cluster"}
+
+	line := FormatEntry(FORMAT_JSON, timestamp, WARN, "Backup stored", fields)
+	var entry map[string]interface{}
+	jsonErr := json.Unmarshal([]byte(line), &entry)
+	if jsonErr != nil || entry["level"] != "warning" || entry["msg"] != "Backup stored" || entry["time"] != "2024-12-06T21:22:25Z" || entry["bytes"] != float64(1024) || entry["object"] != "backup-2024-12-06T21:22:25Z.dump" {
+		t.Errorf("Expected a json object with the message and its fields. Got '%s', %v", line, jsonErr)
+	}
+
+	line = FormatEntry(FORMAT_LOGFMT, timestamp, INFO, "Backup stored", fields)
+	expected := "time=2024-12-06T21:22:25Z level=info msg=\"Backup stored\" bytes=1024 command=backup object=backup-2024-12-06T21:22:25Z.dump target=\"main cluster\""
+	if line != expected {
+		t.Errorf("Expected logfmt pairs with sorted fields and quoted values containing spaces. Got '%s'", line)
+	}
+
+	line = FormatEntry(FORMAT_TEXT, timestamp, INFO, "Backup stored", Fields{})
+	if line != "2024/12/06 21:22:25 Backup stored" {
+		t.Errorf("Expected the text format to be the message prefixed by the time. Got '%s'", line)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	var output bytes.Buffer
+	log := Logger{LogLevel: WARN, Format: FORMAT_LOGFMT, Output: &output}.WithFields(Fields{"command": "prune"})
+
+	log.Infof("Pruned %d backups", 2)
+	log.WithFields(Fields{"target": "a"}).Warnf("Target failed")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], "level=warning") || !strings.HasSuffix(lines[0], "command=prune target=a") {
+		t.Errorf("Expected only the warning to be logged with the fields of both loggers. Got %v", lines)
+	}
+
+	if _, ok := log.Fields["target"]; ok {
+		t.Errorf("Expected adding fields not to modify the original logger")
+	}
+}
@@ -0,0 +1,317 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+)
+
+const (
+	NOTIFIER_WEBHOOK = "webhook"
+	NOTIFIER_SLACK   = "slack"
+	NOTIFIER_COMMAND = "command"
+)
+
+const (
+	STATUS_SUCCESS = "success"
+	STATUS_FAILURE = "failure"
+)
+
+//Commands whose outcome can be notified
+var NotifiedCommands = []string{"backup", "prune", "verify", "rotate-key"}
+
+/*
+Outcome of a command on a target
+*/
+type Event struct {
+	Command string `json:"command"`
+	Target  string `json:"target"`
+	Status  string `json:"status"`
+	//Time at which the command started
+	Timestamp time.Time `json:"timestamp"`
+	//Timestamp of the backup the command operated on, if any
+	Backup string `json:"backup,omitempty"`
+	//Size of the backup in bytes, or -1 if not known
+	Size int64 `json:"size"`
+	//Etcd revision of the snapshot of the backup, if known
+	Revision int64 `json:"revision,omitempty"`
+	//Whether the upload of a snapshot taken by a previous command was resumed, with the age of the snapshot
+	Resumed            bool    `json:"resumed,omitempty"`
+	SnapshotAgeSeconds float64 `json:"snapshot_age_seconds,omitempty"`
+	DurationSeconds    float64 `json:"duration_seconds"`
+	//Step of the command that failed
+	Stage string `json:"stage,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+/*
+Returns the environment variables describing the event, for the commands that are executed on it.
+They do not share the ETCD_BACKUP_ prefix of the configuration overrides, so that they are not taken as such by the commands.
+*/
+func (event *Event) GetEnv() []string {
+	eventJson, _ := json.Marshal(event)
+
+	return []string{
+		fmt.Sprintf("EVENT_JSON=%s", string(eventJson)),
+		fmt.Sprintf("EVENT_COMMAND=%s", event.Command),
+		fmt.Sprintf("EVENT_TARGET=%s", event.Target),
+		fmt.Sprintf("EVENT_STATUS=%s", event.Status),
+		fmt.Sprintf("EVENT_TIMESTAMP=%s", event.Timestamp.UTC().Format(time.RFC3339)),
+		fmt.Sprintf("EVENT_BACKUP=%s", event.Backup),
+		fmt.Sprintf("EVENT_SIZE=%d", event.Size),
+		fmt.Sprintf("EVENT_REVISION=%d", event.Revision),
+		fmt.Sprintf("EVENT_RESUMED=%t", event.Resumed),
+		fmt.Sprintf("EVENT_SNAPSHOT_AGE_SECONDS=%s", strconv.FormatFloat(event.SnapshotAgeSeconds, 'f', 3, 64)),
+		fmt.Sprintf("EVENT_DURATION_SECONDS=%s", strconv.FormatFloat(event.DurationSeconds, 'f', 3, 64)),
+		fmt.Sprintf("EVENT_STAGE=%s", event.Stage),
+		fmt.Sprintf("EVENT_ERROR=%s", event.Error),
+	}
+}
+
+/*
+Error of a command annotated with the step of the command that failed
+*/
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (err *StageError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *StageError) Unwrap() error {
+	return err.Err
+}
+
+/*
+Annotates an error with the step of the command that failed. Nil errors and errors already annotated are returned as they are.
+*/
+func WithStage(stage string, err error) error {
+	var stageErr *StageError
+	if err == nil || errors.As(err, &stageErr) {
+		return err
+	}
+
+	return &StageError{Stage: stage, Err: err}
+}
+
+/*
+Returns the step of the command that failed with the error, or the given default if the error is not annotated
+*/
+func GetStage(err error, defaultStage string) string {
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		return stageErr.Stage
+	}
+
+	return defaultStage
+}
+
+/*
+Renders a templated body with the event. The template is a go text template, with a json function to quote values.
+*/
+func RenderBody(body string, event Event) ([]byte, error) {
+	tmpl, parseErr := template.New("body").Funcs(template.FuncMap{
+		"json": func(val interface{}) (string, error) {
+			output, err := json.Marshal(val)
+			return string(output), err
+		},
+	}).Parse(body)
+	if parseErr != nil {
+		return nil, errors.New(fmt.Sprintf("Error parsing the body template: %s", parseErr.Error()))
+	}
+
+	var output bytes.Buffer
+	execErr := tmpl.Execute(&output, event)
+	if execErr != nil {
+		return nil, errors.New(fmt.Sprintf("Error rendering the body template: %s", execErr.Error()))
+	}
+
+	if !json.Valid(output.Bytes()) {
+		return nil, errors.New("The rendered body is not valid json")
+	}
+
+	return output.Bytes(), nil
+}
+
+/*
+Returns the message describing the event in slack payloads
+*/
+func GetSummary(event Event) string {
+	details := []string{}
+	if event.Backup != "" {
+		details = append(details, fmt.Sprintf("backup %s", event.Backup))
+	}
+	if event.Size >= 0 {
+		details = append(details, fmt.Sprintf("%d bytes", event.Size))
+	}
+	if event.Resumed {
+		details = append(details, fmt.Sprintf("resumed upload of the snapshot of revision %d taken %.0fs earlier", event.Revision, event.SnapshotAgeSeconds))
+	}
+	details = append(details, fmt.Sprintf("%.1fs", event.DurationSeconds))
+
+	if event.Status == STATUS_SUCCESS {
+		return fmt.Sprintf("etcd-backup %s succeeded on target '%s' (%s)", event.Command, event.Target, strings.Join(details, ", "))
+	}
+
+	return fmt.Sprintf("etcd-backup %s failed on target '%s' at stage '%s' (%s): %s", event.Command, event.Target, event.Stage, strings.Join(details, ", "), event.Error)
+}
+
+/*
+Returns whether the notifier is interested in the event
+*/
+func Matches(notifier config.NotifierConfig, event Event) bool {
+	return slices.Contains(notifier.Commands, event.Command) && slices.Contains(notifier.Statuses, event.Status)
+}
+
+func post(notifier config.NotifierConfig, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifier.Timeout)
+	defer cancel()
+
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, notifier.Url, bytes.NewReader(body))
+	if reqErr != nil {
+		return reqErr
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range notifier.Headers {
+		req.Header.Set(key, val)
+	}
+
+	res, resErr := http.DefaultClient.Do(req)
+	if resErr != nil {
+		return resErr
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.New(fmt.Sprintf("Request to '%s' returned status %d", notifier.Url, res.StatusCode))
+	}
+
+	return nil
+}
+
+func execute(notifier config.NotifierConfig, event Event) error {
+	if len(notifier.Command) == 0 {
+		return errors.New("No command to execute was specified")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifier.Timeout)
+	defer cancel()
+
+	eventJson, jsonErr := json.Marshal(event)
+	if jsonErr != nil {
+		return jsonErr
+	}
+
+	cmd := exec.CommandContext(ctx, notifier.Command[0], notifier.Command[1:]...)
+	cmd.Env = append(os.Environ(), event.GetEnv()...)
+	cmd.Stdin = bytes.NewReader(eventJson)
+	output, cmdErr := cmd.CombinedOutput()
+	if cmdErr != nil {
+		return errors.New(fmt.Sprintf("Command failed: %s: %s", cmdErr.Error(), strings.TrimSpace(string(output))))
+	}
+
+	return nil
+}
+
+/*
+Checks that the notifier has the parameters of its type, that it is interested in known commands and statuses and that its body renders
+*/
+func ValidateNotifier(notifier config.NotifierConfig) error {
+	switch notifier.Type {
+	case NOTIFIER_WEBHOOK, NOTIFIER_SLACK:
+		if notifier.Url == "" {
+			return errors.New(fmt.Sprintf("A url is required for notifiers of type '%s'", notifier.Type))
+		}
+	case NOTIFIER_COMMAND:
+		if len(notifier.Command) == 0 {
+			return errors.New("A command is required for notifiers of type 'command'")
+		}
+	default:
+		return errors.New(fmt.Sprintf("Unsupported notifier type '%s'. Valid types are '%s', '%s' and '%s'", notifier.Type, NOTIFIER_WEBHOOK, NOTIFIER_SLACK, NOTIFIER_COMMAND))
+	}
+
+	for _, command := range notifier.Commands {
+		if !slices.Contains(NotifiedCommands, command) {
+			return errors.New(fmt.Sprintf("Command '%s' is not notified. Valid commands are %s", command, strings.Join(NotifiedCommands, ", ")))
+		}
+	}
+
+	for _, status := range notifier.Statuses {
+		if status != STATUS_SUCCESS && status != STATUS_FAILURE {
+			return errors.New(fmt.Sprintf("Unsupported status '%s'. Valid statuses are '%s' and '%s'", status, STATUS_SUCCESS, STATUS_FAILURE))
+		}
+	}
+
+	if notifier.Body != "" {
+		_, bodyErr := RenderBody(notifier.Body, Event{Command: "backup", Status: STATUS_FAILURE, Timestamp: time.Now(), Size: -1})
+		if bodyErr != nil {
+			return bodyErr
+		}
+	}
+
+	return nil
+}
+
+/*
+Sends the event to a notifier, regardless of whether the notifier is interested in it
+*/
+func Send(notifier config.NotifierConfig, event Event) error {
+	switch notifier.Type {
+	case NOTIFIER_WEBHOOK:
+		body, bodyErr := json.Marshal(event)
+		if notifier.Body != "" {
+			body, bodyErr = RenderBody(notifier.Body, event)
+		}
+		if bodyErr != nil {
+			return bodyErr
+		}
+
+		return post(notifier, body)
+	case NOTIFIER_SLACK:
+		body, bodyErr := json.Marshal(map[string]string{"text": GetSummary(event)})
+		if bodyErr != nil {
+			return bodyErr
+		}
+
+		return post(notifier, body)
+	case NOTIFIER_COMMAND:
+		return execute(notifier, event)
+	default:
+		return errors.New(fmt.Sprintf("Unsupported notifier type '%s'", notifier.Type))
+	}
+}
+
+/*
+Sends the event to all the notifiers interested in it. A notifier that fails does not prevent the others from being notified.
+The errors are returned by notifier name.
+*/
+func Notify(notifiers []config.NotifierConfig, event Event) map[string]error {
+	errs := map[string]error{}
+	for _, notifier := range notifiers {
+		if !Matches(notifier, event) {
+			continue
+		}
+
+		sendErr := Send(notifier, event)
+		if sendErr != nil {
+			errs[notifier.Name] = sendErr
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+)
+
+func TestRenderBody(t *testing.T) {
+	event := Event{
+		Command:         "backup",
+		Target:          "main",
+		Status:          STATUS_FAILURE,
+		Timestamp:       time.Date(2024, 12, 6, 21, 22, 25, 0, time.UTC),
+		Size:            -1,
+		DurationSeconds: 1.5,
+		Stage:           "upload",
+		Error:           "connection \"reset\"",
+	}
+
+	body, bodyErr := RenderBody(`{"summary": {{json .Error}}, "stage": "{{.Stage}}", "seconds": {{.DurationSeconds}}}`, event)
+	var parsed map[string]interface{}
+	if bodyErr == nil {
+		bodyErr = json.Unmarshal(body, &parsed)
+	}
+	if bodyErr != nil || parsed["summary"] != "connection \"reset\"" || parsed["stage"] != "upload" || parsed["seconds"] != 1.5 {
+		t.Errorf("Expected the body to be rendered with quoted values. Got '%s', %v", string(body), bodyErr)
+	}
+
+	_, bodyErr = RenderBody(`{"summary": "{{.Error}}"}`, event)
+	if bodyErr == nil {
+		t.Errorf("Expected a body that is not valid json to be rejected")
+	}
+}
+
+func TestMatches(t *testing.T) {
+	notifier := config.NotifierConfig{Commands: []string{"backup", "prune"}, Statuses: []string{STATUS_FAILURE}}
+
+	if !Matches(notifier, Event{Command: "prune", Status: STATUS_FAILURE}) {
+		t.Errorf("Expected the notifier to match the failures of its commands")
+	}
+
+	if Matches(notifier, Event{Command: "prune", Status: STATUS_SUCCESS}) {
+		t.Errorf("Expected the notifier not to match the successes of its commands")
+	}
+
+	if Matches(notifier, Event{Command: "verify", Status: STATUS_FAILURE}) {
+		t.Errorf("Expected the notifier not to match the failures of other commands")
+	}
+}
+
+func TestGetStage(t *testing.T) {
+	err := WithStage("upload", errors.New("connection reset"))
+	wrapped := fmt.Errorf("backup failed: %w", WithStage("replication", err))
+
+	if stage := GetStage(wrapped, "backup"); stage != "upload" {
+		t.Errorf("Expected the innermost stage to be kept. Got '%s'", stage)
+	}
+
+	if stage := GetStage(errors.New("invalid policy"), "backup"); stage != "backup" {
+		t.Errorf("Expected errors without a stage to get the default stage. Got '%s'", stage)
+	}
+
+	if WithStage("upload", nil) != nil {
+		t.Errorf("Expected nil errors to remain nil")
+	}
+}
+
+func TestValidateNotifier(t *testing.T) {
+	notifier := config.NotifierConfig{Name: "ops", Type: NOTIFIER_WEBHOOK, Url: "https://hooks.local", Commands: []string{"backup"}, Statuses: []string{STATUS_FAILURE}}
+	if validErr := ValidateNotifier(notifier); validErr != nil {
+		t.Errorf("Expected the notifier to be valid. Got %v", validErr)
+	}
+
+	invalid := []config.NotifierConfig{
+		config.NotifierConfig{Type: "email"},
+		config.NotifierConfig{Type: NOTIFIER_SLACK},
+		config.NotifierConfig{Type: NOTIFIER_COMMAND},
+		config.NotifierConfig{Type: NOTIFIER_WEBHOOK, Url: notifier.Url, Commands: []string{"restore"}},
+		config.NotifierConfig{Type: NOTIFIER_WEBHOOK, Url: notifier.Url, Statuses: []string{"skipped"}},
+		config.NotifierConfig{Type: NOTIFIER_WEBHOOK, Url: notifier.Url, Body: "{{.Missing}}"},
+	}
+	for _, invalidNotifier := range invalid {
+		if ValidateNotifier(invalidNotifier) == nil {
+			t.Errorf("Expected notifier %+v to be invalid", invalidNotifier)
+		}
+	}
+}
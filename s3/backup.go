@@ -7,42 +7,113 @@ import (
 	"time"
 
 	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/throttle"
 
 	"github.com/minio/minio-go/v7"
 )
 
-func Backup(source io.Reader, s3Conf config.S3ClientConfig, cypherKey []byte) error {
+const (
+	METADATA_ETCD_REVISION       = "Etcd-Revision"
+	METADATA_ETCD_MEMBER         = "Etcd-Member"
+	METADATA_ETCD_FIRST_REVISION = "Etcd-First-Revision"
+	METADATA_ETCD_LAST_REVISION  = "Etcd-Last-Revision"
+	//Times at which the first and last changes of a change segment were received, in RFC3339 format with nanoseconds
+	METADATA_FIRST_CHANGE_TIME = "First-Change-Time"
+	METADATA_LAST_CHANGE_TIME  = "Last-Change-Time"
+	//SHA-256 checksums of the plaintext snapshot and of the stored object, which differ if the backup is encrypted
+	METADATA_SNAPSHOT_SHA256 = "Snapshot-Sha256"
+	METADATA_OBJECT_SHA256   = "Object-Sha256"
+)
+
+/*
+Opens the content of a backup from the start, with the encrypted key of the content if it is encrypted.
+It is called for each upload attempt, so that the uploads of streams that cannot be read again can be retried.
+*/
+type BackupSource func() (io.Reader, []byte, error)
+
+/*
+Stores a backup under the current time. The size of the source should be -1 if it is not known in advance.
+*/
+func Backup(open BackupSource, size int64, s3Conf config.S3ClientConfig, metadata map[string]string) error {
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return namingErr
+	}
+
+	entry, entryErr := namingConv.NewEntry(time.Now(), metadata[METADATA_ETCD_MEMBER])
+	if entryErr != nil {
+		return entryErr
+	}
+
+	return storeBackup(open, size, s3Conf, entry, metadata)
+}
+
+/*
+Stores a backup under the name of an existing entry, so that backups copied from another store keep their names
+*/
+func StoreEntry(open BackupSource, size int64, s3Conf config.S3ClientConfig, entry BackupEntry, metadata map[string]string) error {
+	return storeBackup(open, size, s3Conf, entry, metadata)
+}
+
+func storeBackup(open BackupSource, size int64, s3Conf config.S3ClientConfig, entry BackupEntry, metadata map[string]string) error {
 	cli, cliErr := connect(s3Conf)
 	if cliErr != nil {
 		return cliErr
 	}
 
-	namingConv := NewNamingConvention(s3Conf.ObjectsPrefix)
-	backupName, backupKeyName := namingConv.GetObjectNames(time.Now())
+	putOpts, putOptsErr := getPutOptions(s3Conf.Upload, size)
+	if putOptsErr != nil {
+		return putOptsErr
+	}
+	putOpts.UserMetadata = metadata
 
-	if len(cypherKey) > 0 {
-		_, keyErr := cli.PutObject(
-			context.Background(), 
-			s3Conf.Bucket,
-			backupKeyName,
-			bytes.NewBuffer(cypherKey),
-			int64(len(cypherKey)),
-			minio.PutObjectOptions{},
-		)
+	limiter, limiterErr := getUploadLimiter(s3Conf)
+	if limiterErr != nil {
+		return limiterErr
+	}
+
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return namingErr
+	}
+
+	backupName, backupKeyName := namingConv.GetObjectNames(entry)
+	policy := getRetryPolicy(s3Conf)
 
-		if keyErr != nil {
-			return keyErr
+	//The key is stored with each attempt, as the source of each attempt can be encrypted with a new key
+	dumpErr := withRetries(s3Conf, "upload", backupName, policy.TransferTimeout, func(ctx context.Context) error {
+		source, cypherKey, openErr := open()
+		if openErr != nil {
+			return openErr
 		}
+
+		if len(cypherKey) > 0 {
+			_, keyErr := cli.PutObject(
+				ctx,
+				s3Conf.Bucket,
+				backupKeyName,
+				bytes.NewBuffer(cypherKey),
+				int64(len(cypherKey)),
+				minio.PutObjectOptions{},
+			)
+			if keyErr != nil {
+				return keyErr
+			}
+		}
+
+		_, putErr := cli.PutObject(
+			ctx,
+			s3Conf.Bucket,
+			backupName,
+			throttle.NewReader(source, limiter),
+			size,
+			putOpts,
+		)
+		return putErr
+	})
+	if dumpErr != nil {
+		return dumpErr
 	}
 
-	_, backErr := cli.PutObject(
-		context.Background(), 
-		s3Conf.Bucket,
-		backupName,
-		source,
-		-1,
-		minio.PutObjectOptions{},
-	)
-
-	return backErr
-} 
\ No newline at end of file
+	return writeManifest(cli, s3Conf, entry)
+}
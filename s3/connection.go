@@ -1,6 +1,7 @@
 package s3
 
 import (
+	"context"
 	"crypto/tls"
     "crypto/x509"
     "errors"
@@ -46,6 +47,8 @@ func connect(s3Conf config.S3ClientConfig) (*minio.Client, error) {
 		Creds:  credentials.NewStaticV4(s3Conf.Auth.AccessKey, s3Conf.Auth.SecretKey, ""),
 		Secure: true,
 		Region: s3Conf.Region,
+		//Retries are handled by the retry policy of the configuration
+		MaxRetries: 1,
 		Transport: &http.Transport{
 			TLSClientConfig: tlsConf,
 			TLSHandshakeTimeout: s3Conf.ConnectionTimeout,
@@ -53,4 +56,54 @@ func connect(s3Conf config.S3ClientConfig) (*minio.Client, error) {
 			ExpectContinueTimeout: s3Conf.RequestTimeout,
 		},
 	})
-}
\ No newline at end of file
+}
+
+/*
+Checks the parameters of the s3 client that are only parsed when they are used: the naming of the objects, the upload parameters and the rate limits
+*/
+func ValidateConfig(s3Conf config.S3ClientConfig) error {
+	_, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return namingErr
+	}
+
+	_, optsErr := getPutOptions(s3Conf.Upload, -1)
+	if optsErr != nil {
+		return optsErr
+	}
+
+	_, limiterErr := getUploadLimiter(s3Conf)
+	if limiterErr != nil {
+		return limiterErr
+	}
+
+	_, limiterErr = getDownloadLimiter(s3Conf)
+	return limiterErr
+}
+
+/*
+Checks that the s3 store can be reached with the credentials of the configuration and that the bucket exists
+*/
+func CheckBucket(s3Conf config.S3ClientConfig) error {
+	cli, cliErr := connect(s3Conf)
+	if cliErr != nil {
+		return cliErr
+	}
+
+	exists := false
+	policy := getRetryPolicy(s3Conf)
+	checkErr := withRetries(s3Conf, "bucket check", s3Conf.Bucket, policy.OperationTimeout, func(ctx context.Context) error {
+		var err error
+		exists, err = cli.BucketExists(ctx, s3Conf.Bucket)
+		return err
+	})
+	if checkErr != nil {
+		return checkErr
+	}
+
+	if !exists {
+		return errors.New(fmt.Sprintf("Bucket '%s' does not exist", s3Conf.Bucket))
+	}
+
+	return nil
+}
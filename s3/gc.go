@@ -0,0 +1,232 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+
+	"github.com/minio/minio-go/v7"
+)
+
+type GarbageType string
+
+const (
+	//Encryption key without a dump, left by an upload that failed or an interrupted removal
+	GARBAGE_ORPHAN_KEY GarbageType = "orphan-key"
+	//Dump of an encrypted backup whose encryption key is missing, which cannot be restored
+	GARBAGE_MISSING_KEY GarbageType = "missing-key"
+	//Manifest of a backup whose dump is missing
+	GARBAGE_ORPHAN_MANIFEST GarbageType = "orphan-manifest"
+	//Dump without a manifest, from an upload that was interrupted before the manifest was written.
+	//The dump is complete, so it is verified and given a manifest rather than removed
+	GARBAGE_INCOMPLETE GarbageType = "incomplete"
+	//Multipart upload of a dump that was never completed nor aborted
+	GARBAGE_ABANDONED_UPLOAD GarbageType = "abandoned-upload"
+	//Object that almost matches the naming convention. It is reported, but never removed
+	GARBAGE_UNRECOGNIZED GarbageType = "unrecognized"
+)
+
+type Garbage struct {
+	Type     GarbageType `json:"type"`
+	Objects  []string    `json:"objects"`
+	UploadId string      `json:"upload_id,omitempty"`
+	//Time of the backup or of the initiation of the upload. It is unknown for unrecognized objects
+	Since time.Time `json:"since"`
+	entry BackupEntry
+}
+
+func (garbage *Garbage) IsRemovable() bool {
+	return garbage.Type != GARBAGE_UNRECOGNIZED && garbage.Type != GARBAGE_INCOMPLETE
+}
+
+/*
+Returns the backup of the garbage. It is empty for abandoned uploads and unrecognized objects
+*/
+func (garbage *Garbage) GetEntry() BackupEntry {
+	return garbage.entry
+}
+
+/*
+Checks that the objects found for a backup agree with the checksums recorded in the metadata of its dump.
+The checksums of the snapshot and of the object differ only if the backup is encrypted, in which case its encryption key must be present.
+*/
+func CheckEntryMetadata(entry BackupEntry, metadata map[string]string) error {
+	objectSum, hasObjectSum := metadata[METADATA_OBJECT_SHA256]
+	snapshotSum, hasSnapshotSum := metadata[METADATA_SNAPSHOT_SHA256]
+	if (!hasObjectSum) || (!hasSnapshotSum) {
+		return errors.New(fmt.Sprintf("Backup '%s' has no recorded checksums", entry.GetTimestamp()))
+	}
+
+	encrypted := objectSum != snapshotSum
+	if encrypted && (!entry.Encrypted) {
+		return errors.New(fmt.Sprintf("Backup '%s' is encrypted according to its checksums, but its encryption key is missing", entry.GetTimestamp()))
+	}
+	if (!encrypted) && entry.Encrypted {
+		return errors.New(fmt.Sprintf("Backup '%s' is not encrypted according to its checksums, but has an encryption key", entry.GetTimestamp()))
+	}
+
+	return nil
+}
+
+func getBackupGarbage(cli *minio.Client, s3Conf config.S3ClientConfig, namingConv NamingConvention, entry BackupEntry) (*Garbage, error) {
+	backupName, backupKeyName := namingConv.GetObjectNames(entry)
+	manifestName := namingConv.GetManifestName(entry)
+
+	objects := []string{}
+	if entry.ManifestFound {
+		objects = append(objects, manifestName)
+	}
+	if entry.DumpFound {
+		objects = append(objects, backupName)
+	}
+	if entry.Encrypted {
+		objects = append(objects, backupKeyName)
+	}
+
+	garbage := Garbage{Objects: objects, Since: entry.Timestamp, entry: entry}
+
+	if !entry.DumpFound {
+		garbage.Type = GARBAGE_ORPHAN_KEY
+		if entry.ManifestFound {
+			garbage.Type = GARBAGE_ORPHAN_MANIFEST
+		}
+		return &garbage, nil
+	}
+
+	if !entry.Complete {
+		garbage.Type = GARBAGE_INCOMPLETE
+		return &garbage, nil
+	}
+
+	if entry.ManifestFound && !entry.Encrypted {
+		manifest, manifestErr := GetManifest(s3Conf, entry)
+		if manifestErr != nil {
+			return nil, manifestErr
+		}
+
+		if manifest.Encryption != nil {
+			garbage.Type = GARBAGE_MISSING_KEY
+			return &garbage, nil
+		}
+	}
+
+	return nil, nil
+}
+
+/*
+Returns the objects and multipart uploads of the store that do not form a complete backup, from oldest to newest
+*/
+func FindGarbage(s3Conf config.S3ClientConfig) ([]Garbage, error) {
+	cli, cliErr := connect(s3Conf)
+	if cliErr != nil {
+		return []Garbage{}, cliErr
+	}
+
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return []Garbage{}, namingErr
+	}
+
+	entries, listErr := ListBackups(cli, s3Conf, namingConv)
+	if listErr != nil {
+		return []Garbage{}, listErr
+	}
+
+	garbages := []Garbage{}
+	for _, entry := range entries.Entries {
+		garbage, garbageErr := getBackupGarbage(cli, s3Conf, namingConv, entry)
+		if garbageErr != nil {
+			return garbages, garbageErr
+		}
+
+		if garbage != nil {
+			garbages = append(garbages, *garbage)
+		}
+	}
+
+	policy := getRetryPolicy(s3Conf)
+	for _, prefix := range namingConv.GetListPrefixes() {
+		uploadsErr := withRetries(s3Conf, "uploads listing", prefix, policy.OperationTimeout, func(ctx context.Context) error {
+			uploads := []Garbage{}
+			for upload := range cli.ListIncompleteUploads(ctx, s3Conf.Bucket, prefix, true) {
+				if upload.Err != nil {
+					return upload.Err
+				}
+
+				info, infoErr := namingConv.GetObjectInfo(upload.Key)
+				if infoErr != nil || info.Type != OBJ_TYPE_DUMP {
+					continue
+				}
+
+				uploads = append(uploads, Garbage{
+					Type:     GARBAGE_ABANDONED_UPLOAD,
+					Objects:  []string{upload.Key},
+					UploadId: upload.UploadID,
+					Since:    upload.Initiated,
+				})
+			}
+
+			garbages = append(garbages, uploads...)
+			return nil
+		})
+		if uploadsErr != nil {
+			return garbages, uploadsErr
+		}
+	}
+
+	slices.SortFunc(garbages, func(a, b Garbage) int {
+		return a.Since.Compare(b.Since)
+	})
+
+	for _, name := range entries.Unrecognized {
+		garbages = append(garbages, Garbage{
+			Type:    GARBAGE_UNRECOGNIZED,
+			Objects: []string{name},
+		})
+	}
+
+	return garbages, nil
+}
+
+/*
+Removes the objects of a garbage entry or aborts its multipart upload
+*/
+func RemoveGarbage(s3Conf config.S3ClientConfig, garbage Garbage) error {
+	if garbage.Type == GARBAGE_UNRECOGNIZED {
+		return errors.New(fmt.Sprintf("Object '%s' is not recognized and will not be removed", garbage.Objects[0]))
+	}
+
+	if !garbage.IsRemovable() {
+		return errors.New(fmt.Sprintf("Objects '%s' form an incomplete backup and will not be removed", strings.Join(garbage.Objects, "', '")))
+	}
+
+	cli, cliErr := connect(s3Conf)
+	if cliErr != nil {
+		return cliErr
+	}
+
+	if garbage.Type == GARBAGE_ABANDONED_UPLOAD {
+		core := minio.Core{Client: cli}
+		policy := getRetryPolicy(s3Conf)
+		abortErr := withRetries(s3Conf, "multipart upload abortion", garbage.Objects[0], policy.OperationTimeout, func(ctx context.Context) error {
+			return core.AbortMultipartUpload(ctx, s3Conf.Bucket, garbage.Objects[0], garbage.UploadId)
+		})
+		if abortErr != nil && getErrorCode(abortErr) != "NoSuchUpload" {
+			return abortErr
+		}
+
+		return nil
+	}
+
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return namingErr
+	}
+
+	return PruneBackupEntry(cli, s3Conf, namingConv, garbage.entry)
+}
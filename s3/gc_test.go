@@ -0,0 +1,77 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+)
+
+func TestGetBackupGarbage(t *testing.T) {
+	namingConv := NewNamingConvention("backup")
+	timestamp := time.Date(2024, 12, 6, 21, 22, 25, 0, time.UTC)
+
+	garbage, garbageErr := getBackupGarbage(nil, config.S3ClientConfig{}, namingConv, BackupEntry{Name: "backup-2024-12-06T21:22:25Z", Timestamp: timestamp, Encrypted: true})
+	if garbageErr != nil || garbage == nil || garbage.Type != GARBAGE_ORPHAN_KEY || len(garbage.Objects) != 1 || garbage.Objects[0] != "backup-2024-12-06T21:22:25Z.key" {
+		t.Errorf("Expected a key without a dump to be an orphan key. Got %+v, %v", garbage, garbageErr)
+	}
+
+	garbage, garbageErr = getBackupGarbage(nil, config.S3ClientConfig{}, namingConv, BackupEntry{Name: "backup-2024-12-06T21:22:25Z", Timestamp: timestamp, ManifestFound: true})
+	if garbageErr != nil || garbage == nil || garbage.Type != GARBAGE_ORPHAN_MANIFEST {
+		t.Errorf("Expected a manifest without a dump to be an orphan manifest. Got %+v, %v", garbage, garbageErr)
+	}
+
+	garbage, garbageErr = getBackupGarbage(nil, config.S3ClientConfig{}, namingConv, BackupEntry{Name: "backup-2024-12-06T21:22:25Z", Timestamp: timestamp, Encrypted: true, DumpFound: true})
+	if garbageErr != nil || garbage == nil || garbage.Type != GARBAGE_INCOMPLETE || len(garbage.Objects) != 2 {
+		t.Errorf("Expected a dump without a manifest to be incomplete. Got %+v, %v", garbage, garbageErr)
+	}
+	if garbage != nil && garbage.IsRemovable() {
+		t.Errorf("Expected an incomplete backup not to be removable")
+	}
+
+	garbage, garbageErr = getBackupGarbage(nil, config.S3ClientConfig{}, namingConv, BackupEntry{Name: "backup-2024-12-06T21:22:25Z", Timestamp: timestamp, Encrypted: true, DumpFound: true, ManifestFound: true, Complete: true})
+	if garbageErr != nil || garbage != nil {
+		t.Errorf("Expected a complete backup not to be garbage. Got %+v, %v", garbage, garbageErr)
+	}
+}
+
+func TestIsNearMiss(t *testing.T) {
+	namingConv := NewNamingConvention("backup")
+
+	if !namingConv.IsNearMiss("backup-2024-12-06T21:22:25Z.dmp") || !namingConv.IsNearMiss("backup-2024-12-06.dump") {
+		t.Errorf("Expected objects with a malformed timestamp or extension to be near misses")
+	}
+
+	if namingConv.IsNearMiss("backup-export-2024-12-06T21:22:25Z.dump") || namingConv.IsNearMiss("other-2024-12-06T21:22:25Z.dump") {
+		t.Errorf("Expected objects of other prefixes not to be near misses")
+	}
+}
+
+func TestCheckEntryMetadata(t *testing.T) {
+	entry := BackupEntry{Name: "backup-2024-12-06T21:22:25Z", Timestamp: time.Date(2024, 12, 6, 21, 22, 25, 0, time.UTC), DumpFound: true}
+	encryptedEntry := entry
+	encryptedEntry.Encrypted = true
+
+	plain := map[string]string{METADATA_OBJECT_SHA256: "aa", METADATA_SNAPSHOT_SHA256: "aa"}
+	encrypted := map[string]string{METADATA_OBJECT_SHA256: "bb", METADATA_SNAPSHOT_SHA256: "aa"}
+
+	tests := []struct {
+		entry    BackupEntry
+		metadata map[string]string
+		valid    bool
+	}{
+		{entry, plain, true},
+		{encryptedEntry, encrypted, true},
+		{entry, encrypted, false},
+		{encryptedEntry, plain, false},
+		{entry, map[string]string{METADATA_OBJECT_SHA256: "aa"}, false},
+		{entry, map[string]string{}, false},
+	}
+
+	for idx, test := range tests {
+		checkErr := CheckEntryMetadata(test.entry, test.metadata)
+		if (checkErr == nil) != test.valid {
+			t.Errorf("Expected the metadata of case %d to be valid: %t. Got %v", idx, test.valid, checkErr)
+		}
+	}
+}
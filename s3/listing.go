@@ -4,27 +4,55 @@ import (
 	"context"
 	"errors"
     "slices"
+	"strings"
 	"time"
 
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+
 	minio "github.com/minio/minio-go/v7"
 )
 
 type BackupEntry struct {
+	//Name of the objects of the backup without their extension, or with a placeholder in its place, which identifies the backup
+	Name string
 	Timestamp time.Time
 	Encrypted bool
 	DumpFound bool
+	ManifestFound bool
+	//Whether all the objects of the backup were stored, as marked by its manifest
+	Complete bool
+}
+
+/*
+Returns the timestamp of the backup with the resolution of its name
+*/
+func (entry *BackupEntry) GetTimestamp() string {
+	return entry.Timestamp.UTC().Format(time.RFC3339Nano)
+}
+
+/*
+Returns the name of the object of the backup with the given extension
+*/
+func (entry *BackupEntry) GetObjectName(extension string) string {
+	if strings.Contains(entry.Name, EXTENSION_PLACEHOLDER) {
+		return strings.Replace(entry.Name, EXTENSION_PLACEHOLDER, extension, 1)
+	}
+
+	return entry.Name + "." + extension
 }
 
 type BackupEntries struct {
-	Entries map[time.Time]BackupEntry
+	Entries map[string]BackupEntry
 	LastEntry *BackupEntry
+	//Objects that almost match the naming convention
+	Unrecognized []string
 }
 
 func (entries *BackupEntries) countValidBackups() int64 {
     count := 0
 
     for _, entry := range entries.Entries {
-        if entry.DumpFound {
+        if entry.Complete {
             count += 1
         }
     }
@@ -43,7 +71,7 @@ func (entries *BackupEntries) GetDeletable(cutoff time.Time, minCount int64) []B
 
 	for _, entry := range entries.Entries {
         if entry.Timestamp.Equal(cutoff) || entry.Timestamp.Before(cutoff) {
-            if !entry.DumpFound {
+            if !entry.Complete {
                 toDeleteInc = append(toDeleteInc, entry)
                 continue
             }
@@ -74,7 +102,7 @@ func (entries *BackupEntries) GetDeletable(cutoff time.Time, minCount int64) []B
 
 func (entries *BackupEntries) findEntry(timestamp time.Time) (BackupEntry, error) {
 	for _, entry := range entries.Entries {
-		if entry.Timestamp == timestamp && entry.DumpFound {
+		if entry.Timestamp == timestamp && entry.Complete {
 			return entry, nil
 		}
 	}
@@ -90,47 +118,110 @@ func (entries *BackupEntries) getLastEntry() (BackupEntry, error) {
 	return BackupEntry{}, errors.New("Not dump entry found")
 }
 
-func ListBackups(cli *minio.Client, bucket string, nameConv NamingConvention) (BackupEntries, error) {
-	entries := BackupEntries{
-		Entries: map[time.Time]BackupEntry{},
-		LastEntry: nil,
+/*
+Marks the backups that have a manifest as complete and sets the latest complete backup.
+Backups older than the oldest manifest predate manifests and are considered complete if their dump is present.
+*/
+func (entries *BackupEntries) markComplete() {
+	var oldestManifest *time.Time
+	for _, entry := range entries.Entries {
+		if entry.ManifestFound && (oldestManifest == nil || entry.Timestamp.Before(*oldestManifest)) {
+			timestamp := entry.Timestamp
+			oldestManifest = &timestamp
+		}
 	}
 
-	objCh := cli.ListObjects(context.Background(), bucket, minio.ListObjectsOptions{})
-	for object := range objCh {
-		if object.Err != nil {
-			return entries, object.Err
-		}
+	entries.LastEntry = nil
+	for name, entry := range entries.Entries {
+		entry.Complete = entry.ManifestFound || (entry.DumpFound && (oldestManifest == nil || entry.Timestamp.Before(*oldestManifest)))
+		entries.Entries[name] = entry
 
-		info, infoErr := nameConv.GetObjectInfo(object.Key)
-		if infoErr != nil {
-			continue
+		if entry.Complete {
+			if entries.LastEntry == nil || entry.Timestamp.After(entries.LastEntry.Timestamp) {
+				last := entry
+				entries.LastEntry = &last
+			}
 		}
+	}
+}
 
-		entry := BackupEntry{
-			Timestamp: info.Timestamp,
-			Encrypted: false,
-			DumpFound: false,
-		}
+/*
+Calls the given function on each object under the prefix, including the objects of nested paths, as the pages of the listing are received.
+Objects are listed in lexical order, so a listing that fails is resumed after the last object that was processed.
+*/
+func walkObjects(cli *minio.Client, s3Conf config.S3ClientConfig, prefix string, fn func(object minio.ObjectInfo)) error {
+	startAfter := ""
+
+	//Listing a prefix holding many objects can take longer than other operations, but a retry does not start over
+	policy := getRetryPolicy(s3Conf)
+	return withRetries(s3Conf, "listing", prefix, policy.TransferTimeout, func(ctx context.Context) error {
+		objCh := cli.ListObjects(ctx, s3Conf.Bucket, minio.ListObjectsOptions{
+			Prefix: prefix,
+			Recursive: true,
+			StartAfter: startAfter,
+		})
+		for object := range objCh {
+			if object.Err != nil {
+				return object.Err
+			}
 
-		if val, ok := entries.Entries[info.Timestamp]; ok {
-			entry = val
+			fn(object)
+			startAfter = object.Key
 		}
 
-		if info.Type == OBJ_TYPE_DUMP {
-			entry.DumpFound = true
-		} else {
-			entry.Encrypted = true
-		}
+		return nil
+	})
+}
+
+/*
+Lists the backups under the prefixes of the naming convention. Only the objects of the backups are kept in memory.
+*/
+func ListBackups(cli *minio.Client, s3Conf config.S3ClientConfig, nameConv NamingConvention) (BackupEntries, error) {
+	entries := BackupEntries{
+		Entries: map[string]BackupEntry{},
+		LastEntry: nil,
+		Unrecognized: []string{},
+	}
 
-		entries.Entries[info.Timestamp] = entry
+	for _, prefix := range nameConv.GetListPrefixes() {
+		listErr := walkObjects(cli, s3Conf, prefix, func(object minio.ObjectInfo) {
+			info, infoErr := nameConv.GetObjectInfo(object.Key)
+			if infoErr != nil {
+				if nameConv.IsNearMiss(object.Key) {
+					entries.Unrecognized = append(entries.Unrecognized, object.Key)
+				}
+				return
+			}
 
-		if entry.DumpFound {
-			if entries.LastEntry == nil || entry.Timestamp.Equal(entries.LastEntry.Timestamp) || entry.Timestamp.After(entries.LastEntry.Timestamp) {
-				entries.LastEntry = &entry
+			entry := BackupEntry{
+				Name: info.Name,
+				Timestamp: info.Timestamp,
+				Encrypted: false,
+				DumpFound: false,
+				ManifestFound: false,
+				Complete: false,
 			}
-		} 
+
+			if val, ok := entries.Entries[info.Name]; ok {
+				entry = val
+			}
+
+			switch info.Type {
+			case OBJ_TYPE_DUMP:
+				entry.DumpFound = true
+			case OBJ_TYPE_KEY:
+				entry.Encrypted = true
+			case OBJ_TYPE_MANIFEST:
+				entry.ManifestFound = true
+			}
+
+			entries.Entries[info.Name] = entry
+		})
+		if listErr != nil {
+			return entries, listErr
+		}
 	}
 
+	entries.markComplete()
 	return entries, nil
-}
\ No newline at end of file
+}
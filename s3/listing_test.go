@@ -0,0 +1,54 @@
+package s3
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarkComplete(t *testing.T) {
+	base := time.Date(2024, 12, 6, 0, 0, 0, 0, time.UTC)
+	entries := BackupEntries{Entries: map[string]BackupEntry{}}
+	add := func(hours int, dump bool, manifest bool) string {
+		timestamp := base.Add(time.Duration(hours) * time.Hour)
+		name := "backup-" + timestamp.Format(time.RFC3339)
+		entries.Entries[name] = BackupEntry{Name: name, Timestamp: timestamp, DumpFound: dump, ManifestFound: manifest}
+		return name
+	}
+
+	legacy := add(0, true, false)
+	legacyKeyOnly := add(1, false, false)
+	manifested := add(2, true, true)
+	unfinished := add(3, true, false)
+	latest := add(4, true, true)
+	entries.markComplete()
+
+	if !entries.Entries[legacy].Complete {
+		t.Errorf("Expected a dump predating manifests to be complete")
+	}
+
+	if entries.Entries[legacyKeyOnly].Complete {
+		t.Errorf("Expected a backup without a dump to be incomplete")
+	}
+
+	if !entries.Entries[manifested].Complete {
+		t.Errorf("Expected a backup with a manifest to be complete")
+	}
+
+	if entries.Entries[unfinished].Complete {
+		t.Errorf("Expected a dump without a manifest following manifested backups to be incomplete")
+	}
+
+	if entries.LastEntry == nil || entries.LastEntry.Name != latest {
+		t.Errorf("Expected the last entry to be the latest complete backup. Got %+v", entries.LastEntry)
+	}
+
+	deletables := entries.GetDeletable(base.Add(10*time.Hour), 2)
+	if len(deletables) != 3 {
+		t.Errorf("Expected the oldest complete backup and the incomplete backups to be deletable. Got %+v", deletables)
+	}
+	for _, entry := range deletables {
+		if entry.Name == manifested || entry.Name == latest {
+			t.Errorf("Expected the 2 latest complete backups to be kept. Got %+v", deletables)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/lock"
+
+	"github.com/minio/minio-go/v7"
+)
+
+/*
+Lock stored in an object next to the backups. It is created and replaced with conditional writes,
+so that only one process succeeds when several race for it. A lock whose lease expired can be taken over.
+*/
+type LockBackend struct {
+	cli    *minio.Client
+	s3Conf config.S3ClientConfig
+	name   string
+	etag   string
+}
+
+func GetLockName(s3Conf config.S3ClientConfig) string {
+	return s3Conf.ObjectsPrefix + ".lock"
+}
+
+func NewLockBackend(s3Conf config.S3ClientConfig) (*LockBackend, error) {
+	cli, cliErr := connect(s3Conf)
+	if cliErr != nil {
+		return nil, cliErr
+	}
+
+	return &LockBackend{cli: cli, s3Conf: s3Conf, name: GetLockName(s3Conf)}, nil
+}
+
+/*
+Conditional writes fail with a conflict instead of a failed precondition when they race with another write on some stores
+*/
+func isConditionFailure(err error) bool {
+	code := getErrorCode(err)
+	return code == "PreconditionFailed" || code == "ConditionalRequestConflict"
+}
+
+/*
+Writes the lock if it does not exist, or if it was not modified since it had the given etag.
+As a write can succeed without its response being received, a condition failure after a retry may be caused by our own write:
+the lock is then read back and taken as ours if it is held by the holder.
+*/
+func (backend *LockBackend) put(holder lock.Holder, etag string) (string, error) {
+	content, marshalErr := json.MarshalIndent(holder, "", "  ")
+	if marshalErr != nil {
+		return "", marshalErr
+	}
+
+	opts := minio.PutObjectOptions{ContentType: "application/json"}
+	if etag == "" {
+		opts.SetMatchETagExcept("*")
+	} else {
+		opts.SetMatchETag(etag)
+	}
+
+	var info minio.UploadInfo
+	attempts := 0
+	policy := getRetryPolicy(backend.s3Conf)
+	putErr := withRetries(backend.s3Conf, "lock", backend.name, policy.OperationTimeout, func(ctx context.Context) error {
+		attempts++
+		var err error
+		info, err = backend.cli.PutObject(ctx, backend.s3Conf.Bucket, backend.name, bytes.NewReader(content), int64(len(content)), opts)
+		return err
+	})
+
+	if attempts > 1 && isConditionFailure(putErr) {
+		current, currentEtag, found, getErr := backend.get()
+		if getErr == nil && found && current.Id == holder.Id {
+			return currentEtag, nil
+		}
+	}
+
+	return info.ETag, putErr
+}
+
+/*
+Returns the current holder of the lock with the etag of the lock object
+*/
+func (backend *LockBackend) get() (lock.Holder, string, bool, error) {
+	holder := lock.Holder{}
+
+	info, statErr := statObject(backend.cli, backend.s3Conf, backend.name)
+	if statErr != nil {
+		if getErrorCode(statErr) == "NoSuchKey" {
+			return holder, "", false, nil
+		}
+		return holder, "", false, statErr
+	}
+
+	content, getErr := getObjectContent(backend.cli, backend.s3Conf, backend.name)
+	if getErr != nil {
+		if getErrorCode(getErr) == "NoSuchKey" {
+			return holder, "", false, nil
+		}
+		return holder, "", false, getErr
+	}
+
+	//A lock that cannot be parsed is handled like an expired lock, so that it can be taken over
+	json.Unmarshal(content, &holder)
+	return holder, info.ETag, true, nil
+}
+
+func (backend *LockBackend) TryAcquire(holder lock.Holder) (lock.Holder, bool, error) {
+	etag, putErr := backend.put(holder, "")
+	if putErr == nil {
+		backend.etag = etag
+		return holder, true, nil
+	}
+
+	if !isConditionFailure(putErr) {
+		return holder, false, putErr
+	}
+
+	current, currentEtag, found, getErr := backend.get()
+	if getErr != nil {
+		return holder, false, getErr
+	}
+
+	//The lock was released in the meantime and will be tried again
+	if !found {
+		return current, false, nil
+	}
+
+	if !current.IsExpired(time.Now()) {
+		return current, false, nil
+	}
+
+	etag, putErr = backend.put(holder, currentEtag)
+	if putErr != nil {
+		if isConditionFailure(putErr) {
+			return current, false, nil
+		}
+		return holder, false, putErr
+	}
+
+	backend.etag = etag
+	return holder, true, nil
+}
+
+func (backend *LockBackend) Renew(holder lock.Holder) error {
+	etag, putErr := backend.put(holder, backend.etag)
+	if putErr != nil {
+		if isConditionFailure(putErr) {
+			return errors.New("The lock is no longer held")
+		}
+		return putErr
+	}
+
+	backend.etag = etag
+	return nil
+}
+
+func (backend *LockBackend) Release() error {
+	if backend.etag == "" {
+		return nil
+	}
+
+	//The removal of objects is not conditional, so the lock is checked to still be ours just before
+	_, currentEtag, found, getErr := backend.get()
+	if getErr != nil {
+		return getErr
+	}
+
+	if (!found) || currentEtag != backend.etag {
+		backend.etag = ""
+		return errors.New("The lock was taken over by another process")
+	}
+
+	removeErr := removeObject(backend.cli, backend.s3Conf, backend.name)
+	if removeErr != nil {
+		return removeErr
+	}
+
+	backend.etag = ""
+	return nil
+}
+
+func (backend *LockBackend) ForceUnlock() (lock.Holder, bool, error) {
+	current, _, found, getErr := backend.get()
+	if getErr != nil || !found {
+		return current, false, getErr
+	}
+
+	removeErr := removeObject(backend.cli, backend.s3Conf, backend.name)
+	if removeErr != nil {
+		return current, false, removeErr
+	}
+
+	return current, true, nil
+}
@@ -0,0 +1,160 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const MANIFEST_VERSION = 1
+
+type ManifestObject struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+}
+
+type ManifestEncryption struct {
+	Algorithm string         `json:"algorithm"`
+	ChunkSize int64          `json:"chunk_size"`
+	Key       ManifestObject `json:"key"`
+}
+
+/*
+Description of a complete backup, written after all its other objects are stored
+*/
+type Manifest struct {
+	Version        int                 `json:"version"`
+	Timestamp      time.Time           `json:"timestamp"`
+	Dump           ManifestObject      `json:"dump"`
+	SnapshotSha256 string              `json:"snapshot_sha256,omitempty"`
+	Encryption     *ManifestEncryption `json:"encryption,omitempty"`
+	Metadata       map[string]string   `json:"metadata"`
+}
+
+/*
+Writes the manifest of a backup from the objects stored for it, which must all be present.
+The metadata of the dump is recorded in the manifest, except for the checksums which have their own fields.
+*/
+func writeManifest(cli *minio.Client, s3Conf config.S3ClientConfig, entry BackupEntry) error {
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return namingErr
+	}
+
+	backupName, backupKeyName := namingConv.GetObjectNames(entry)
+	manifestName := namingConv.GetManifestName(entry)
+
+	dumpInfo, dumpStatErr := statObject(cli, s3Conf, backupName)
+	if dumpStatErr != nil {
+		return dumpStatErr
+	}
+
+	manifest := Manifest{
+		Version:   MANIFEST_VERSION,
+		Timestamp: entry.Timestamp.UTC(),
+		Dump: ManifestObject{
+			Name:   backupName,
+			Size:   dumpInfo.Size,
+			ETag:   dumpInfo.ETag,
+			Sha256: dumpInfo.UserMetadata[METADATA_OBJECT_SHA256],
+		},
+		SnapshotSha256: dumpInfo.UserMetadata[METADATA_SNAPSHOT_SHA256],
+		Metadata:       map[string]string{},
+	}
+
+	for key, val := range dumpInfo.UserMetadata {
+		if key == METADATA_OBJECT_SHA256 || key == METADATA_SNAPSHOT_SHA256 {
+			continue
+		}
+		manifest.Metadata[key] = val
+	}
+
+	keyInfo, keyStatErr := statObject(cli, s3Conf, backupKeyName)
+	if keyStatErr == nil {
+		//The key object is rewritten by key rotations, so its etag is not recorded
+		manifest.Encryption = &ManifestEncryption{
+			Algorithm: "xchacha20-poly1305",
+			ChunkSize: 1024 * 1024,
+			Key: ManifestObject{
+				Name: backupKeyName,
+				Size: keyInfo.Size,
+			},
+		}
+	} else if getErrorCode(keyStatErr) != "NoSuchKey" {
+		return keyStatErr
+	}
+
+	content, marshalErr := json.MarshalIndent(manifest, "", "  ")
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	policy := getRetryPolicy(s3Conf)
+	return withRetries(s3Conf, "upload", manifestName, policy.OperationTimeout, func(ctx context.Context) error {
+		_, putErr := cli.PutObject(
+			ctx,
+			s3Conf.Bucket,
+			manifestName,
+			bytes.NewReader(content),
+			int64(len(content)),
+			minio.PutObjectOptions{ContentType: "application/json"},
+		)
+		return putErr
+	})
+}
+
+/*
+Writes the manifest of a backup whose dump was stored by an upload that was interrupted before its manifest was written
+*/
+func WriteManifest(s3Conf config.S3ClientConfig, entry BackupEntry) error {
+	cli, cliErr := connect(s3Conf)
+	if cliErr != nil {
+		return cliErr
+	}
+
+	return writeManifest(cli, s3Conf, entry)
+}
+
+/*
+Returns the manifest of a backup. Backups made before manifests were written do not have one.
+*/
+func GetManifest(s3Conf config.S3ClientConfig, entry BackupEntry) (Manifest, error) {
+	var manifest Manifest
+
+	if !entry.ManifestFound {
+		return manifest, errors.New(fmt.Sprintf("Backup '%s' has no manifest", entry.GetTimestamp()))
+	}
+
+	cli, cliErr := connect(s3Conf)
+	if cliErr != nil {
+		return manifest, cliErr
+	}
+
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return manifest, namingErr
+	}
+
+	manifestName := namingConv.GetManifestName(entry)
+
+	content, getErr := getObjectContent(cli, s3Conf, manifestName)
+	if getErr != nil {
+		return manifest, getErr
+	}
+
+	unmarshalErr := json.Unmarshal(content, &manifest)
+	if unmarshalErr != nil {
+		return manifest, errors.New(fmt.Sprintf("Error parsing manifest '%s': %s", manifestName, unmarshalErr.Error()))
+	}
+
+	return manifest, nil
+}
@@ -0,0 +1,277 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/throttle"
+
+	"github.com/minio/minio-go/v7"
+)
+
+/*
+Multipart upload of the dump of a backup, which can be resumed from its upload id if it is interrupted
+*/
+type MultipartBackup struct {
+	UploadId   string
+	core       minio.Core
+	s3Conf     config.S3ClientConfig
+	entry      BackupEntry
+	objectName string
+	keyName    string
+}
+
+//Returns a reader for the content of a part, given its number starting from 1, and the size of the part
+type PartSourceFn func(partNumber int) (io.Reader, int64, error)
+
+/*
+Returns a part size that is a multiple of the given alignment, so that encrypted chunks do not straddle parts
+*/
+func GetPartSize(upConf config.S3UploadConfig, size int64, alignment int64) (int64, error) {
+	partSize, partSizeErr := getPartSize(upConf, size, uint64(alignment))
+	return int64(partSize), partSizeErr
+}
+
+func newMultipartBackup(s3Conf config.S3ClientConfig, entry BackupEntry, uploadId string) (*MultipartBackup, error) {
+	cli, cliErr := connect(s3Conf)
+	if cliErr != nil {
+		return nil, cliErr
+	}
+
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return nil, namingErr
+	}
+
+	backupName, backupKeyName := namingConv.GetObjectNames(entry)
+
+	return &MultipartBackup{
+		UploadId:   uploadId,
+		core:       minio.Core{Client: cli},
+		s3Conf:     s3Conf,
+		entry:      entry,
+		objectName: backupName,
+		keyName:    backupKeyName,
+	}, nil
+}
+
+/*
+Stores the encrypted encryption key of a backup, if any, and initiates the multipart upload of its dump
+*/
+func StartMultipartBackup(s3Conf config.S3ClientConfig, entry BackupEntry, cypherKey []byte, metadata map[string]string) (*MultipartBackup, error) {
+	backup, backupErr := newMultipartBackup(s3Conf, entry, "")
+	if backupErr != nil {
+		return nil, backupErr
+	}
+
+	policy := getRetryPolicy(s3Conf)
+	if len(cypherKey) > 0 {
+		keyErr := withRetries(s3Conf, "upload", backup.keyName, policy.OperationTimeout, func(ctx context.Context) error {
+			_, putErr := backup.core.Client.PutObject(
+				ctx,
+				s3Conf.Bucket,
+				backup.keyName,
+				bytes.NewBuffer(cypherKey),
+				int64(len(cypherKey)),
+				minio.PutObjectOptions{},
+			)
+			return putErr
+		})
+
+		if keyErr != nil {
+			return nil, keyErr
+		}
+	}
+
+	uploadErr := withRetries(s3Conf, "multipart upload initiation", backup.objectName, policy.OperationTimeout, func(ctx context.Context) error {
+		var err error
+		backup.UploadId, err = backup.core.NewMultipartUpload(ctx, s3Conf.Bucket, backup.objectName, minio.PutObjectOptions{UserMetadata: metadata})
+		return err
+	})
+	if uploadErr != nil {
+		return nil, uploadErr
+	}
+
+	return backup, nil
+}
+
+/*
+Returns an incomplete multipart upload of the dump of a backup. An error is returned if the upload no longer exists.
+*/
+func ResumeMultipartBackup(s3Conf config.S3ClientConfig, entry BackupEntry, uploadId string) (*MultipartBackup, error) {
+	backup, backupErr := newMultipartBackup(s3Conf, entry, uploadId)
+	if backupErr != nil {
+		return nil, backupErr
+	}
+
+	_, listErr := backup.ListParts()
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	return backup, nil
+}
+
+/*
+Returns the parts that were already uploaded, by part number
+*/
+func (backup *MultipartBackup) ListParts() (map[int]minio.ObjectPart, error) {
+	parts := map[int]minio.ObjectPart{}
+
+	policy := getRetryPolicy(backup.s3Conf)
+	marker := 0
+	for {
+		var res minio.ListObjectPartsResult
+		listErr := withRetries(backup.s3Conf, "parts listing", backup.objectName, policy.OperationTimeout, func(ctx context.Context) error {
+			var err error
+			res, err = backup.core.ListObjectParts(ctx, backup.s3Conf.Bucket, backup.objectName, backup.UploadId, marker, 1000)
+			return err
+		})
+		if listErr != nil {
+			return parts, listErr
+		}
+
+		for _, part := range res.ObjectParts {
+			parts[part.PartNumber] = part
+		}
+
+		if !res.IsTruncated {
+			return parts, nil
+		}
+		marker = res.NextPartNumberMarker
+	}
+}
+
+/*
+Uploads the parts that are missing from the upload in parallel and completes it.
+Parts that were already uploaded with the expected size are not uploaded again.
+*/
+func (backup *MultipartBackup) Upload(partsCount int, getPart PartSourceFn) error {
+	uploaded, listErr := backup.ListParts()
+	if listErr != nil {
+		return listErr
+	}
+
+	completed := []minio.CompletePart{}
+	pending := []int{}
+	partSize := int64(0)
+	for partNumber := 1; partNumber <= partsCount; partNumber++ {
+		_, size, sourceErr := getPart(partNumber)
+		if sourceErr != nil {
+			return sourceErr
+		}
+		if size > partSize {
+			partSize = size
+		}
+
+		part, ok := uploaded[partNumber]
+		if ok && part.Size == size {
+			completed = append(completed, minio.CompletePart{PartNumber: partNumber, ETag: part.ETag})
+			continue
+		}
+
+		pending = append(pending, partNumber)
+	}
+
+	concurrency, concurrencyErr := getConcurrency(backup.s3Conf.Upload, uint64(partSize))
+	if concurrencyErr != nil {
+		return concurrencyErr
+	}
+
+	//The limiter is shared by the parts uploaded in parallel
+	limiter, limiterErr := getUploadLimiter(backup.s3Conf)
+	if limiterErr != nil {
+		return limiterErr
+	}
+
+	policy := getRetryPolicy(backup.s3Conf)
+	var mutex sync.Mutex
+	var uploadErr error
+	var wg sync.WaitGroup
+	partNumbers := make(chan int)
+
+	for worker := uint(0); worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partNumber := range partNumbers {
+				//The source of the part is obtained again for each attempt, as it cannot be read twice
+				var part minio.ObjectPart
+				partErr := withRetries(backup.s3Conf, fmt.Sprintf("upload of part %d", partNumber), backup.objectName, policy.TransferTimeout, func(ctx context.Context) error {
+					source, size, sourceErr := getPart(partNumber)
+					if sourceErr != nil {
+						return sourceErr
+					}
+
+					var putErr error
+					part, putErr = backup.core.PutObjectPart(ctx, backup.s3Conf.Bucket, backup.objectName, backup.UploadId, partNumber, throttle.NewReader(source, limiter), size, minio.PutObjectPartOptions{})
+					return putErr
+				})
+
+				mutex.Lock()
+				if partErr == nil {
+					completed = append(completed, minio.CompletePart{PartNumber: partNumber, ETag: part.ETag})
+				} else if uploadErr == nil {
+					uploadErr = partErr
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, partNumber := range pending {
+		mutex.Lock()
+		failed := uploadErr != nil
+		mutex.Unlock()
+		if failed {
+			break
+		}
+
+		partNumbers <- partNumber
+	}
+	close(partNumbers)
+	wg.Wait()
+
+	if uploadErr != nil {
+		return uploadErr
+	}
+
+	slices.SortFunc(completed, func(a, b minio.CompletePart) int {
+		return a.PartNumber - b.PartNumber
+	})
+
+	completeErr := withRetries(backup.s3Conf, "multipart upload completion", backup.objectName, policy.OperationTimeout, func(ctx context.Context) error {
+		_, completeErr := backup.core.CompleteMultipartUpload(ctx, backup.s3Conf.Bucket, backup.objectName, backup.UploadId, completed, minio.PutObjectOptions{})
+		return completeErr
+	})
+	if completeErr != nil {
+		return completeErr
+	}
+
+	return writeManifest(backup.core.Client, backup.s3Conf, backup.entry)
+}
+
+/*
+Aborts the upload and removes the encrypted encryption key of the backup, if any
+*/
+func (backup *MultipartBackup) Abort() error {
+	policy := getRetryPolicy(backup.s3Conf)
+	abortErr := withRetries(backup.s3Conf, "multipart upload abortion", backup.objectName, policy.OperationTimeout, func(ctx context.Context) error {
+		return backup.core.AbortMultipartUpload(ctx, backup.s3Conf.Bucket, backup.objectName, backup.UploadId)
+	})
+	if abortErr != nil && getErrorCode(abortErr) != "NoSuchUpload" {
+		return abortErr
+	}
+
+	delErr := removeObject(backup.core.Client, backup.s3Conf, backup.keyName)
+	if delErr != nil && getErrorCode(delErr) != "NoSuchKey" {
+		return delErr
+	}
+
+	return nil
+}
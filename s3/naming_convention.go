@@ -1,10 +1,15 @@
 package s3
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"regexp"
+	"strings"
 	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
 )
 
 type ObjectType int
@@ -12,66 +17,336 @@ type ObjectType int
 const (
     OBJ_TYPE_DUMP ObjectType = iota
     OBJ_TYPE_KEY
+    OBJ_TYPE_MANIFEST
+)
+
+const (
+	//Timestamps with a one second resolution, which was the only naming scheme of previous versions
+	NAMING_SCHEME_SECONDS = "seconds"
+	//Timestamps with a one nanosecond resolution followed by a random suffix, so that backups never overwrite each other
+	NAMING_SCHEME_UNIQUE = "unique"
 )
 
+const (
+	DEFAULT_NAMING_TEMPLATE     = "{prefix}-{timestamp}.{extension}"
+	PARTITIONED_NAMING_TEMPLATE = "{prefix}/{year}/{month}/{day}/{prefix}-{timestamp}.{extension}"
+	//Stands for the extension in the names of backups whose template does not end with it
+	EXTENSION_PLACEHOLDER = "{extension}"
+)
+
+//Layout of the timestamps of the unique naming scheme. Unlike RFC3339Nano, trailing zeros are kept so that names sort chronologically
+const UNIQUE_TIMESTAMP_LAYOUT = "2006-01-02T15:04:05.000000000Z07:00"
+
+var placeholderRegex = regexp.MustCompile("\\{[a-z]+\\}")
+
+//Characters that are replaced in the values of placeholders, so that names can be parsed back
+var unsafeValueRegex = regexp.MustCompile("[^A-Za-z0-9._-]")
+
 type ObjectInfo struct {
+	//Name shared by all the objects of a backup, see BackupEntry
+	Name string
 	Timestamp time.Time
 	Type ObjectType
 }
 
+type namingTemplate struct {
+	template string
+	regex *regexp.Regexp
+	//Matches the names that look like they were meant to follow the template, with a timestamp where expected
+	looseRegex *regexp.Regexp
+	//Part of the names that precedes the first placeholder whose value varies between backups
+	listPrefix string
+}
+
 type NamingConvention struct {
 	Prefix string
-	dumpRegex *regexp.Regexp
-	keyRegex *regexp.Regexp
-	dumpTemplate string
-	keyTemplate string
+	Cluster string
+	Scheme string
+	//Template of the names of new backups
+	template namingTemplate
+	//Templates of the names that are recognized, starting with the one of new backups
+	templates []namingTemplate
+}
+
+func sanitizePlaceholderValue(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+
+	return unsafeValueRegex.ReplaceAllString(value, "_")
+}
+
+/*
+Returns the name of a backup from the name of one of its objects in which the extension was replaced by a placeholder.
+Names ending with the extension are stripped of it, as was always the case before templates were supported.
+*/
+func getEntryName(name string) string {
+	if strings.HasSuffix(name, "." + EXTENSION_PLACEHOLDER) && strings.Count(name, EXTENSION_PLACEHOLDER) == 1 {
+		return strings.TrimSuffix(name, "." + EXTENSION_PLACEHOLDER)
+	}
+
+	return name
+}
+
+/*
+Parses a naming template, given the values of the placeholders that are the same for all the backups of a naming convention.
+Literal parts and values are escaped. The timestamp and extension placeholders must appear exactly once so that the objects of a backup can be told apart.
+*/
+func parseNamingTemplate(template string, prefix string, cluster string) (namingTemplate, error) {
+	fixed := map[string]string{
+		"{prefix}":  prefix,
+		"{cluster}": sanitizePlaceholderValue(cluster),
+	}
+
+	//Strict and loose pattern of each placeholder whose value varies between backups
+	patterns := map[string][2]string{
+		"{timestamp}": {"(?P<time>\\d+-\\d+-\\d+T\\d+:\\d+:\\d+(\\.\\d+)?(Z|[+-]\\d+:\\d+))(-[0-9a-f]+)?", "\\d[^/]*"},
+		"{extension}": {"(?P<extension>dump|key|manifest)", "[^/]*"},
+		"{member}":    {"[A-Za-z0-9._-]+", "[^/]+"},
+		"{year}":      {"\\d{4}", "[^/]+"},
+		"{month}":     {"\\d{2}", "[^/]+"},
+		"{day}":       {"\\d{2}", "[^/]+"},
+	}
+
+	counts := map[string]int{}
+	regex := "^"
+	looseRegex := "^"
+	listPrefix := ""
+	variable := false
+	position := 0
+	for _, loc := range placeholderRegex.FindAllStringIndex(template, -1) {
+		literal := template[position:loc[0]]
+		placeholder := template[loc[0]:loc[1]]
+		position = loc[1]
+
+		regex += regexp.QuoteMeta(literal)
+		looseRegex += regexp.QuoteMeta(literal)
+		if !variable {
+			listPrefix += literal
+		}
+
+		if value, ok := fixed[placeholder]; ok {
+			regex += regexp.QuoteMeta(value)
+			looseRegex += regexp.QuoteMeta(value)
+			if !variable {
+				listPrefix += value
+			}
+			continue
+		}
+
+		pattern, ok := patterns[placeholder]
+		if !ok {
+			return namingTemplate{}, errors.New(fmt.Sprintf("Unknown placeholder '%s' in naming template '%s'", placeholder, template))
+		}
+
+		counts[placeholder] += 1
+		regex += pattern[0]
+		looseRegex += pattern[1]
+		variable = true
+	}
+
+	if counts["{timestamp}"] != 1 || counts["{extension}"] != 1 {
+		return namingTemplate{}, errors.New(fmt.Sprintf("Naming template '%s' must contain the {timestamp} and {extension} placeholders exactly once", template))
+	}
+
+	literal := template[position:]
+	regex += regexp.QuoteMeta(literal) + "$"
+	looseRegex += regexp.QuoteMeta(literal) + "$"
+
+	return namingTemplate{
+		template: template,
+		regex: regexp.MustCompile(regex),
+		looseRegex: regexp.MustCompile(looseRegex),
+		listPrefix: listPrefix,
+	}, nil
 }
 
+/*
+Returns a naming convention that names backups after the default template, with a one second resolution
+*/
 func NewNamingConvention(prefix string) NamingConvention {
-	return NamingConvention{
+	conv, _ := newNamingConvention(prefix, "", NAMING_SCHEME_SECONDS, DEFAULT_NAMING_TEMPLATE)
+	return conv
+}
+
+func newNamingConvention(prefix string, cluster string, scheme string, template string) (NamingConvention, error) {
+	conv := NamingConvention{
 		Prefix: prefix,
-		dumpRegex: regexp.MustCompile(fmt.Sprintf("^%s-(?P<timestamp>\\d+-\\d+-\\d+T\\d+:\\d+:\\d+(Z|-(\\d+:\\d+)))\\.dump$", prefix)),
-		keyRegex: regexp.MustCompile(fmt.Sprintf("^%s-(?P<timestamp>\\d+-\\d+-\\d+T\\d+:\\d+:\\d+(Z|-(\\d+:\\d+)))\\.key$", prefix)),
-		dumpTemplate: fmt.Sprintf("%s-%%s.dump", prefix),
-		keyTemplate: fmt.Sprintf("%s-%%s.key", prefix),
+		Cluster: cluster,
+		Scheme: scheme,
+		templates: []namingTemplate{},
+	}
+
+	if scheme != NAMING_SCHEME_SECONDS && scheme != NAMING_SCHEME_UNIQUE {
+		return conv, errors.New(fmt.Sprintf("Unsupported naming scheme '%s'", scheme))
 	}
+
+	var templateErr error
+	conv.template, templateErr = parseNamingTemplate(template, prefix, cluster)
+	if templateErr != nil {
+		return conv, templateErr
+	}
+	conv.templates = append(conv.templates, conv.template)
+
+	//Backups made before the template changed remain recognized
+	for _, defaultTemplate := range []string{DEFAULT_NAMING_TEMPLATE, PARTITIONED_NAMING_TEMPLATE} {
+		if defaultTemplate != template {
+			parsed, _ := parseNamingTemplate(defaultTemplate, prefix, cluster)
+			conv.templates = append(conv.templates, parsed)
+		}
+	}
+
+	return conv, nil
 }
 
-func (conv *NamingConvention) GetObjectNames(timestamp time.Time) (string, string) {
-	timeStr := timestamp.UTC().Format(time.RFC3339)
+/*
+Returns the naming convention of the backups of an s3 configuration.
+Whatever the naming scheme and template used for new backups, the names of all schemes and of the default layouts are recognized.
+*/
+func GetNamingConvention(s3Conf config.S3ClientConfig) (NamingConvention, error) {
+	scheme := s3Conf.Naming.Scheme
+	if scheme == "" {
+		scheme = NAMING_SCHEME_SECONDS
+	}
 
-	return fmt.Sprintf(conv.dumpTemplate, timeStr),
-		fmt.Sprintf(conv.keyTemplate, timeStr)
+	template := s3Conf.Naming.Template
+	if template == "" {
+		template = DEFAULT_NAMING_TEMPLATE
+		if s3Conf.Naming.DatePartitioned {
+			template = PARTITIONED_NAMING_TEMPLATE
+		}
+	}
+
+	return newNamingConvention(s3Conf.ObjectsPrefix, s3Conf.Naming.Cluster, scheme, template)
 }
 
-func (conv *NamingConvention) GetObjectInfo(objName string) (ObjectInfo, error) {
-	if conv.dumpRegex.MatchString(objName) {
-		match := conv.dumpRegex.FindStringSubmatch(objName)
+/*
+Returns the prefixes under which the recognized objects can be, none of which is nested in another
+*/
+func (conv *NamingConvention) GetListPrefixes() []string {
+	prefixes := []string{}
+	for _, template := range conv.templates {
+		nested := false
+		for _, other := range conv.templates {
+			if other.listPrefix != template.listPrefix && strings.HasPrefix(template.listPrefix, other.listPrefix) {
+				nested = true
+			}
+		}
 
-		t, parseErr := time.Parse(time.RFC3339, match[1])
-		if parseErr != nil {
-			return ObjectInfo{}, errors.New(fmt.Sprintf("Timestamp '%s' in object '%s' does not parse properly", match[1], objName))
+		for _, prefix := range prefixes {
+			if prefix == template.listPrefix {
+				nested = true
+			}
 		}
 
-		return ObjectInfo{
-			Timestamp: t,
-			Type: OBJ_TYPE_DUMP,
-		}, nil
+		if !nested {
+			prefixes = append(prefixes, template.listPrefix)
+		}
+	}
+
+	return prefixes
+}
+
+/*
+Returns a new backup taken at the given time from the given member, named according to the naming convention
+*/
+func (conv *NamingConvention) NewEntry(timestamp time.Time, member string) (BackupEntry, error) {
+	timestamp = timestamp.UTC()
+
+	var timeStr string
+	switch conv.Scheme {
+	case NAMING_SCHEME_SECONDS:
+		timestamp = timestamp.Truncate(time.Second)
+		timeStr = timestamp.Format(time.RFC3339)
+	case NAMING_SCHEME_UNIQUE:
+		suffix := make([]byte, 4)
+		_, randErr := rand.Read(suffix)
+		if randErr != nil {
+			return BackupEntry{}, randErr
+		}
+
+		timeStr = fmt.Sprintf("%s-%s", timestamp.Format(UNIQUE_TIMESTAMP_LAYOUT), hex.EncodeToString(suffix))
+	default:
+		return BackupEntry{}, errors.New(fmt.Sprintf("Unsupported naming scheme '%s'", conv.Scheme))
 	}
 
-	if conv.keyRegex.MatchString(objName) {
-		match := conv.keyRegex.FindStringSubmatch(objName)
+	name := placeholderRegex.ReplaceAllStringFunc(conv.template.template, func(placeholder string) string {
+		switch placeholder {
+		case "{prefix}":
+			return conv.Prefix
+		case "{cluster}":
+			return sanitizePlaceholderValue(conv.Cluster)
+		case "{member}":
+			return sanitizePlaceholderValue(member)
+		case "{timestamp}":
+			return timeStr
+		case "{year}":
+			return timestamp.Format("2006")
+		case "{month}":
+			return timestamp.Format("01")
+		case "{day}":
+			return timestamp.Format("02")
+		default:
+			return placeholder
+		}
+	})
+
+	return BackupEntry{Name: getEntryName(name), Timestamp: timestamp}, nil
+}
+
+func (conv *NamingConvention) GetObjectNames(entry BackupEntry) (string, string) {
+	return entry.GetObjectName("dump"), entry.GetObjectName("key")
+}
+
+func (conv *NamingConvention) GetManifestName(entry BackupEntry) string {
+	return entry.GetObjectName("manifest")
+}
+
+/*
+Returns whether an object that does not match the naming convention looks like it was meant to, with a timestamp where expected
+*/
+func (conv *NamingConvention) IsNearMiss(objName string) bool {
+	for _, template := range conv.templates {
+		if template.looseRegex.MatchString(objName) {
+			return true
+		}
+	}
 
-		t, parseErr := time.Parse(time.RFC3339, match[1])
+	return false
+}
+
+func (conv *NamingConvention) GetObjectInfo(objName string) (ObjectInfo, error) {
+	for _, template := range conv.templates {
+		match := template.regex.FindStringSubmatchIndex(objName)
+		if match == nil {
+			continue
+		}
+
+		timeIdx := template.regex.SubexpIndex("time")
+		timestamp := objName[match[2*timeIdx]:match[2*timeIdx+1]]
+		t, parseErr := time.Parse(time.RFC3339, timestamp)
 		if parseErr != nil {
-			return ObjectInfo{}, errors.New(fmt.Sprintf("Timestamp '%s' in object '%s' does not parse properly", match[1], objName))
+			return ObjectInfo{}, errors.New(fmt.Sprintf("Timestamp '%s' in object '%s' does not parse properly", timestamp, objName))
 		}
 
-		return ObjectInfo{
+		extIdx := template.regex.SubexpIndex("extension")
+		extStart, extEnd := match[2*extIdx], match[2*extIdx+1]
+		info := ObjectInfo{
+			Name: getEntryName(objName[:extStart] + EXTENSION_PLACEHOLDER + objName[extEnd:]),
 			Timestamp: t,
-			Type: OBJ_TYPE_KEY,
-		}, nil
+		}
+
+		switch objName[extStart:extEnd] {
+		case "dump":
+			info.Type = OBJ_TYPE_DUMP
+		case "key":
+			info.Type = OBJ_TYPE_KEY
+		case "manifest":
+			info.Type = OBJ_TYPE_MANIFEST
+		}
+
+		return info, nil
 	}
 
 	return ObjectInfo{}, errors.New(fmt.Sprintf("Object name '%s' does not match the expected object name format", objName))
-}
\ No newline at end of file
+}
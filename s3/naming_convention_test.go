@@ -0,0 +1,130 @@
+package s3
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+)
+
+func TestNewEntry(t *testing.T) {
+	timestamp := time.Date(2024, 12, 6, 21, 22, 25, 123456000, time.UTC)
+
+	conv := NewNamingConvention("backup")
+	entry, entryErr := conv.NewEntry(timestamp, "etcd-1")
+	if entryErr != nil || entry.Name != "backup-2024-12-06T21:22:25Z" || !entry.Timestamp.Equal(timestamp.Truncate(time.Second)) {
+		t.Errorf("Expected a backup named with a one second resolution. Got %+v, %v", entry, entryErr)
+	}
+
+	conv, convErr := GetNamingConvention(config.S3ClientConfig{ObjectsPrefix: "backup", Naming: config.S3NamingConfig{Scheme: NAMING_SCHEME_UNIQUE, DatePartitioned: true}})
+	if convErr != nil {
+		t.Errorf("Expected the date partitioned layout to be valid. Got %v", convErr)
+		return
+	}
+
+	entry, entryErr = conv.NewEntry(timestamp, "etcd-1")
+	if entryErr != nil || !regexp.MustCompile("^backup/2024/12/06/backup-2024-12-06T21:22:25.123456000Z-[0-9a-f]{8}$").MatchString(entry.Name) || !entry.Timestamp.Equal(timestamp) {
+		t.Errorf("Expected a date partitioned backup named with a one nanosecond resolution and a suffix. Got %+v, %v", entry, entryErr)
+	}
+
+	other, otherErr := conv.NewEntry(timestamp, "etcd-1")
+	if otherErr != nil || other.Name == entry.Name {
+		t.Errorf("Expected backups taken at the same time to have different names. Got '%s' twice, %v", entry.Name, otherErr)
+	}
+}
+
+func TestGetObjectInfo(t *testing.T) {
+	conv := NewNamingConvention("backup")
+
+	info, infoErr := conv.GetObjectInfo("backup-2024-12-06T21:22:25Z.dump")
+	if infoErr != nil || info.Name != "backup-2024-12-06T21:22:25Z" || info.Type != OBJ_TYPE_DUMP || !info.Timestamp.Equal(time.Date(2024, 12, 6, 21, 22, 25, 0, time.UTC)) {
+		t.Errorf("Expected flat names with a one second resolution to parse. Got %+v, %v", info, infoErr)
+	}
+
+	info, infoErr = conv.GetObjectInfo("backup/2024/12/06/backup-2024-12-06T21:22:25.000000001Z-0a1b2c3d.key")
+	if infoErr != nil || info.Name != "backup/2024/12/06/backup-2024-12-06T21:22:25.000000001Z-0a1b2c3d" || info.Type != OBJ_TYPE_KEY || info.Timestamp.Nanosecond() != 1 {
+		t.Errorf("Expected date partitioned names with a one nanosecond resolution to parse. Got %+v, %v", info, infoErr)
+	}
+
+	_, infoErr = conv.GetObjectInfo("backup-export-2024-12-06T21:22:25Z.dump")
+	if infoErr == nil {
+		t.Errorf("Expected the objects of another prefix not to parse")
+	}
+}
+
+func TestNamingTemplate(t *testing.T) {
+	timestamp := time.Date(2024, 12, 6, 21, 22, 25, 0, time.UTC)
+	s3Conf := config.S3ClientConfig{
+		ObjectsPrefix: "etcd.backup+",
+		Naming: config.S3NamingConfig{
+			Template: "{prefix}/{cluster}/{extension}/{member}-{timestamp}",
+			Cluster: "main",
+		},
+	}
+
+	conv, convErr := GetNamingConvention(s3Conf)
+	if convErr != nil {
+		t.Errorf("Expected the template to be valid. Got %v", convErr)
+		return
+	}
+
+	entry, entryErr := conv.NewEntry(timestamp, "etcd 1")
+	if entryErr != nil || entry.Name != "etcd.backup+/main/{extension}/etcd_1-2024-12-06T21:22:25Z" {
+		t.Errorf("Expected the backup to be named after the template. Got %+v, %v", entry, entryErr)
+	}
+
+	dumpName, keyName := conv.GetObjectNames(entry)
+	if dumpName != "etcd.backup+/main/dump/etcd_1-2024-12-06T21:22:25Z" || keyName != "etcd.backup+/main/key/etcd_1-2024-12-06T21:22:25Z" {
+		t.Errorf("Expected the extension placeholder to be replaced in object names. Got '%s' and '%s'", dumpName, keyName)
+	}
+
+	info, infoErr := conv.GetObjectInfo(conv.GetManifestName(entry))
+	if infoErr != nil || info.Name != entry.Name || info.Type != OBJ_TYPE_MANIFEST || !info.Timestamp.Equal(timestamp) {
+		t.Errorf("Expected object names to parse back to their backup. Got %+v, %v", info, infoErr)
+	}
+
+	info, infoErr = conv.GetObjectInfo("etcd.backup+-2024-12-06T21:22:25Z.dump")
+	if infoErr != nil || info.Name != "etcd.backup+-2024-12-06T21:22:25Z" {
+		t.Errorf("Expected names of the default layout to remain recognized. Got %+v, %v", info, infoErr)
+	}
+
+	_, infoErr = conv.GetObjectInfo("etcdxbackup+-2024-12-06T21:22:25Z.dump")
+	if infoErr == nil {
+		t.Errorf("Expected the prefix to be matched literally")
+	}
+
+	_, infoErr = conv.GetObjectInfo("etcd.backup+/other/dump/etcd_1-2024-12-06T21:22:25Z")
+	if infoErr == nil {
+		t.Errorf("Expected the objects of another cluster not to parse")
+	}
+
+	if !conv.IsNearMiss("etcd.backup+/main/dump/etcd_1-2024-12-06") {
+		t.Errorf("Expected a truncated name to be a near miss")
+	}
+
+	prefixes := conv.GetListPrefixes()
+	if len(prefixes) != 2 || prefixes[0] != "etcd.backup+-" || prefixes[1] != "etcd.backup+/" {
+		t.Errorf("Expected the listing prefixes of the default layouts, which contain the one of the template. Got %v", prefixes)
+	}
+}
+
+func TestNamingTemplateValidation(t *testing.T) {
+	invalids := []string{
+		"{prefix}-{timestamp}",
+		"{prefix}-{timestamp}-{timestamp}.{extension}",
+		"{prefix}-{host}-{timestamp}.{extension}",
+	}
+
+	for _, template := range invalids {
+		_, convErr := GetNamingConvention(config.S3ClientConfig{ObjectsPrefix: "backup", Naming: config.S3NamingConfig{Template: template}})
+		if convErr == nil {
+			t.Errorf("Expected template '%s' to be invalid", template)
+		}
+	}
+
+	_, convErr := GetNamingConvention(config.S3ClientConfig{ObjectsPrefix: "backup", Naming: config.S3NamingConfig{Scheme: "minutes"}})
+	if convErr == nil {
+		t.Errorf("Expected an unsupported naming scheme to be invalid")
+	}
+}
@@ -2,6 +2,7 @@ package s3
 
 import (
 	"context"
+	"slices"
 	"time"
 
 	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
@@ -9,18 +10,33 @@ import (
 	"github.com/minio/minio-go/v7"
 )
 
-func PruneBackupEntry(cli *minio.Client, bucket string, namingConv NamingConvention, entry BackupEntry) error {
-	backupName, backupKeyName := namingConv.GetObjectNames(entry.Timestamp)
+func removeObject(cli *minio.Client, s3Conf config.S3ClientConfig, name string) error {
+	policy := getRetryPolicy(s3Conf)
+	return withRetries(s3Conf, "deletion", name, policy.OperationTimeout, func(ctx context.Context) error {
+		return cli.RemoveObject(ctx, s3Conf.Bucket, name, minio.RemoveObjectOptions{})
+	})
+}
+
+func PruneBackupEntry(cli *minio.Client, s3Conf config.S3ClientConfig, namingConv NamingConvention, entry BackupEntry) error {
+	backupName, backupKeyName := namingConv.GetObjectNames(entry)
+
+	//The manifest is removed first so that a backup is never seen as complete while its objects are removed
+	if entry.ManifestFound {
+		delErr := removeObject(cli, s3Conf, namingConv.GetManifestName(entry))
+		if delErr != nil {
+			return delErr
+		}
+	}
 
 	if entry.DumpFound {
-		delErr := cli.RemoveObject(context.Background(), bucket, backupName, minio.RemoveObjectOptions{})
+		delErr := removeObject(cli, s3Conf, backupName)
 		if delErr != nil {
 			return delErr
 		}
 	}
 
 	if entry.Encrypted {
-		delErr := cli.RemoveObject(context.Background(), bucket, backupKeyName, minio.RemoveObjectOptions{})
+		delErr := removeObject(cli, s3Conf, backupKeyName)
 		if delErr != nil {
 			return delErr
 		}
@@ -29,15 +45,21 @@ func PruneBackupEntry(cli *minio.Client, bucket string, namingConv NamingConvent
 	return nil
 }
 
-func Prune(s3Conf config.S3ClientConfig, expiry time.Duration, minCount int64) error {
+/*
+Removes the backups that are older than the expiry, keeping at least the minimum count. Stops once the context is cancelled.
+*/
+func Prune(ctx context.Context, s3Conf config.S3ClientConfig, expiry time.Duration, minCount int64) error {
 	cli, cliErr := connect(s3Conf)
 	if cliErr != nil {
 		return cliErr
 	}
 
-	namingConv := NewNamingConvention(s3Conf.ObjectsPrefix)
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return namingErr
+	}
 
-	entries, listErr := ListBackups(cli, s3Conf.Bucket, namingConv)
+	entries, listErr := ListBackups(cli, s3Conf, namingConv)
 	if listErr != nil {
 		return listErr
 	}
@@ -45,11 +67,42 @@ func Prune(s3Conf config.S3ClientConfig, expiry time.Duration, minCount int64) e
 	deletables := entries.GetDeletable(time.Now().Add(-expiry), minCount)
 
 	for _, entry := range deletables {
-		delErr := PruneBackupEntry(cli, s3Conf.Bucket, namingConv, entry)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		delErr := PruneBackupEntry(cli, s3Conf, namingConv, entry)
 		if delErr != nil {
 			return delErr
 		}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+/*
+Returns the backups that would be removed by a prune, from the oldest to the most recent, without removing them
+*/
+func GetPrunable(s3Conf config.S3ClientConfig, expiry time.Duration, minCount int64) ([]BackupEntry, error) {
+	cli, cliErr := connect(s3Conf)
+	if cliErr != nil {
+		return []BackupEntry{}, cliErr
+	}
+
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return []BackupEntry{}, namingErr
+	}
+
+	entries, listErr := ListBackups(cli, s3Conf, namingConv)
+	if listErr != nil {
+		return []BackupEntry{}, listErr
+	}
+
+	deletables := entries.GetDeletable(time.Now().Add(-expiry), minCount)
+	slices.SortFunc(deletables, func(a, b BackupEntry) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	return deletables, nil
+}
@@ -0,0 +1,159 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/throttle"
+
+	"github.com/minio/minio-go/v7"
+)
+
+//Metadata recording the etag of the source object on replicated objects, to detect that they are up to date
+const METADATA_SOURCE_ETAG = "Source-Etag"
+
+type ReplicationResult struct {
+	Copied  []string
+	Skipped []string
+}
+
+func replicateObject(srcCli *minio.Client, srcConf config.S3ClientConfig, dstCli *minio.Client, dstConf config.S3ClientConfig, name string) (bool, error) {
+	srcInfo, srcStatErr := statObject(srcCli, srcConf, name)
+	if srcStatErr != nil {
+		return false, srcStatErr
+	}
+
+	dstInfo, dstStatErr := statObject(dstCli, dstConf, name)
+	if dstStatErr == nil {
+		if dstInfo.Size == srcInfo.Size && dstInfo.UserMetadata[METADATA_SOURCE_ETAG] == srcInfo.ETag {
+			return false, nil
+		}
+	} else if getErrorCode(dstStatErr) != "NoSuchKey" {
+		return false, dstStatErr
+	}
+
+	putOpts, putOptsErr := getPutOptions(dstConf.Upload, srcInfo.Size)
+	if putOptsErr != nil {
+		return false, putOptsErr
+	}
+
+	metadata := map[string]string{}
+	for key, val := range srcInfo.UserMetadata {
+		metadata[key] = val
+	}
+	metadata[METADATA_SOURCE_ETAG] = srcInfo.ETag
+	putOpts.UserMetadata = metadata
+
+	downloadLimiter, downloadLimiterErr := getDownloadLimiter(srcConf)
+	if downloadLimiterErr != nil {
+		return false, downloadLimiterErr
+	}
+
+	uploadLimiter, uploadLimiterErr := getUploadLimiter(dstConf)
+	if uploadLimiterErr != nil {
+		return false, uploadLimiterErr
+	}
+
+	//The copy is retried from the start, as the source object can be downloaded again
+	policy := getRetryPolicy(dstConf)
+	copyErr := withRetries(dstConf, "replication", name, policy.TransferTimeout, func(ctx context.Context) error {
+		srcObj, srcObjErr := srcCli.GetObject(ctx, srcConf.Bucket, name, minio.GetObjectOptions{})
+		if srcObjErr != nil {
+			return srcObjErr
+		}
+		defer srcObj.Close()
+
+		_, putErr := dstCli.PutObject(
+			ctx,
+			dstConf.Bucket,
+			name,
+			throttle.NewReader(throttle.NewReader(srcObj, downloadLimiter), uploadLimiter),
+			srcInfo.Size,
+			putOpts,
+		)
+		return putErr
+	})
+
+	return true, copyErr
+}
+
+/*
+Copies the objects of the backups in the source store that are missing or outdated in the destination store.
+If an expiry is specified, backups the destination's retention would prune are not copied and the destination is pruned afterwards.
+Stops once the context is cancelled.
+*/
+func Replicate(ctx context.Context, srcConf config.S3ClientConfig, dstConf config.S3ClientConfig, expiry time.Duration, minCount int64) (ReplicationResult, error) {
+	result := ReplicationResult{Copied: []string{}, Skipped: []string{}}
+
+	srcCli, srcCliErr := connect(srcConf)
+	if srcCliErr != nil {
+		return result, srcCliErr
+	}
+
+	dstCli, dstCliErr := connect(dstConf)
+	if dstCliErr != nil {
+		return result, dstCliErr
+	}
+
+	namingConv, namingErr := GetNamingConvention(srcConf)
+	if namingErr != nil {
+		return result, namingErr
+	}
+
+	entries, listErr := ListBackups(srcCli, srcConf, namingConv)
+	if listErr != nil {
+		return result, listErr
+	}
+
+	excluded := map[string]bool{}
+	if expiry > 0 {
+		for _, entry := range entries.GetDeletable(time.Now().Add(-expiry), minCount) {
+			excluded[entry.Name] = true
+		}
+	}
+
+	for _, entry := range entries.Entries {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		if (!entry.Complete) || excluded[entry.Name] {
+			continue
+		}
+
+		//The objects are copied in the order of backups, so that a dump is never present without its key and the manifest comes last
+		backupName, backupKeyName := namingConv.GetObjectNames(entry)
+		names := []string{backupName}
+		if entry.Encrypted {
+			names = []string{backupKeyName, backupName}
+		}
+		if entry.ManifestFound {
+			names = append(names, namingConv.GetManifestName(entry))
+		}
+
+		for _, name := range names {
+			copied, copyErr := replicateObject(srcCli, srcConf, dstCli, dstConf, name)
+			if copyErr != nil {
+				return result, errors.New(fmt.Sprintf("Error replicating object '%s': %s", name, copyErr.Error()))
+			}
+
+			if copied {
+				result.Copied = append(result.Copied, name)
+			} else {
+				result.Skipped = append(result.Skipped, name)
+			}
+		}
+	}
+
+	if expiry > 0 {
+		pruneErr := Prune(ctx, dstConf, expiry, minCount)
+		if pruneErr != nil {
+			return result, errors.New(fmt.Sprintf("Error pruning the destination: %s", pruneErr.Error()))
+		}
+	}
+
+	return result, nil
+}
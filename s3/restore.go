@@ -3,69 +3,227 @@ package s3
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"slices"
 	"time"
 
 	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/throttle"
 
 	"github.com/minio/minio-go/v7"
 )
 
-func Restore(s3Conf config.S3ClientConfig, timestamp string) (io.Reader, []byte, error) {
+func getObjectContent(cli *minio.Client, s3Conf config.S3ClientConfig, name string) ([]byte, error) {
+	var key []byte
+
+	policy := getRetryPolicy(s3Conf)
+	keyErr := withRetries(s3Conf, "download", name, policy.OperationTimeout, func(ctx context.Context) error {
+		keyObj, keyObjErr := cli.GetObject(ctx, s3Conf.Bucket, name, minio.GetObjectOptions{})
+		if keyObjErr != nil {
+			return keyObjErr
+		}
+		defer keyObj.Close()
+
+		var readErr error
+		key, readErr = ioutil.ReadAll(keyObj)
+		return readErr
+	})
+
+	return key, keyErr
+}
+
+func downloadEntry(cli *minio.Client, s3Conf config.S3ClientConfig, namingconv NamingConvention, entry BackupEntry, offset int64) (io.Reader, []byte, error) {
+	key := []byte{}
+	dumpKey, keyKey := namingconv.GetObjectNames(entry)
+
+	if entry.Encrypted {
+		var keyErr error
+		key, keyErr = getObjectContent(cli, s3Conf, keyKey)
+		if keyErr != nil {
+			return nil, key, keyErr
+		}
+	}
+
+	limiter, limiterErr := getDownloadLimiter(s3Conf)
+	if limiterErr != nil {
+		return nil, key, limiterErr
+	}
+
+	return throttle.NewReader(newRetryingReader(cli, s3Conf, dumpKey, offset), limiter), key, nil
+}
+
+/*
+Returns the backup with the given timestamp, or the latest backup if the timestamp is empty
+*/
+func FindEntry(s3Conf config.S3ClientConfig, timestamp string) (BackupEntry, error) {
 	cli, cliErr := connect(s3Conf)
 	if cliErr != nil {
-		return nil, []byte{}, cliErr
+		return BackupEntry{}, cliErr
 	}
 
-	namingconv := NewNamingConvention(s3Conf.ObjectsPrefix)
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return BackupEntry{}, namingErr
+	}
 
-	entries, listErr := ListBackups(cli, s3Conf.Bucket, namingconv)
+	entries, listErr := ListBackups(cli, s3Conf, namingConv)
 	if listErr != nil {
-		return nil, []byte{}, listErr
+		return BackupEntry{}, listErr
 	}
 
-	key := []byte{}
-	var entry BackupEntry
-
 	if timestamp == "" {
-		if entries.LastEntry == nil || (!entries.LastEntry.DumpFound) {
-			return nil, key, errors.New("No valid backups to restore")
+		if entries.LastEntry == nil {
+			return BackupEntry{}, errors.New("No valid backups to restore")
 		}
 
-		entry = *entries.LastEntry
-	} else {
-		timestampTime, parseErr := time.Parse(time.RFC3339, timestamp)
-		if parseErr != nil {
-			return nil, key, parseErr
-		}
+		return *entries.LastEntry, nil
+	}
 
-		var ok bool
-		entry, ok = entries.Entries[timestampTime]
-		if !ok {
-			return nil, key, errors.New("No valid with given timestamp to restore")
-		}
+	timestampTime, parseErr := time.Parse(time.RFC3339, timestamp)
+	if parseErr != nil {
+		return BackupEntry{}, parseErr
 	}
 
-	dumpKey, keyKey := namingconv.GetObjectNames(entry.Timestamp)
-	
-	if entry.Encrypted {
-		keyObj, keyObjErr := cli.GetObject(context.Background(), s3Conf.Bucket, keyKey, minio.GetObjectOptions{})
-		if keyObjErr != nil {
-			return nil, key, keyObjErr
+	//Timestamps given with a one second resolution match the backups of the seconds naming scheme only
+	matches := []BackupEntry{}
+	for _, entry := range entries.Entries {
+		if entry.Complete && entry.Timestamp.Equal(timestampTime) {
+			matches = append(matches, entry)
 		}
-		
-		var keyErr error
-		key, keyErr = ioutil.ReadAll(keyObj)
-		if keyErr != nil {
-			return nil, key, keyErr
+	}
+
+	if len(matches) == 0 {
+		return BackupEntry{}, errors.New("No valid with given timestamp to restore")
+	}
+
+	if len(matches) > 1 {
+		return BackupEntry{}, errors.New(fmt.Sprintf("Several backups have the timestamp '%s'", timestamp))
+	}
+
+	return matches[0], nil
+}
+
+func Restore(s3Conf config.S3ClientConfig, timestamp string) (io.Reader, []byte, error) {
+	entry, entryErr := FindEntry(s3Conf, timestamp)
+	if entryErr != nil {
+		return nil, []byte{}, entryErr
+	}
+
+	return DownloadEntry(s3Conf, entry)
+}
+
+/*
+Returns all the backups, including incomplete ones, sorted from oldest to newest
+*/
+func ListEntries(s3Conf config.S3ClientConfig) ([]BackupEntry, error) {
+	cli, cliErr := connect(s3Conf)
+	if cliErr != nil {
+		return []BackupEntry{}, cliErr
+	}
+
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return []BackupEntry{}, namingErr
+	}
+
+	entries, listErr := ListBackups(cli, s3Conf, namingConv)
+	if listErr != nil {
+		return []BackupEntry{}, listErr
+	}
+
+	all := []BackupEntry{}
+	for _, entry := range entries.Entries {
+		all = append(all, entry)
+	}
+
+	slices.SortFunc(all, func(a, b BackupEntry) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	return all, nil
+}
+
+/*
+Returns the complete backups, sorted from oldest to newest
+*/
+func ListDumpEntries(s3Conf config.S3ClientConfig) ([]BackupEntry, error) {
+	entries, listErr := ListEntries(s3Conf)
+	if listErr != nil {
+		return []BackupEntry{}, listErr
+	}
+
+	dumps := []BackupEntry{}
+	for _, entry := range entries {
+		if entry.Complete {
+			dumps = append(dumps, entry)
 		}
 	}
 
-	dumpObj, dumpErr := cli.GetObject(context.Background(), s3Conf.Bucket, dumpKey, minio.GetObjectOptions{})
-	if dumpErr != nil {
-		return nil, key, dumpErr
+	return dumps, nil
+}
+
+func DownloadEntry(s3Conf config.S3ClientConfig, entry BackupEntry) (io.Reader, []byte, error) {
+	return DownloadEntryFrom(s3Conf, entry, 0)
+}
+
+/*
+Returns the dump of a backup starting at the given offset, to resume an interrupted download
+*/
+func DownloadEntryFrom(s3Conf config.S3ClientConfig, entry BackupEntry, offset int64) (io.Reader, []byte, error) {
+	cli, cliErr := connect(s3Conf)
+	if cliErr != nil {
+		return nil, []byte{}, cliErr
+	}
+
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return nil, []byte{}, namingErr
+	}
+
+	return downloadEntry(cli, s3Conf, namingConv, entry, offset)
+}
+
+func statObject(cli *minio.Client, s3Conf config.S3ClientConfig, name string) (minio.ObjectInfo, error) {
+	var info minio.ObjectInfo
+
+	policy := getRetryPolicy(s3Conf)
+	statErr := withRetries(s3Conf, "stat", name, policy.OperationTimeout, func(ctx context.Context) error {
+		var err error
+		info, err = cli.StatObject(ctx, s3Conf.Bucket, name, minio.StatObjectOptions{})
+		return err
+	})
+
+	return info, statErr
+}
+
+/*
+Returns the information of the dump object of a backup
+*/
+func StatEntry(s3Conf config.S3ClientConfig, entry BackupEntry) (minio.ObjectInfo, error) {
+	cli, cliErr := connect(s3Conf)
+	if cliErr != nil {
+		return minio.ObjectInfo{}, cliErr
+	}
+
+	namingconv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return minio.ObjectInfo{}, namingErr
+	}
+
+	dumpKey, _ := namingconv.GetObjectNames(entry)
+	return statObject(cli, s3Conf, dumpKey)
+}
+
+/*
+Returns the user metadata that was stored with the dump of a backup
+*/
+func GetEntryMetadata(s3Conf config.S3ClientConfig, entry BackupEntry) (map[string]string, error) {
+	info, statErr := StatEntry(s3Conf, entry)
+	if statErr != nil {
+		return map[string]string{}, statErr
 	}
 
-	return dumpObj, key, nil
-} 
\ No newline at end of file
+	return info.UserMetadata, nil
+}
@@ -0,0 +1,278 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	DEFAULT_RETRY_ATTEMPTS        = 5
+	DEFAULT_RETRY_INITIAL_BACKOFF = time.Second
+	DEFAULT_RETRY_MAX_BACKOFF     = 30 * time.Second
+	DEFAULT_RETRY_JITTER          = 0.2
+	DEFAULT_OPERATION_TIMEOUT     = 10 * time.Minute
+	DEFAULT_TRANSFER_TIMEOUT      = 24 * time.Hour
+)
+
+type retryPolicy struct {
+	Attempts         uint64
+	InitialBackoff   time.Duration
+	MaxBackoff       time.Duration
+	Jitter           float64
+	OperationTimeout time.Duration
+	TransferTimeout  time.Duration
+}
+
+func getRetryPolicy(s3Conf config.S3ClientConfig) retryPolicy {
+	policy := retryPolicy{
+		Attempts:         s3Conf.Retry.Attempts,
+		InitialBackoff:   s3Conf.Retry.InitialBackoff,
+		MaxBackoff:       s3Conf.Retry.MaxBackoff,
+		Jitter:           DEFAULT_RETRY_JITTER,
+		OperationTimeout: s3Conf.OperationTimeout,
+		TransferTimeout:  s3Conf.TransferTimeout,
+	}
+
+	if policy.Attempts == 0 {
+		policy.Attempts = DEFAULT_RETRY_ATTEMPTS
+	}
+
+	if policy.InitialBackoff == 0 {
+		policy.InitialBackoff = DEFAULT_RETRY_INITIAL_BACKOFF
+	}
+
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = DEFAULT_RETRY_MAX_BACKOFF
+	}
+
+	if s3Conf.Retry.Jitter != nil {
+		policy.Jitter = *s3Conf.Retry.Jitter
+	}
+
+	if policy.OperationTimeout == 0 {
+		policy.OperationTimeout = DEFAULT_OPERATION_TIMEOUT
+	}
+
+	if policy.TransferTimeout == 0 {
+		policy.TransferTimeout = DEFAULT_TRANSFER_TIMEOUT
+	}
+
+	return policy
+}
+
+/*
+Returns the delay before the given retry, starting from 1. The delay doubles with each retry up to the maximum
+and is randomly shortened by up to the jitter fraction so that clients failing together do not retry together.
+*/
+func (policy *retryPolicy) getBackoff(retry uint64) time.Duration {
+	backoff := policy.InitialBackoff
+	for idx := uint64(1); idx < retry && backoff < policy.MaxBackoff; idx++ {
+		backoff = backoff * 2
+	}
+
+	if backoff > policy.MaxBackoff {
+		backoff = policy.MaxBackoff
+	}
+
+	if policy.Jitter > 0 {
+		backoff = backoff - time.Duration(rand.Float64()*policy.Jitter*float64(backoff))
+	}
+
+	return backoff
+}
+
+/*
+Error of an s3 operation, mentioning the operation and the object it was performed on
+*/
+type OperationError struct {
+	Operation string
+	Object    string
+	Attempts  uint64
+	Err       error
+}
+
+func (err *OperationError) Error() string {
+	return fmt.Sprintf("Error during %s of object '%s' after %d attempt(s): %s", err.Operation, err.Object, err.Attempts, err.Err.Error())
+}
+
+func (err *OperationError) Unwrap() error {
+	return err.Err
+}
+
+/*
+Returns the code of the s3 error response wrapped in the error, if any
+*/
+func getErrorCode(err error) string {
+	var errResp minio.ErrorResponse
+	if errors.As(err, &errResp) {
+		return errResp.Code
+	}
+
+	return ""
+}
+
+/*
+Returns whether an error without an s3 error response was caused by the network, rather than by a local operation like reading the source
+*/
+func isNetworkError(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return true
+	}
+
+	//Errors reading the body of requests are also reported as url errors, so only the ones of the connection are retried
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && (urlErr.Timeout() || errors.Is(urlErr.Err, io.EOF)) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, context.DeadlineExceeded)
+}
+
+/*
+Errors that are not caused by the state of the request, like a missing object or denied access, are not retried
+*/
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	errResp := minio.ToErrorResponse(err)
+	if errResp.StatusCode == 0 {
+		return isNetworkError(err)
+	}
+
+	if errResp.StatusCode >= 500 {
+		return true
+	}
+
+	return errResp.StatusCode == http.StatusTooManyRequests || errResp.StatusCode == http.StatusRequestTimeout || errResp.Code == "RequestTimeout" || errResp.Code == "SlowDown"
+}
+
+/*
+Runs an s3 operation with the given deadline for each attempt, retrying it according to the retry policy.
+The error returned on failure mentions the operation and the object it was performed on.
+*/
+func withRetries(s3Conf config.S3ClientConfig, operation string, object string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	policy := getRetryPolicy(s3Conf)
+
+	var err error
+	attempt := uint64(1)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = fn(ctx)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= policy.Attempts || (!isRetryable(err)) {
+			break
+		}
+
+		time.Sleep(policy.getBackoff(attempt))
+		attempt += 1
+	}
+
+	return &OperationError{Operation: operation, Object: object, Attempts: attempt, Err: err}
+}
+
+/*
+Reader of an s3 object that reopens the object from the offset it reached, according to the retry policy, when a read fails
+*/
+type retryingReader struct {
+	cli     *minio.Client
+	s3Conf  config.S3ClientConfig
+	policy  retryPolicy
+	object  string
+	offset  int64
+	retries uint64
+	current *minio.Object
+	cancel  context.CancelFunc
+}
+
+func newRetryingReader(cli *minio.Client, s3Conf config.S3ClientConfig, object string, offset int64) *retryingReader {
+	return &retryingReader{
+		cli:    cli,
+		s3Conf: s3Conf,
+		policy: getRetryPolicy(s3Conf),
+		object: object,
+		offset: offset,
+	}
+}
+
+func (reader *retryingReader) open() error {
+	opts := minio.GetObjectOptions{}
+	if reader.offset > 0 {
+		rangeErr := opts.SetRange(reader.offset, 0)
+		if rangeErr != nil {
+			return rangeErr
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reader.policy.TransferTimeout)
+	obj, objErr := reader.cli.GetObject(ctx, reader.s3Conf.Bucket, reader.object, opts)
+	if objErr != nil {
+		cancel()
+		return objErr
+	}
+
+	reader.current = obj
+	reader.cancel = cancel
+	return nil
+}
+
+func (reader *retryingReader) Read(p []byte) (int, error) {
+	for {
+		var err error
+		n := 0
+		if reader.current == nil {
+			err = reader.open()
+		}
+
+		if err == nil {
+			n, err = reader.current.Read(p)
+			reader.offset += int64(n)
+			if err == nil || err == io.EOF {
+				return n, err
+			}
+		}
+
+		reader.Close()
+		if reader.retries+1 >= reader.policy.Attempts || (!isRetryable(err)) {
+			return n, &OperationError{Operation: fmt.Sprintf("download at offset %d", reader.offset), Object: reader.object, Attempts: reader.retries + 1, Err: err}
+		}
+
+		reader.retries += 1
+		time.Sleep(reader.policy.getBackoff(reader.retries))
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (reader *retryingReader) Close() error {
+	if reader.current == nil {
+		return nil
+	}
+
+	closeErr := reader.current.Close()
+	reader.cancel()
+	reader.current = nil
+	return closeErr
+}
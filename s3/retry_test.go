@@ -0,0 +1,108 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestGetBackoff(t *testing.T) {
+	jitter := 0.0
+	policy := getRetryPolicy(config.S3ClientConfig{Retry: config.S3RetryConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: &jitter}})
+
+	expectations := map[uint64]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second}
+	for retry, expected := range expectations {
+		if backoff := policy.getBackoff(retry); backoff != expected {
+			t.Errorf("Expected a backoff of %s for retry %d. Got %s", expected, retry, backoff)
+		}
+	}
+
+	jitter = 0.5
+	policy = getRetryPolicy(config.S3ClientConfig{Retry: config.S3RetryConfig{InitialBackoff: time.Second, Jitter: &jitter}})
+	for idx := 0; idx < 100; idx++ {
+		if backoff := policy.getBackoff(2); backoff > 2*time.Second || backoff < time.Second {
+			t.Errorf("Expected a backoff between 1s and 2s with a jitter of 0.5. Got %s", backoff)
+			return
+		}
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	s3Conf := config.S3ClientConfig{Retry: config.S3RetryConfig{Attempts: 3, InitialBackoff: time.Millisecond}}
+
+	attempts := 0
+	err := withRetries(s3Conf, "upload", "backup.dump", time.Second, func(ctx context.Context) error {
+		attempts += 1
+		if attempts < 3 {
+			return minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"}
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected the operation to succeed on the third attempt. Got %d attempts, %v", attempts, err)
+	}
+
+	attempts = 0
+	err = withRetries(s3Conf, "upload", "backup.dump", time.Second, func(ctx context.Context) error {
+		attempts += 1
+		return minio.ErrorResponse{StatusCode: http.StatusInternalServerError, Code: "InternalError"}
+	})
+	if err == nil || attempts != 3 {
+		t.Errorf("Expected the operation to fail after 3 attempts. Got %d attempts, %v", attempts, err)
+	}
+
+	attempts = 0
+	err = withRetries(s3Conf, "stat", "backup.dump", time.Second, func(ctx context.Context) error {
+		attempts += 1
+		return minio.ErrorResponse{StatusCode: http.StatusNotFound, Code: "NoSuchKey"}
+	})
+	if attempts != 1 || getErrorCode(err) != "NoSuchKey" {
+		t.Errorf("Expected a missing object not to be retried and its error code to be preserved. Got %d attempts, %v", attempts, err)
+	}
+
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.Operation != "stat" || opErr.Object != "backup.dump" {
+		t.Errorf("Expected the error to mention the operation and the object. Got %v", err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	retryable := []error{
+		minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable},
+		&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED},
+		fmt.Errorf("reading the response: %w", io.ErrUnexpectedEOF),
+		syscall.ECONNRESET,
+		context.DeadlineExceeded,
+		&url.Error{Op: "Put", URL: "https://s3.local/backups", Err: io.EOF},
+	}
+	for _, err := range retryable {
+		if !isRetryable(err) {
+			t.Errorf("Expected error '%v' to be retried", err)
+		}
+	}
+
+	notRetryable := []error{
+		minio.ErrorResponse{StatusCode: http.StatusForbidden, Code: "AccessDenied"},
+		errors.New("Error reading the source"),
+		&fs.PathError{Op: "read", Path: "snapshot.db", Err: syscall.EIO},
+		&url.Error{Op: "Put", URL: "https://s3.local/backups", Err: errors.New("Error encrypting the source")},
+		context.Canceled,
+	}
+	for _, err := range notRetryable {
+		if isRetryable(err) {
+			t.Errorf("Expected error '%v' not to be retried", err)
+		}
+	}
+}
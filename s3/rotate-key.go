@@ -3,7 +3,6 @@ package s3
 import (
 	"bytes"
 	"context"
-	"io/ioutil"
 
 	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
 
@@ -12,32 +11,35 @@ import (
 
 type ConvertKeyFn func([]byte) ([]byte, error)
 
-func RotateKey(s3Conf config.S3ClientConfig, conv ConvertKeyFn) error {
+func RotateKey(ctx context.Context, s3Conf config.S3ClientConfig, conv ConvertKeyFn) error {
 	cli, cliErr := connect(s3Conf)
 	if cliErr != nil {
 		return cliErr
 	}
 
-	namingConv := NewNamingConvention(s3Conf.ObjectsPrefix)
+	namingConv, namingErr := GetNamingConvention(s3Conf)
+	if namingErr != nil {
+		return namingErr
+	}
 
-	entries, listErr := ListBackups(cli, s3Conf.Bucket, namingConv)
+	entries, listErr := ListBackups(cli, s3Conf, namingConv)
 	if listErr != nil {
 		return listErr
 	}
 
+	policy := getRetryPolicy(s3Conf)
 	for _, entry := range entries.Entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		if !entry.Encrypted {
 			continue
 		}
 
-		_, backupKeyName := namingConv.GetObjectNames(entry.Timestamp)
-
-		keyObj, keyObjErr := cli.GetObject(context.Background(), s3Conf.Bucket, backupKeyName, minio.GetObjectOptions{})
-		if keyObjErr != nil {
-			return keyObjErr
-		}
+		_, backupKeyName := namingConv.GetObjectNames(entry)
 
-		keyCypher, keyReadErr := ioutil.ReadAll(keyObj)
+		keyCypher, keyReadErr := getObjectContent(cli, s3Conf, backupKeyName)
 		if keyReadErr != nil {
 			return keyReadErr
 		}
@@ -47,14 +49,17 @@ func RotateKey(s3Conf config.S3ClientConfig, conv ConvertKeyFn) error {
 			return newKeyErr
 		}
 
-		_, keyPutErr := cli.PutObject(
-			context.Background(), 
-			s3Conf.Bucket,
-			backupKeyName,
-			bytes.NewBuffer(newKeyCypher),
-			int64(len(newKeyCypher)),
-			minio.PutObjectOptions{},
-		)
+		keyPutErr := withRetries(s3Conf, "upload", backupKeyName, policy.OperationTimeout, func(ctx context.Context) error {
+			_, putErr := cli.PutObject(
+				ctx,
+				s3Conf.Bucket,
+				backupKeyName,
+				bytes.NewBuffer(newKeyCypher),
+				int64(len(newKeyCypher)),
+				minio.PutObjectOptions{},
+			)
+			return putErr
+		})
 
 		if keyPutErr != nil {
 			return keyPutErr
@@ -0,0 +1,120 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/throttle"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	DEFAULT_PART_SIZE          = 16 * 1024 * 1024
+	DEFAULT_UPLOAD_CONCURRENCY = 4
+	MAX_PARTS_COUNT            = 10000
+	//Minimum size of all the parts of a multipart upload but the last
+	MIN_PART_SIZE = 5 * 1024 * 1024
+)
+
+/*
+Returns the configured part size as a multiple of the given alignment.
+When the size of the object is known, the part size is increased if needed to stay under the maximum number of parts of a multipart upload.
+*/
+func getPartSize(upConf config.S3UploadConfig, size int64, alignment uint64) (uint64, error) {
+	partSize, partSizeErr := config.ParseSize(upConf.PartSize)
+	if partSizeErr != nil {
+		return 0, errors.New(fmt.Sprintf("Error parsing upload part size: %s", partSizeErr.Error()))
+	}
+	if partSize == 0 {
+		partSize = DEFAULT_PART_SIZE
+	}
+
+	if partSize < MIN_PART_SIZE {
+		partSize = MIN_PART_SIZE
+	}
+
+	if size > 0 && uint64(size) > partSize*MAX_PARTS_COUNT {
+		partSize = uint64(size)/MAX_PARTS_COUNT + 1
+	}
+
+	if partSize%alignment != 0 {
+		partSize = (partSize/alignment + 1) * alignment
+	}
+
+	return partSize, nil
+}
+
+/*
+Returns the number of parts to upload in parallel. Parts are buffered in memory while they are uploaded,
+so the concurrency is reduced if needed to stay under the memory limit.
+*/
+func getConcurrency(upConf config.S3UploadConfig, partSize uint64) (uint, error) {
+	concurrency := upConf.Concurrency
+	if concurrency == 0 {
+		concurrency = DEFAULT_UPLOAD_CONCURRENCY
+	}
+
+	memoryLimit, memoryLimitErr := config.ParseSize(upConf.MemoryLimit)
+	if memoryLimitErr != nil {
+		return 0, errors.New(fmt.Sprintf("Error parsing upload memory limit: %s", memoryLimitErr.Error()))
+	}
+
+	if memoryLimit > 0 {
+		if memoryLimit < partSize {
+			return 0, errors.New(fmt.Sprintf("Upload memory limit of %d bytes is lower than the part size of %d bytes", memoryLimit, partSize))
+		}
+
+		if uint64(concurrency)*partSize > memoryLimit {
+			concurrency = uint(memoryLimit / partSize)
+		}
+	}
+
+	return concurrency, nil
+}
+
+/*
+Returns the options to upload an object of the given size (-1 if unknown) with the configured part size and concurrency.
+*/
+func getPutOptions(upConf config.S3UploadConfig, size int64) (minio.PutObjectOptions, error) {
+	partSize, partSizeErr := getPartSize(upConf, size, 1024*1024)
+	if partSizeErr != nil {
+		return minio.PutObjectOptions{}, partSizeErr
+	}
+
+	concurrency, concurrencyErr := getConcurrency(upConf, partSize)
+	if concurrencyErr != nil {
+		return minio.PutObjectOptions{}, concurrencyErr
+	}
+
+	return minio.PutObjectOptions{
+		PartSize:              partSize,
+		NumThreads:            concurrency,
+		ConcurrentStreamParts: concurrency > 1,
+	}, nil
+}
+
+/*
+Returns the limiter of the rate of the uploads, or nil if there is no limit
+*/
+func getUploadLimiter(s3Conf config.S3ClientConfig) (*throttle.Limiter, error) {
+	rate, rateErr := config.ParseSize(s3Conf.RateLimit.Upload)
+	if rateErr != nil {
+		return nil, errors.New(fmt.Sprintf("Error parsing upload rate limit: %s", rateErr.Error()))
+	}
+
+	return throttle.NewLimiter(int64(rate)), nil
+}
+
+/*
+Returns the limiter of the rate of the downloads, or nil if there is no limit
+*/
+func getDownloadLimiter(s3Conf config.S3ClientConfig) (*throttle.Limiter, error) {
+	rate, rateErr := config.ParseSize(s3Conf.RateLimit.Download)
+	if rateErr != nil {
+		return nil, errors.New(fmt.Sprintf("Error parsing download rate limit: %s", rateErr.Error()))
+	}
+
+	return throttle.NewLimiter(int64(rate)), nil
+}
@@ -0,0 +1,43 @@
+package s3
+
+import (
+	"testing"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+)
+
+func TestGetPutOptions(t *testing.T) {
+	opts, optsErr := getPutOptions(config.S3UploadConfig{}, -1)
+	if optsErr != nil || opts.PartSize != DEFAULT_PART_SIZE || opts.NumThreads != DEFAULT_UPLOAD_CONCURRENCY || !opts.ConcurrentStreamParts {
+		t.Errorf("Expected default upload options. Got %+v, %v", opts, optsErr)
+	}
+
+	opts, optsErr = getPutOptions(config.S3UploadConfig{PartSize: "64MiB", Concurrency: 8, MemoryLimit: "256MiB"}, -1)
+	if optsErr != nil || opts.PartSize != 64*1024*1024 || opts.NumThreads != 4 {
+		t.Errorf("Expected concurrency to be reduced to 4 to respect the memory limit. Got %+v, %v", opts, optsErr)
+	}
+
+	opts, optsErr = getPutOptions(config.S3UploadConfig{PartSize: "16MiB", Concurrency: 1}, 200*1024*1024*1024)
+	if optsErr != nil || opts.PartSize*MAX_PARTS_COUNT < 200*1024*1024*1024 || opts.ConcurrentStreamParts {
+		t.Errorf("Expected part size to be increased to fit the object in the maximum number of parts. Got %+v, %v", opts, optsErr)
+	}
+
+	_, optsErr = getPutOptions(config.S3UploadConfig{PartSize: "64MiB", MemoryLimit: "32MiB"}, -1)
+	if optsErr == nil {
+		t.Errorf("Expected an error when the memory limit is lower than the part size")
+	}
+}
+
+func TestGetPartSize(t *testing.T) {
+	alignment := int64(1024*1024 + 40)
+
+	partSize, partSizeErr := GetPartSize(config.S3UploadConfig{PartSize: "16MiB"}, -1, alignment)
+	if partSizeErr != nil || partSize%alignment != 0 || partSize < 16*1024*1024 {
+		t.Errorf("Expected the part size to be aligned on encryption chunks. Got %d, %v", partSize, partSizeErr)
+	}
+
+	partSize, partSizeErr = GetPartSize(config.S3UploadConfig{PartSize: "1MiB"}, -1, 1)
+	if partSizeErr != nil || partSize != MIN_PART_SIZE {
+		t.Errorf("Expected the part size to be raised to the minimum part size. Got %d, %v", partSize, partSizeErr)
+	}
+}
@@ -0,0 +1,225 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/keyspace"
+
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+//Name of the bucket where etcd's mvcc store keeps the key revisions
+var keyBucket = []byte("key")
+
+//Revision keys are the main revision (8 bytes), a separator and the sub revision (8 bytes)
+const revisionKeySize = 17
+
+//Revision keys of deletions have an additional tombstone marker
+const tombstoneMark = 't'
+
+type Revision struct {
+	Main int64
+	Sub  int64
+}
+
+func parseRevisionKey(key []byte) (Revision, bool, error) {
+	if len(key) != revisionKeySize && len(key) != revisionKeySize+1 {
+		return Revision{}, false, errors.New(fmt.Sprintf("Revision key of unexpected length %d in snapshot", len(key)))
+	}
+
+	return Revision{
+		Main: int64(binary.BigEndian.Uint64(key[0:8])),
+		Sub:  int64(binary.BigEndian.Uint64(key[9:17])),
+	}, len(key) == revisionKeySize+1 && key[revisionKeySize] == tombstoneMark, nil
+}
+
+func open(path string, readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: readOnly, Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error opening snapshot file '%s': %s", path, err.Error()))
+	}
+
+	return db, nil
+}
+
+type KeyFilter func(key string) bool
+
+/*
+Reads the state of the keys in a snapshot file at the snapshot's revision, which is also returned.
+Only the keys accepted by the filter are returned.
+The snapshot file is opened in read-only mode.
+*/
+func ReadKeys(path string, filter KeyFilter) (map[string]keyspace.KeyRecord, int64, error) {
+	keys := map[string]keyspace.KeyRecord{}
+	revision := int64(0)
+
+	db, dbErr := open(path, true)
+	if dbErr != nil {
+		return keys, revision, dbErr
+	}
+	defer db.Close()
+
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(keyBucket)
+		if bucket == nil {
+			return errors.New("Snapshot does not contain a key bucket")
+		}
+
+		//Bucket entries are ordered by revision, so later entries override earlier ones
+		return bucket.ForEach(func(revKey []byte, value []byte) error {
+			rev, tombstone, revErr := parseRevisionKey(revKey)
+			if revErr != nil {
+				return revErr
+			}
+			revision = rev.Main
+
+			var kv mvccpb.KeyValue
+			unmarshalErr := kv.Unmarshal(value)
+			if unmarshalErr != nil {
+				return unmarshalErr
+			}
+
+			key := string(kv.Key)
+			if !filter(key) {
+				return nil
+			}
+
+			if tombstone {
+				delete(keys, key)
+				return nil
+			}
+
+			keys[key] = keyspace.KeyRecord{
+				Key:            key,
+				Value:          kv.Value,
+				Lease:          kv.Lease,
+				CreateRevision: kv.CreateRevision,
+				ModRevision:    kv.ModRevision,
+				Version:        kv.Version,
+			}
+
+			return nil
+		})
+	})
+
+	return keys, revision, err
+}
+
+func formatRevisionKey(rev Revision, tombstone bool) []byte {
+	key := make([]byte, revisionKeySize, revisionKeySize+1)
+	binary.BigEndian.PutUint64(key[0:8], uint64(rev.Main))
+	key[8] = '_'
+	binary.BigEndian.PutUint64(key[9:17], uint64(rev.Sub))
+	if tombstone {
+		key = append(key, tombstoneMark)
+	}
+
+	return key
+}
+
+func getRevision(tx *bolt.Tx) (int64, error) {
+	bucket := tx.Bucket(keyBucket)
+	if bucket == nil {
+		return 0, errors.New("Snapshot does not contain a key bucket")
+	}
+
+	lastKey, _ := bucket.Cursor().Last()
+	if lastKey == nil {
+		return 0, nil
+	}
+
+	rev, _, revErr := parseRevisionKey(lastKey)
+	return rev.Main, revErr
+}
+
+/*
+Returns the revision of the etcd store at the moment the snapshot was taken
+*/
+func GetRevision(path string) (int64, error) {
+	db, dbErr := open(path, true)
+	if dbErr != nil {
+		return 0, dbErr
+	}
+	defer db.Close()
+
+	revision := int64(0)
+	err := db.View(func(tx *bolt.Tx) error {
+		var revErr error
+		revision, revErr = getRevision(tx)
+		return revErr
+	})
+
+	return revision, err
+}
+
+/*
+Writes changes reported by the watch stream in the snapshot file as if etcd had applied them.
+Changes at or below the snapshot's revision, or above the maximum revision if it is positive, are skipped.
+Changes must be in revision order. Returns the revision of the snapshot after the changes are applied.
+Note that the snapshot's integrity hash will no longer match its content afterwards.
+*/
+func ApplyChanges(path string, changes []keyspace.ChangeRecord, maxRevision int64) (int64, error) {
+	db, dbErr := open(path, false)
+	if dbErr != nil {
+		return 0, dbErr
+	}
+	defer db.Close()
+
+	revision := int64(0)
+	err := db.Update(func(tx *bolt.Tx) error {
+		var revErr error
+		revision, revErr = getRevision(tx)
+		if revErr != nil {
+			return revErr
+		}
+
+		bucket := tx.Bucket(keyBucket)
+		last := Revision{Main: revision, Sub: -1}
+		for _, change := range changes {
+			if change.ModRevision <= revision || (maxRevision > 0 && change.ModRevision > maxRevision) {
+				continue
+			}
+
+			//Changes from the same transaction share a main revision and are distinguished by their sub revision
+			rev := Revision{Main: change.ModRevision, Sub: 0}
+			if rev.Main == last.Main {
+				rev.Sub = last.Sub + 1
+			} else if rev.Main < last.Main {
+				return errors.New(fmt.Sprintf("Change on key '%s' at revision %d is out of order", change.Key, change.ModRevision))
+			}
+
+			kv := mvccpb.KeyValue{Key: []byte(change.Key)}
+			if !change.Deleted {
+				kv = mvccpb.KeyValue{
+					Key:            []byte(change.Key),
+					Value:          change.Value,
+					Lease:          change.Lease,
+					CreateRevision: change.CreateRevision,
+					ModRevision:    change.ModRevision,
+					Version:        change.Version,
+				}
+			}
+
+			val, marshalErr := kv.Marshal()
+			if marshalErr != nil {
+				return marshalErr
+			}
+
+			putErr := bucket.Put(formatRevisionKey(rev, change.Deleted), val)
+			if putErr != nil {
+				return putErr
+			}
+
+			last = rev
+		}
+
+		revision = last.Main
+		return nil
+	})
+
+	return revision, err
+}
@@ -0,0 +1,133 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/keyspace"
+
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+func writeTestRevision(t *testing.T, bucket *bolt.Bucket, main int64, tombstone bool, kv mvccpb.KeyValue) {
+	revKey := formatRevisionKey(Revision{Main: main, Sub: 0}, tombstone)
+
+	val, marshalErr := kv.Marshal()
+	if marshalErr != nil {
+		t.Fatalf("Error marshalling key value: %s", marshalErr.Error())
+	}
+
+	putErr := bucket.Put(revKey, val)
+	if putErr != nil {
+		t.Fatalf("Error writing revision: %s", putErr.Error())
+	}
+}
+
+func createTestSnapshot(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+
+	db, dbErr := bolt.Open(path, 0600, nil)
+	if dbErr != nil {
+		t.Fatalf("Error creating test snapshot: %s", dbErr.Error())
+	}
+
+	updErr := db.Update(func(tx *bolt.Tx) error {
+		bucket, bucketErr := tx.CreateBucket(keyBucket)
+		if bucketErr != nil {
+			return bucketErr
+		}
+
+		writeTestRevision(t, bucket, 2, false, mvccpb.KeyValue{Key: []byte("/app/a"), Value: []byte("a1"), CreateRevision: 2, ModRevision: 2, Version: 1})
+		writeTestRevision(t, bucket, 3, false, mvccpb.KeyValue{Key: []byte("/app/b"), Value: []byte("b1"), CreateRevision: 3, ModRevision: 3, Version: 1})
+		writeTestRevision(t, bucket, 4, false, mvccpb.KeyValue{Key: []byte("/app/a"), Value: []byte("a2"), CreateRevision: 2, ModRevision: 4, Version: 2})
+		writeTestRevision(t, bucket, 5, true, mvccpb.KeyValue{Key: []byte("/app/b")})
+		writeTestRevision(t, bucket, 6, false, mvccpb.KeyValue{Key: []byte("/other/c"), Value: []byte("c1"), CreateRevision: 6, ModRevision: 6, Version: 1})
+		return nil
+	})
+	db.Close()
+	if updErr != nil {
+		t.Fatalf("Error populating test snapshot: %s", updErr.Error())
+	}
+
+	return path
+}
+
+func TestReadKeys(t *testing.T) {
+	path := createTestSnapshot(t)
+
+	keys, revision, readErr := ReadKeys(path, func(key string) bool {
+		return strings.HasPrefix(key, "/app/")
+	})
+	if readErr != nil {
+		t.Errorf("Error reading keys: %s", readErr.Error())
+		return
+	}
+
+	if revision != 6 {
+		t.Errorf("Expected snapshot revision to be 6 and it was %d", revision)
+	}
+
+	if len(keys) != 1 {
+		t.Errorf("Expected 1 key to be read and %d were", len(keys))
+		return
+	}
+
+	a, ok := keys["/app/a"]
+	if !ok || string(a.Value) != "a2" || a.ModRevision != 4 || a.Version != 2 {
+		t.Errorf("Expected key '/app/a' to be at its latest value. Got %+v", a)
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	path := createTestSnapshot(t)
+
+	changes := []keyspace.ChangeRecord{
+		keyspace.ChangeRecord{KeyRecord: keyspace.KeyRecord{Key: "/other/c", Value: []byte("stale"), ModRevision: 6}},
+		keyspace.ChangeRecord{KeyRecord: keyspace.KeyRecord{Key: "/app/b", Value: []byte("b2"), CreateRevision: 7, ModRevision: 7, Version: 1}},
+		keyspace.ChangeRecord{KeyRecord: keyspace.KeyRecord{Key: "/app/c", Value: []byte("c1"), CreateRevision: 7, ModRevision: 7, Version: 1}},
+		keyspace.ChangeRecord{Deleted: true, KeyRecord: keyspace.KeyRecord{Key: "/app/a", ModRevision: 8}},
+		keyspace.ChangeRecord{KeyRecord: keyspace.KeyRecord{Key: "/app/d", Value: []byte("d1"), CreateRevision: 9, ModRevision: 9, Version: 1}},
+	}
+
+	revision, applyErr := ApplyChanges(path, changes, 8)
+	if applyErr != nil {
+		t.Errorf("Error applying changes: %s", applyErr.Error())
+		return
+	}
+
+	if revision != 8 {
+		t.Errorf("Expected revision after applying changes to be 8 and it was %d", revision)
+	}
+
+	keys, readRevision, readErr := ReadKeys(path, func(key string) bool { return true })
+	if readErr != nil {
+		t.Errorf("Error reading keys: %s", readErr.Error())
+		return
+	}
+
+	if readRevision != 8 {
+		t.Errorf("Expected snapshot revision to be 8 and it was %d", readRevision)
+	}
+
+	if _, ok := keys["/app/a"]; ok {
+		t.Errorf("Expected key '/app/a' to be deleted")
+	}
+
+	if b, ok := keys["/app/b"]; !ok || string(b.Value) != "b2" {
+		t.Errorf("Expected key '/app/b' to be recreated. Got %+v", b)
+	}
+
+	if c, ok := keys["/app/c"]; !ok || string(c.Value) != "c1" {
+		t.Errorf("Expected key '/app/c' to be created in the same transaction. Got %+v", c)
+	}
+
+	if c, ok := keys["/other/c"]; !ok || string(c.Value) != "c1" {
+		t.Errorf("Expected change at the snapshot's revision to be skipped. Got %+v", c)
+	}
+
+	if _, ok := keys["/app/d"]; ok {
+		t.Errorf("Expected change after the maximum revision to be skipped")
+	}
+}
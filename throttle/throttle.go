@@ -0,0 +1,81 @@
+package throttle
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+Limits the rate of the bytes going through one or several readers
+*/
+type Limiter struct {
+	BytesPerSecond int64
+	mutex          sync.Mutex
+	next           time.Time
+	//Clock of the limiter, replaced by tests
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+/*
+Returns a limiter of the given rate. A rate of 0 means that there is no limit, in which case nil is returned.
+*/
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &Limiter{BytesPerSecond: bytesPerSecond, now: time.Now, sleep: time.Sleep}
+}
+
+/*
+Waits until the bytes previously passed through the limiter fit in its rate and accounts for the given number of bytes.
+*/
+func (limiter *Limiter) Wait(n int) {
+	if limiter == nil || n <= 0 {
+		return
+	}
+
+	limiter.mutex.Lock()
+	now := limiter.now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	wait := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(time.Duration(float64(n) / float64(limiter.BytesPerSecond) * float64(time.Second)))
+	limiter.mutex.Unlock()
+
+	limiter.sleep(wait)
+}
+
+type Reader struct {
+	Source  io.Reader
+	Limiter *Limiter
+}
+
+/*
+Returns a reader whose reads are limited by the limiter. The source is returned as is if the limiter is nil.
+*/
+func NewReader(source io.Reader, limiter *Limiter) io.Reader {
+	if limiter == nil {
+		return source
+	}
+
+	return &Reader{Source: source, Limiter: limiter}
+}
+
+func (reader *Reader) Read(p []byte) (int, error) {
+	//Large reads are split so that the transfer stays steady
+	maxRead := int(reader.Limiter.BytesPerSecond / 10)
+	if maxRead < 1 {
+		maxRead = 1
+	}
+	if len(p) > maxRead {
+		p = p[:maxRead]
+	}
+
+	n, err := reader.Source.Read(p)
+	reader.Limiter.Wait(n)
+	return n, err
+}
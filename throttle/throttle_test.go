@@ -0,0 +1,116 @@
+package throttle
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+Returns a limiter whose clock is frozen at the start, along with the waits it requested.
+As the clock does not move, the waits only depend on the bytes accounted for, not on the speed of the machine.
+*/
+func getFrozenLimiter(bytesPerSecond int64) (*Limiter, time.Time, func() []time.Duration) {
+	start := time.Date(2024, 12, 6, 21, 22, 25, 0, time.UTC)
+	var mutex sync.Mutex
+	waits := []time.Duration{}
+
+	limiter := NewLimiter(bytesPerSecond)
+	limiter.now = func() time.Time {
+		return start
+	}
+	limiter.sleep = func(wait time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		waits = append(waits, wait)
+	}
+
+	return limiter, start, func() []time.Duration {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return waits
+	}
+}
+
+//Reads with a buffer larger than the rate, so that every read is split by the reader
+func readAll(reader io.Reader) ([]byte, error) {
+	content := []byte{}
+	buffer := make([]byte, 2*1024*1024)
+	for {
+		n, readErr := reader.Read(buffer)
+		content = append(content, buffer[:n]...)
+		if readErr == io.EOF {
+			return content, nil
+		}
+		if readErr != nil {
+			return content, readErr
+		}
+	}
+}
+
+func isClose(duration time.Duration, expected time.Duration) bool {
+	return duration > expected-time.Microsecond && duration < expected+time.Microsecond
+}
+
+func TestReader(t *testing.T) {
+	content := make([]byte, 300*1024)
+	limiter, start, getWaits := getFrozenLimiter(1024 * 1024)
+
+	read, readErr := readAll(NewReader(bytes.NewReader(content), limiter))
+	if readErr != nil || len(read) != len(content) {
+		t.Errorf("Expected to read the whole content. Got %d bytes, %v", len(read), readErr)
+		return
+	}
+
+	//Reads are split in tenths of the rate and each one waits for the bytes read before it
+	waits := getWaits()
+	chunk := time.Duration(1024*1024/10) * time.Second / (1024 * 1024)
+	if len(waits) != 3 || waits[0] != 0 || !isClose(waits[1], chunk) || !isClose(waits[2], 2*chunk) {
+		t.Errorf("Expected 3 reads of a tenth of the rate waiting for the previous ones. Got %v", waits)
+	}
+
+	if accounted := limiter.next.Sub(start); !isClose(accounted, 300*time.Second/1024) {
+		t.Errorf("Expected 300KiB at 1MiB/s to be accounted for as 293ms. Got %s", accounted)
+	}
+
+	if NewReader(bytes.NewReader(content), NewLimiter(0)) == nil {
+		t.Errorf("Expected a reader without limit to be returned")
+	}
+}
+
+func TestSharedLimiter(t *testing.T) {
+	limiter, start, getWaits := getFrozenLimiter(1024 * 1024)
+	done := make(chan error)
+
+	for idx := 0; idx < 3; idx++ {
+		go func() {
+			_, readErr := readAll(NewReader(bytes.NewReader(make([]byte, 100*1024)), limiter))
+			done <- readErr
+		}()
+	}
+
+	for idx := 0; idx < 3; idx++ {
+		readErr := <-done
+		if readErr != nil {
+			t.Errorf("Error reading: %s", readErr.Error())
+		}
+	}
+
+	//Whatever the order of the reads, each one waits for the reads that were accounted for before it
+	waits := getWaits()
+	longest := time.Duration(0)
+	for _, wait := range waits {
+		if wait > longest {
+			longest = wait
+		}
+	}
+	if len(waits) != 3 || !isClose(longest, 200*time.Second/1024) {
+		t.Errorf("Expected the last of 3 readers of 100KiB sharing a limiter of 1MiB/s to wait for the 200KiB read before it. Got %v", waits)
+	}
+
+	if accounted := limiter.next.Sub(start); !isClose(accounted, 300*time.Second/1024) {
+		t.Errorf("Expected readers sharing a limiter of 1MiB/s to be accounted for as 293ms for 300KiB. Got %s", accounted)
+	}
+}
@@ -0,0 +1,295 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/cluster"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/hooks"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/keyspace"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/lock"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/logger"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/notify"
+	"github.com/Ferlab-Ste-Justine/etcd-backup/s3"
+)
+
+/*
+Problems found in a configuration, each prefixed by the key it concerns.
+Errors prevent commands from working, warnings only concern some uses of the configuration.
+*/
+type Report struct {
+	Errors   []string
+	Warnings []string
+}
+
+func (report *Report) IsValid() bool {
+	return len(report.Errors) == 0
+}
+
+func (report *Report) addError(key string, err error) {
+	report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", key, err.Error()))
+}
+
+func (report *Report) addWarning(key string, err error) {
+	report.Warnings = append(report.Warnings, fmt.Sprintf("%s: %s", key, err.Error()))
+}
+
+func (report *Report) checkRequired(key string, val string) {
+	if val == "" {
+		report.addError(key, errors.New("A value is required"))
+	}
+}
+
+func (report *Report) checkFile(key string, path string) {
+	if path == "" {
+		return
+	}
+
+	_, statErr := os.Stat(path)
+	if errors.Is(statErr, fs.ErrNotExist) {
+		report.addError(key, errors.New(fmt.Sprintf("File '%s' does not exist", path)))
+	} else if statErr != nil {
+		report.addError(key, statErr)
+	}
+}
+
+func (report *Report) checkEtcdClient(key string, etcdConf config.EtcdClientConfig) {
+	if len(etcdConf.Endpoints) == 0 {
+		report.addError(key+".endpoints", errors.New("At least one endpoint is required"))
+	}
+
+	//The etcd client always uses tls and authenticates with a certificate or a password
+	report.checkRequired(key+".auth.ca_cert", etcdConf.Auth.CaCert)
+	report.checkFile(key+".auth.ca_cert", etcdConf.Auth.CaCert)
+	report.checkFile(key+".auth.client_cert", etcdConf.Auth.ClientCert)
+	report.checkFile(key+".auth.client_key", etcdConf.Auth.ClientKey)
+	report.checkFile(key+".auth.password_auth", etcdConf.Auth.PasswordAuth)
+	report.checkFile(key+".auth.password_file", etcdConf.Auth.PasswordFile)
+
+	if (etcdConf.Auth.ClientCert == "") != (etcdConf.Auth.ClientKey == "") {
+		report.addError(key+".auth", errors.New("The client_cert and client_key are required together"))
+	}
+
+	//The secret files are not read before the configuration is validated
+	hasUsername := etcdConf.Auth.Username != "" || etcdConf.Auth.PasswordAuth != ""
+	hasPassword := etcdConf.Auth.Password != "" || etcdConf.Auth.PasswordFile != "" || etcdConf.Auth.PasswordAuth != ""
+	if hasUsername != hasPassword {
+		report.addError(key+".auth", errors.New("The username and password are required together"))
+	}
+
+	if (!hasUsername) && etcdConf.Auth.ClientCert == "" {
+		report.addError(key+".auth", errors.New("Credentials are required, either a client_cert and client_key or a username and password, from password_auth, username and password or password_file"))
+	}
+}
+
+func (report *Report) checkS3Client(key string, s3Conf config.S3ClientConfig) {
+	report.checkRequired(key+".endpoint", s3Conf.Endpoint)
+	report.checkRequired(key+".bucket", s3Conf.Bucket)
+	report.checkFile(key+".auth.ca_cert", s3Conf.Auth.CaCert)
+	report.checkFile(key+".auth.key_auth", s3Conf.Auth.KeyAuth)
+	report.checkFile(key+".auth.access_key_file", s3Conf.Auth.AccessKeyFile)
+	report.checkFile(key+".auth.secret_key_file", s3Conf.Auth.SecretKeyFile)
+
+	hasAccessKey := s3Conf.Auth.AccessKey != "" || s3Conf.Auth.AccessKeyFile != "" || s3Conf.Auth.KeyAuth != ""
+	hasSecretKey := s3Conf.Auth.SecretKey != "" || s3Conf.Auth.SecretKeyFile != "" || s3Conf.Auth.KeyAuth != ""
+	if (!hasAccessKey) || (!hasSecretKey) {
+		report.addError(key+".auth", errors.New("An access key and a secret key are required, from key_auth, access_key and secret_key or access_key_file and secret_key_file"))
+	}
+
+	validErr := s3.ValidateConfig(s3Conf)
+	if validErr != nil {
+		report.addError(key, validErr)
+	}
+}
+
+func (report *Report) checkRetention(key string, retention config.RetentionConfig) {
+	if retention.MaxAge != "" {
+		_, parseErr := config.ParseDuration(retention.MaxAge)
+		if parseErr != nil {
+			report.addError(key+".max_age", parseErr)
+		}
+	}
+
+	if retention.MinCount < 0 {
+		report.addError(key+".min_count", errors.New("The minimum count cannot be negative"))
+	}
+}
+
+func (report *Report) checkHooks(key string, hookConfs []config.HookConfig) {
+	for idx, hook := range hookConfs {
+		hookKey := fmt.Sprintf("%s[%d]", key, idx)
+		if len(hook.Command) == 0 {
+			report.addError(hookKey+".command", errors.New("A command is required"))
+		}
+
+		policyErr := hooks.ValidateHookPolicy(hook.OnFailure)
+		if policyErr != nil {
+			report.addError(hookKey+".on_failure", policyErr)
+		}
+	}
+}
+
+/*
+Checks that the directory of the snapshot path exists, for the snapshot to be written in it
+*/
+func (report *Report) checkSnapshotPath(key string, path string) {
+	if path == "" {
+		report.checkRequired(key, path)
+		return
+	}
+
+	report.checkFile(key, filepath.Dir(path))
+}
+
+func (report *Report) checkServer(serverConf config.ServerConfig) {
+	report.checkFile("server.tls.certificate", serverConf.Tls.Certificate)
+	report.checkFile("server.tls.key", serverConf.Tls.Key)
+	report.checkFile("server.tls.client_ca_cert", serverConf.Tls.ClientCaCert)
+	report.checkFile("server.token_path", serverConf.TokenPath)
+
+	if (serverConf.Tls.Certificate == "") != (serverConf.Tls.Key == "") {
+		report.addError("server.tls", errors.New("The certificate and key are required together"))
+	}
+
+	if serverConf.Tls.ClientCaCert != "" && serverConf.Tls.Certificate == "" {
+		report.addError("server.tls.client_ca_cert", errors.New("A server certificate is required to authenticate clients with certificates"))
+	}
+
+	if serverConf.Tls.ClientCaCert == "" && serverConf.TokenPath == "" {
+		report.addWarning("server", errors.New("The serve command requires a tls.client_ca_cert or a token_path to authenticate its clients"))
+	}
+
+	if serverConf.MaxPending < 1 {
+		report.addError("server.max_pending", errors.New("At least one pending job must be allowed"))
+	}
+}
+
+/*
+Checks a configuration, with its defaults applied, for missing required values, files that do not exist and values that
+are only parsed when they are used, so that the problems are known before a command needs them.
+*/
+func Validate(conf config.Config) Report {
+	report := Report{Errors: []string{}, Warnings: []string{}}
+
+	if len(conf.Targets) == 0 {
+		report.checkEtcdClient("etcd_client", conf.EtcdClient)
+	}
+
+	//The snapshot path of the configuration is the default of the targets
+	needsSnapshotPath := len(conf.Targets) == 0
+	targetNames := map[string]bool{}
+	for idx, target := range conf.Targets {
+		key := fmt.Sprintf("targets[%d]", idx)
+		report.checkRequired(key+".name", target.Name)
+		if target.Name != "" && targetNames[target.Name] {
+			report.addError(key+".name", errors.New(fmt.Sprintf("Target '%s' is defined more than once", target.Name)))
+		}
+		targetNames[target.Name] = true
+
+		report.checkEtcdClient(key+".etcd_client", target.EtcdClient)
+		if target.SnapshotPath != "" {
+			report.checkSnapshotPath(key+".snapshot_path", target.SnapshotPath)
+		} else {
+			needsSnapshotPath = true
+		}
+		report.checkFile(key+".encryption_key_path", target.EncryptionKeyPath)
+		if target.KeyExport.Format != "" {
+			formatErr := keyspace.ValidateFormat(target.KeyExport.Format)
+			if formatErr != nil {
+				report.addError(key+".key_export.format", formatErr)
+			}
+		}
+		report.checkRetention(key+".retention", target.Retention)
+	}
+
+	if needsSnapshotPath || conf.SnapshotPath != "" {
+		report.checkSnapshotPath("snapshot_path", conf.SnapshotPath)
+	}
+	report.checkFile("encryption_key_path", conf.EncryptionKeyPath)
+	report.checkS3Client("s3_client", conf.S3Client)
+	report.checkRetention("retention", conf.Retention)
+
+	replicaNames := map[string]bool{}
+	for idx, replica := range conf.Replicas {
+		key := fmt.Sprintf("replicas[%d]", idx)
+		report.checkRequired(key+".name", replica.Name)
+		if replica.Name != "" && replicaNames[replica.Name] {
+			report.addError(key+".name", errors.New(fmt.Sprintf("Replica '%s' is defined more than once", replica.Name)))
+		}
+		replicaNames[replica.Name] = true
+
+		//The objects of the replicas are named like the ones of the configuration
+		replica.S3Client.ObjectsPrefix = conf.S3Client.ObjectsPrefix
+		replica.S3Client.Naming = conf.S3Client.Naming
+		report.checkS3Client(key+".s3_client", replica.S3Client)
+		report.checkFile(key+".encryption_key_path", replica.EncryptionKeyPath)
+		report.checkRetention(key+".retention", replica.Retention)
+	}
+
+	selectionErr := cluster.ValidateSelectionPolicy(conf.Backup.MemberSelection)
+	if selectionErr != nil {
+		report.addError("backup.member_selection", selectionErr)
+	}
+
+	healthErr := cluster.ValidateHealthPolicy(conf.Backup.OnUnhealthy)
+	if healthErr != nil {
+		report.addError("backup.on_unhealthy", healthErr)
+	}
+
+	formatErr := keyspace.ValidateFormat(conf.KeyExport.Format)
+	if formatErr != nil {
+		report.addError("key_export.format", formatErr)
+	}
+
+	report.checkHooks("hooks.pre_backup", conf.Hooks.PreBackup)
+	report.checkHooks("hooks.post_backup", conf.Hooks.PostBackup)
+	report.checkHooks("hooks.pre_restore", conf.Hooks.PreRestore)
+	report.checkHooks("hooks.post_restore", conf.Hooks.PostRestore)
+
+	notifierNames := map[string]bool{}
+	for idx, notifier := range conf.Notifiers {
+		key := fmt.Sprintf("notifiers[%d]", idx)
+		report.checkRequired(key+".name", notifier.Name)
+		if notifier.Name != "" && notifierNames[notifier.Name] {
+			report.addError(key+".name", errors.New(fmt.Sprintf("Notifier '%s' is defined more than once", notifier.Name)))
+		}
+		notifierNames[notifier.Name] = true
+
+		notifierErr := notify.ValidateNotifier(notifier)
+		if notifierErr != nil {
+			report.addError(key, notifierErr)
+		}
+	}
+
+	backendErr := lock.ValidateBackend(conf.Lock.Backend)
+	if backendErr != nil {
+		report.addError("lock.backend", backendErr)
+	}
+
+	if conf.Lock.Ttl < config.MIN_LOCK_TTL {
+		report.addError("lock.ttl", errors.New(fmt.Sprintf("The lease of the lock must last at least %s", config.MIN_LOCK_TTL)))
+	}
+
+	if conf.Lock.Timeout < 0 {
+		report.addError("lock.timeout", errors.New("The timeout cannot be negative"))
+	}
+
+	report.checkServer(conf.Server)
+
+	logLevel := strings.ToLower(conf.LogLevel)
+	if logLevel != "" && logLevel != "error" && logLevel != "warning" && logLevel != "info" && logLevel != "debug" {
+		report.addError("log_level", errors.New(fmt.Sprintf("Unsupported log level '%s'. Valid levels are 'debug', 'info', 'warning' and 'error'", conf.LogLevel)))
+	}
+
+	logFormatErr := logger.ValidateFormat(conf.LogFormat)
+	if logFormatErr != nil {
+		report.addError("log_format", logFormatErr)
+	}
+
+	return report
+}
@@ -0,0 +1,147 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ferlab-Ste-Justine/etcd-backup/config"
+)
+
+func hasProblem(problems []string, prefix string) bool {
+	for _, problem := range problems {
+		if strings.HasPrefix(problem, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getValidConfig(dir string) config.Config {
+	caCert := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caCert, []byte("ca"), 0600)
+
+	return config.Config{
+		EtcdClient: config.EtcdClientConfig{
+			Endpoints: []string{"127.0.0.1:2379"},
+			Auth:      config.EtcdClientAuthConfig{CaCert: caCert, Username: "root", Password: "secret"},
+		},
+		SnapshotPath: filepath.Join(dir, "snapshot"),
+		S3Client: config.S3ClientConfig{
+			ObjectsPrefix: "backup",
+			Endpoint:      "s3.local:9000",
+			Bucket:        "backups",
+			Auth:          config.S3AuthConfig{AccessKey: "access", SecretKey: "secret"},
+		},
+		Backup:    config.BackupConfig{MemberSelection: "leader", OnUnhealthy: "fail"},
+		KeyExport: config.KeyExportConfig{Format: "jsonl"},
+		Retention: config.RetentionConfig{MaxAge: "15d", MinCount: 20},
+		Lock:      config.LockConfig{Backend: "none", Ttl: 2 * time.Minute},
+		Server:    config.ServerConfig{MaxPending: 10, MaxHistory: 100},
+		LogFormat: "text",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+
+	report := Validate(getValidConfig(dir))
+	if !report.IsValid() || !hasProblem(report.Warnings, "server:") {
+		t.Errorf("Expected a valid configuration, with a warning for the server without authentication. Got %+v", report)
+	}
+
+	conf := getValidConfig(dir)
+	conf.EtcdClient.Endpoints = []string{}
+	conf.S3Client.Bucket = ""
+	conf.S3Client.Auth.SecretKey = ""
+	conf.S3Client.Naming.Template = "{prefix}-{unknown}"
+	conf.EncryptionKeyPath = filepath.Join(dir, "missing.key")
+	conf.Retention.MaxAge = "soon"
+	conf.Hooks.PreBackup = []config.HookConfig{config.HookConfig{Command: []string{"true"}, OnFailure: "ignore"}}
+	conf.Notifiers = []config.NotifierConfig{config.NotifierConfig{Name: "n", Type: "webhook"}}
+	conf.Lock.Backend = "redis"
+	conf.LogFormat = "xml"
+
+	report = Validate(conf)
+	expected := []string{
+		"etcd_client.endpoints:",
+		"s3_client.bucket:",
+		"s3_client.auth:",
+		"s3_client: Unknown placeholder",
+		"encryption_key_path: File",
+		"retention.max_age:",
+		"hooks.pre_backup[0].on_failure:",
+		"notifiers[0]: A url is required",
+		"lock.backend:",
+		"log_format:",
+	}
+	for _, prefix := range expected {
+		if !hasProblem(report.Errors, prefix) {
+			t.Errorf("Expected an error starting with '%s'. Got %v", prefix, report.Errors)
+		}
+	}
+
+	if len(report.Errors) != len(expected) {
+		t.Errorf("Expected %d errors. Got %v", len(expected), report.Errors)
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	dir := t.TempDir()
+
+	conf := getValidConfig(dir)
+	conf.EtcdClient = config.EtcdClientConfig{}
+	conf.SnapshotPath = ""
+	etcdConf := getValidConfig(dir).EtcdClient
+	conf.Targets = []config.TargetConfig{
+		config.TargetConfig{Name: "a", EtcdClient: etcdConf, SnapshotPath: filepath.Join(dir, "a")},
+		config.TargetConfig{Name: "a", EtcdClient: etcdConf, SnapshotPath: filepath.Join(dir, "missing", "b"), KeyExport: config.KeyExportConfig{Format: "xml"}},
+	}
+
+	report := Validate(conf)
+	if len(report.Errors) != 3 || !hasProblem(report.Errors, "targets[1].name: Target 'a' is defined more than once") || !hasProblem(report.Errors, "targets[1].snapshot_path: File") || !hasProblem(report.Errors, "targets[1].key_export.format:") {
+		t.Errorf("Expected the duplicated target name, the missing snapshot directory and the export format of the target to be reported, with the etcd client and snapshot path of the targets. Got %v", report.Errors)
+	}
+}
+
+func TestValidateSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	os.WriteFile(passwordFile, []byte("secret"), 0600)
+
+	conf := getValidConfig(dir)
+	conf.EtcdClient.Auth.Password = ""
+	conf.EtcdClient.Auth.PasswordFile = passwordFile
+	conf.S3Client.Auth = config.S3AuthConfig{KeyAuth: filepath.Join(dir, "key_auth.yml")}
+
+	report := Validate(conf)
+	if len(report.Errors) != 1 || !hasProblem(report.Errors, "s3_client.auth.key_auth: File") {
+		t.Errorf("Expected the missing key auth file to be reported, with the credentials of the secret files. Got %v", report.Errors)
+	}
+
+	conf = getValidConfig(dir)
+	conf.EtcdClient.Auth.Username = ""
+	conf.EtcdClient.Auth.Password = ""
+	conf.EtcdClient.Auth.PasswordAuth = filepath.Join(dir, "password_auth.yml")
+	conf.S3Client.Auth.AccessKeyFile = filepath.Join(dir, "access_key")
+	conf.S3Client.Auth.SecretKeyFile = filepath.Join(dir, "secret_key")
+
+	report = Validate(conf)
+	expected := []string{
+		"etcd_client.auth.password_auth: File",
+		"s3_client.auth.access_key_file: File",
+		"s3_client.auth.secret_key_file: File",
+	}
+	for _, prefix := range expected {
+		if !hasProblem(report.Errors, prefix) {
+			t.Errorf("Expected an error starting with '%s'. Got %v", prefix, report.Errors)
+		}
+	}
+
+	if len(report.Errors) != len(expected) {
+		t.Errorf("Expected %d errors. Got %v", len(expected), report.Errors)
+	}
+}